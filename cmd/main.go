@@ -10,6 +10,8 @@ import (
 	"github.com/mahi-qwe/ecommerce-backend/models"
 	"github.com/mahi-qwe/ecommerce-backend/routes"
 	"github.com/mahi-qwe/ecommerce-backend/seeders"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
 )
 
 func main() {
@@ -20,6 +22,11 @@ func main() {
 
 	// stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
+	// Load JWT signing/verification keys
+	if err := utils.LoadJWTKeys(); err != nil {
+		log.Fatal("Failed to load JWT keys: ", err)
+	}
+
 	// Connect DB
 	config.ConnectDatabase()
 
@@ -29,14 +36,24 @@ func main() {
 	// Seed initial data
 	seeders.Seed(config.DB)
 
+	// Background imports don't survive a restart
+	services.FailInterruptedImports(config.DB)
+
+	// Keep product prices in step with scheduled sales
+	services.StartPriceScheduler(config.DB)
+
 	r := gin.Default()
 
 	r.Use(middlewares.CORSMiddleware())
 
+	routes.WellKnownRoutes(r)
 	routes.AuthRoutes(r)
 	routes.UserRoutes(r)
 	routes.AdminRoutes(r)
 	routes.ProductRoutes(r)
+	routes.CategoryRoutes(r)
+	routes.MediaRoutes(r)
+	routes.ReviewRoutes(r)
 	routes.CartRoutes(r)
 	routes.WishlistRoutes(r)
 	routes.OrderRoutes(r)
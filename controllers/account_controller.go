@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// GET /user/data-export?format=json|zip - download everything we hold about the user
+func ExportUserDataHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	export, err := services.BuildDataExport(config.DB, getUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build data export"})
+		return
+	}
+
+	filename := fmt.Sprintf("my-data-%s.%s", export.GeneratedAt.Format("2006-01-02"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if format == "json" {
+		c.IndentedJSON(http.StatusOK, export)
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	if err := services.WriteDataExportZip(c.Writer, export); err != nil {
+		// Headers are already out, all we can do is log it
+		log.Printf("❌ Data export for user %d failed: %v", export.Profile.ID, err)
+	}
+}
+
+// POST /user/account/delete - email a code to confirm deleting the account
+func RequestAccountDeletionHandler(c *gin.Context) {
+	var user models.User
+	if err := config.DB.First(&user, getUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// No point sending a code that can't be used yet
+	if err := services.CheckAccountDeletable(config.DB, user.ID); err != nil {
+		respondAccountDeletionError(c, err)
+		return
+	}
+
+	if err := services.SendAccountDeletionCode(user); err != nil {
+		respondOTPSendError(c, err, "Failed to send confirmation code")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "A confirmation code has been sent to your email.",
+	})
+}
+
+// POST /user/account/delete/confirm - anonymize and close the account
+func ConfirmAccountDeletionHandler(c *gin.Context) {
+	var input struct {
+		OTP string `json:"otp" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, getUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Checked before the code, so a 409 doesn't use it up
+	if err := services.CheckAccountDeletable(config.DB, user.ID); err != nil {
+		respondAccountDeletionError(c, err)
+		return
+	}
+
+	if err := services.VerifyAccountDeletionCode(user, input.OTP); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.DeleteAccount(config.DB, user.ID); err != nil {
+		respondAccountDeletionError(c, err)
+		return
+	}
+
+	// Last email to the real address, which we no longer store
+	go func(email string) {
+		body := fmt.Sprintf("Your account was deleted on %s. Your personal data has been removed; order and payment records are kept without it for accounting.", time.Now().Format(time.RFC1123))
+		if err := services.SendEmail(email, "Your account has been deleted", body); err != nil {
+			log.Printf("❌ Could not send account deletion email: %v", err)
+		}
+	}(user.Email)
+
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Your account has been deleted",
+	})
+}
+
+// respondAccountDeletionError maps account deletion errors to HTTP responses
+func respondAccountDeletionError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrOrdersInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+}
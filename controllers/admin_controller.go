@@ -1,12 +1,17 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
 )
 
 // UpdateUserHandler allows admin to update user info or role
@@ -15,6 +20,7 @@ func UpdateUserHandler(c *gin.Context) {
 
 	var input struct {
 		FullName  string  `json:"full_name"`
+		Email     string  `json:"email" binding:"omitempty,email"` // old address is notified and can revert
 		Role      string  `json:"role"`
 		Address   string  `json:"address"`
 		AvatarURL *string `json:"avatar_url"` // ✅ pointer type
@@ -31,6 +37,24 @@ func UpdateUserHandler(c *gin.Context) {
 		updates["full_name"] = input.FullName
 	}
 	if input.Role != "" {
+		// Handing out roles is a privilege of its own, or users:update could self-promote
+		callerRoleName := callerRole(c)
+		if allowed, err := services.HasPermission(config.DB, callerRoleName, "roles:manage"); err != nil || !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: missing permission roles:manage"})
+			return
+		}
+		if !services.RoleExists(config.DB, input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		// Nor hand out more than the caller has
+		outranked, err := services.RoleOutranks(config.DB, input.Role, func(permission string) (bool, error) {
+			return services.HasPermission(config.DB, callerRoleName, permission)
+		})
+		if err != nil || outranked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied: the role has permissions you don't"})
+			return
+		}
 		updates["role"] = input.Role
 	}
 	if input.Address != "" {
@@ -40,11 +64,34 @@ func UpdateUserHandler(c *gin.Context) {
 		updates["avatar_url"] = *input.AvatarURL
 	}
 
-	if len(updates) == 0 {
+	if len(updates) == 0 && input.Email == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
 		return
 	}
 
+	// Email goes first so a conflict leaves the rest untouched
+	if input.Email != "" {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+		if _, err := services.AdminChangeEmail(config.DB, uint(id), input.Email); err != nil {
+			if !respondEmailChangeError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email"})
+			}
+			return
+		}
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "User updated successfully",
+		})
+		return
+	}
+
 	updates["updated_at"] = time.Now()
 
 	if err := config.DB.Model(&models.User{}).
@@ -54,6 +101,14 @@ func UpdateUserHandler(c *gin.Context) {
 		return
 	}
 
+	// A role change must not wait for old tokens to expire
+	if input.Role != "" {
+		if err := revokeUserAccess(userID, false); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "User updated but existing tokens could not be revoked"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "User updated successfully",
@@ -71,6 +126,12 @@ func BlockUserHandler(c *gin.Context) {
 		return
 	}
 
+	// Cut off access and refresh tokens right away
+	if err := revokeUserAccess(userID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "User blocked but existing tokens could not be revoked"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
 		"message": "User blocked successfully",
@@ -94,16 +155,184 @@ func UnblockUserHandler(c *gin.Context) {
 	})
 }
 
+// UnlockUserHandler lifts a login lockout before it runs out
+func UnlockUserHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := services.UnlockAccount(config.DB, uint(userID)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "User unlocked successfully",
+	})
+}
+
+// GetLoginAttemptsHandler - login audit trail, newest first.
+// Optional filters: user_id, email, ip, success; limit defaults to 100 (max 500).
+func GetLoginAttemptsHandler(c *gin.Context) {
+	query := config.DB.Model(&models.LoginAttempt{})
+
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if email := c.Query("email"); email != "" {
+		query = query.Where("email = ?", email)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+	if success := c.Query("success"); success != "" {
+		ok, err := strconv.ParseBool(success)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "success must be true or false"})
+			return
+		}
+		query = query.Where("success = ?", ok)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Order("created_at desc").Limit(limit).Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch login attempts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"login_attempts": attempts})
+}
+
+// ImpersonateUserHandler issues a short-lived token to see the API as a customer does
+func ImpersonateUserHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" binding:"required"` // e.g. the support ticket
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, user, err := services.StartImpersonation(config.DB, getUserID(c), uint(userID), input.Reason, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrImpersonateSelf),
+			errors.Is(err, services.ErrImpersonateStaff),
+			errors.Is(err, services.ErrImpersonateBlocked):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        "success",
+		"access_token":  token,
+		"expires_in":    int(utils.ImpersonationTokenTTL.Seconds()),
+		"impersonating": gin.H{"id": user.ID, "email": user.Email, "full_name": user.FullName},
+		"message":       "Payments, password changes and deletions are blocked with this token; every request is logged.",
+	})
+}
+
+// GetImpersonationLogsHandler - impersonation audit log, newest first.
+// Optional filters: admin_id, user_id; limit defaults to 100 (max 500).
+func GetImpersonationLogsHandler(c *gin.Context) {
+	query := config.DB.Model(&models.ImpersonationLog{})
+
+	if adminID := c.Query("admin_id"); adminID != "" {
+		query = query.Where("admin_id = ?", adminID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	var logs []models.ImpersonationLog
+	if err := query.Order("created_at desc").Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch impersonation logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonation_logs": logs})
+}
+
 // GetAllUsersHandler - fetch all users
 func GetAllUsersHandler(c *gin.Context) {
-	var users []models.User
+	params, err := utils.ParseListParams(c.Request.URL.Query(), userListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch users")
+		return
+	}
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	role := f.String("role")
+	isBlocked, isVerified := f.Bool("is_blocked"), f.Bool("is_verified")
+	createdFrom, createdTo := f.TimeRange("created_from", "created_to")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch users")
+		return
+	}
+
+	query := config.DB.Model(&models.User{})
+
+	if role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if isBlocked != nil {
+		query = query.Where("is_blocked = ?", *isBlocked)
+	}
+	if isVerified != nil {
+		query = query.Where("is_verified = ?", *isVerified)
+	}
+	query = utils.WhereRange(query, "created_at", createdFrom, createdTo)
 
-	if err := config.DB.Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
+	var users []models.User
+	pageInfo, err := utils.Paginate(query, params, &users)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch users")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	c.JSON(http.StatusOK, gin.H{"data": users, "page_info": pageInfo})
+}
+
+// Fields GET /admin/users can be sorted by
+var userListSorts = utils.ListSpec{
+	SortFields: map[string]string{
+		"created_at": "created_at",
+		"full_name":  "full_name",
+		"email":      "email",
+		"id":         "id",
+	},
+	DefaultSort: "-created_at",
 }
 
 // GetUserByIDHandler - fetch a single user by ID
@@ -130,11 +359,32 @@ func DeleteUserHandler(c *gin.Context) {
 		return
 	}
 
-	// delete user
-	if err := config.DB.Delete(&user).Error; err != nil {
+	// Anonymize rather than just soft-delete, so no personal data is left behind
+	if err := services.DeleteAccount(config.DB, user.ID); err != nil {
+		if errors.Is(err, services.ErrOrdersInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+// revokeUserAccess invalidates the user's access tokens and optionally all their sessions
+func revokeUserAccess(userIDParam string, revokeSessions bool) error {
+	userID, err := strconv.Atoi(userIDParam)
+	if err != nil {
+		return err
+	}
+
+	if err := services.BumpTokenVersion(config.DB, uint(userID)); err != nil {
+		return err
+	}
+
+	if revokeSessions {
+		return utils.RevokeUserSessions(config.DB, uint(userID))
+	}
+	return nil
+}
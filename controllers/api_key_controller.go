@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// GET /admin/service-accounts - list service accounts
+func GetServiceAccountsHandler(c *gin.Context) {
+	var accounts []models.ServiceAccount
+	if err := config.DB.Order("name").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch service accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":           "success",
+		"service_accounts": accounts,
+	})
+}
+
+// POST /admin/service-accounts - create a service account for an integration
+func CreateServiceAccountHandler(c *gin.Context) {
+	var input struct {
+		Name        string `json:"name" binding:"required,max=100"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := services.CreateServiceAccount(config.DB, input.Name, input.Description, getUserID(c))
+	if err != nil {
+		respondAPIKeyError(c, err, "Failed to create service account")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":          "success",
+		"service_account": account,
+	})
+}
+
+// DELETE /admin/service-accounts/:id - delete a service account and revoke its keys
+func DeleteServiceAccountHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service account id"})
+		return
+	}
+
+	if err := services.DeleteServiceAccount(config.DB, uint(id)); err != nil {
+		respondAPIKeyError(c, err, "Failed to delete service account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Service account deleted and its API keys revoked",
+	})
+}
+
+// GET /admin/service-accounts/:id/api-keys - list a service account's keys (never the secrets)
+func GetAPIKeysHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service account id"})
+		return
+	}
+
+	var keys []models.APIKey
+	if err := config.DB.Where("service_account_id = ?", id).Order("created_at desc").Find(&keys).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch api keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"api_keys": keys,
+	})
+}
+
+// POST /admin/service-accounts/:id/api-keys - mint a key; the secret is only shown in this response
+func CreateAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid service account id"})
+		return
+	}
+
+	var input struct {
+		Name       string     `json:"name" binding:"required,max=100"`
+		Scopes     []string   `json:"scopes" binding:"required,min=1"` // e.g. ["products:write", "orders:read"]
+		AllowedIPs []string   `json:"allowed_ips"`                     // IPs or CIDRs; empty allows any
+		ExpiresAt  *time.Time `json:"expires_at"`                      // optional, RFC 3339
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.ExpiresAt != nil && input.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+
+	plain, key, err := services.CreateAPIKey(config.DB, callerRole(c), uint(id), input.Name, input.Scopes, input.AllowedIPs, input.ExpiresAt, getUserID(c))
+	if err != nil {
+		respondAPIKeyError(c, err, "Failed to create api key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"api_key": key,
+		"key":     plain,
+		"message": "Store this key now, it won't be shown again.",
+	})
+}
+
+// DELETE /admin/api-keys/:id - revoke an API key
+func RevokeAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+		return
+	}
+
+	if err := services.RevokeAPIKey(config.DB, uint(id)); err != nil {
+		respondAPIKeyError(c, err, "Failed to revoke api key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "API key revoked",
+	})
+}
+
+// respondAPIKeyError maps service account and API key errors to HTTP responses
+func respondAPIKeyError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrServiceAccountNotFound), errors.Is(err, services.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrScopeNotHeld):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrServiceAccountExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidScope), errors.Is(err, services.ErrInvalidIPAllowlist):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
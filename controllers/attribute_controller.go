@@ -0,0 +1,158 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// attributeInput is the JSON body for creating and editing attribute definitions
+type attributeInput struct {
+	Code       *string  `json:"code" binding:"omitempty,max=50"`
+	Name       *string  `json:"name" binding:"omitempty,max=100"`
+	Type       *string  `json:"type"` // text, number, boolean or select
+	Unit       *string  `json:"unit" binding:"omitempty,max=20"`
+	Options    []string `json:"options"` // allowed values of a select
+	Required   *bool    `json:"required"`
+	Filterable *bool    `json:"filterable"`
+	Position   *int     `json:"position"`
+}
+
+func (in attributeInput) toService() services.AttributeInput {
+	return services.AttributeInput{
+		Code:       in.Code,
+		Name:       in.Name,
+		Type:       in.Type,
+		Unit:       in.Unit,
+		Options:    in.Options,
+		Required:   in.Required,
+		Filterable: in.Filterable,
+		Position:   in.Position,
+	}
+}
+
+// GET /categories/:ref/attributes - the attributes products of a category
+// can have, its own and those inherited from parent categories (public)
+func GetCategoryAttributesHandler(c *gin.Context) {
+	category, err := services.FindCategory(config.DB, c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	attributes, err := services.CategoryAttributes(config.DB, category.ID)
+	if err != nil {
+		respondAttributeError(c, err, "Failed to fetch attributes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attributes": attributes})
+}
+
+// POST /admin/categories/:id/attributes - define an attribute for a category and its subcategories
+func CreateAttributeHandler(c *gin.Context) {
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+
+	var input attributeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Code == nil || input.Type == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and type are required"})
+		return
+	}
+
+	attribute, err := services.CreateAttribute(config.DB, uint(categoryID), input.toService())
+	if err != nil {
+		respondAttributeError(c, err, "Failed to create attribute")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":    "success",
+		"attribute": attribute,
+	})
+}
+
+// PUT /admin/categories/:id/attributes/:attribute_id - rename, reorder or change options and flags
+func UpdateAttributeHandler(c *gin.Context) {
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+	attributeID, err := strconv.Atoi(c.Param("attribute_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attribute id"})
+		return
+	}
+
+	var input attributeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Code != nil || input.Type != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and type can't be changed; delete the attribute and define a new one"})
+		return
+	}
+
+	attribute, err := services.UpdateAttribute(config.DB, uint(categoryID), uint(attributeID), input.toService())
+	if err != nil {
+		respondAttributeError(c, err, "Failed to update attribute")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "success",
+		"attribute": attribute,
+	})
+}
+
+// DELETE /admin/categories/:id/attributes/:attribute_id - remove an attribute and its product values
+func DeleteAttributeHandler(c *gin.Context) {
+	categoryID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+	attributeID, err := strconv.Atoi(c.Param("attribute_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attribute id"})
+		return
+	}
+
+	if err := services.DeleteAttribute(config.DB, uint(categoryID), uint(attributeID)); err != nil {
+		respondAttributeError(c, err, "Failed to delete attribute")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Attribute deleted",
+	})
+}
+
+// respondAttributeError maps attribute definition and value errors to HTTP responses
+func respondAttributeError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound), errors.Is(err, services.ErrAttributeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAttributeExists), errors.Is(err, services.ErrAttributeTypeConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidAttributeCode), errors.Is(err, services.ErrInvalidAttributeType),
+		errors.Is(err, services.ErrAttributeOptions), errors.Is(err, services.ErrInvalidAttribute):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,7 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +21,7 @@ func SignupHandler(c *gin.Context) {
 	var input struct {
 		FullName string `json:"full_name" binding:"required"`
 		Email    string `json:"email" binding:"required,email"`
-		Password string `json:"password" binding:"required,min=6"`
+		Password string `json:"password" binding:"required"`
 		Address  string `json:"address"`
 	}
 
@@ -25,6 +30,11 @@ func SignupHandler(c *gin.Context) {
 		return
 	}
 
+	if err := services.ValidatePasswordPolicy(input.Password); err != nil {
+		respondPasswordError(c, err, "Error creating account")
+		return
+	}
+
 	// Check if email already exists
 	var existingUser models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&existingUser).Error; err == nil {
@@ -55,6 +65,11 @@ func SignupHandler(c *gin.Context) {
 		return
 	}
 
+	if err := services.RecordPasswordHistory(config.DB, user.ID, input.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create user"})
+		return
+	}
+
 	// Generate OTP (already sends email inside)
 	if _, err := services.GenerateOTP(user.ID, user.Email, "signup"); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate OTP"})
@@ -79,64 +94,53 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	client := sessionInfo(c)
+
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
+		services.RecordLoginAttempt(config.DB, nil, input.Email, client, false, "unknown_email")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
+	if remaining := services.LockRemaining(user); remaining > 0 {
+		services.RecordLoginAttempt(config.DB, &user.ID, user.Email, client, false, "locked")
+		respondAccountLocked(c, remaining)
+		return
+	}
+
 	if !user.IsVerified {
+		services.RecordLoginAttempt(config.DB, &user.ID, user.Email, client, false, "unverified")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Please verify your email before login"})
 		return
 	}
 
 	if user.IsBlocked {
+		services.RecordLoginAttempt(config.DB, &user.ID, user.Email, client, false, "blocked")
 		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked. Please contact support."})
 		return
 	}
 
 	if !utils.CheckPasswordHash(input.Password, user.PasswordHash) {
+		lockedFor, err := services.RegisterFailedLogin(config.DB, &user, client, "bad_password")
+		if err != nil {
+			log.Printf("❌ Could not update lockout state for user %d: %v", user.ID, err)
+		}
+		if lockedFor > 0 {
+			respondAccountLocked(c, lockedFor)
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Generate JWT access token
-	accessToken, err := utils.GenerateJWT(int(user.ID), user.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating access token"})
-		return
-	}
-
-	// Generate refresh token
-	refreshToken, hashedToken, err := utils.GenerateRefreshToken()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
-		return
-	}
-
-	// Save hashed refresh token in DB
-	expiresAt := time.Now().Add(time.Hour * 1) // 1 hour
-	if err := utils.SaveRefreshToken(config.DB, user.ID, hashedToken, expiresAt); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save refresh token"})
-		return
-	}
-
-	// Set refresh token as HTTP-only cookie
-	c.SetCookie(
-		"refresh_token",
-		refreshToken,
-		int(time.Until(expiresAt).Seconds()),
-		"/", // path
-		"",
-		false,
-		true,
-	)
+	completeLogin(c, user, "password")
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"status":       "success",
-		"userId":       user.ID,
-		"access_token": accessToken,
-	})
+// respondAccountLocked tells the client how long the account stays locked
+func respondAccountLocked(c *gin.Context, remaining time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(remaining.Seconds()))))
+	c.JSON(http.StatusLocked, gin.H{"error": "Too many failed login attempts. Your account is temporarily locked."})
 }
 
 func RefreshTokenHandler(c *gin.Context) {
@@ -147,26 +151,74 @@ func RefreshTokenHandler(c *gin.Context) {
 		return
 	}
 
-	rt, err := utils.ValidateRefreshToken(config.DB, refreshToken)
+	// Consume the presented token and get its successor
+	newRefreshToken, rt, err := utils.RotateRefreshToken(config.DB, refreshToken, sessionInfo(c))
+	if errors.Is(err, utils.ErrRefreshTokenReused) {
+		clearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used. All sessions from this login have been revoked."})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
 		return
 	}
 
+	// Load current role and blocked status instead of trusting the old token
+	var user models.User
+	if err := config.DB.First(&user, rt.UserID).Error; err != nil {
+		if !revokeRefreshSuccessor(c, newRefreshToken) {
+			return
+		}
+		clearRefreshCookie(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.IsBlocked {
+		if !revokeRefreshSuccessor(c, newRefreshToken) {
+			return
+		}
+		clearRefreshCookie(c)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked. Please contact support."})
+		return
+	}
+
 	// Generate new access token
-	accessToken, err := utils.GenerateJWT(int(rt.UserID), "user") // replace "user" with actual role if needed
+	accessToken, err := utils.GenerateJWT(user, rt.FamilyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating access token"})
 		return
 	}
 
+	setRefreshCookie(c, newRefreshToken, rt.ExpiresAt)
+
 	c.JSON(http.StatusOK, gin.H{
 		"status":       "success",
 		"access_token": accessToken,
 	})
 }
 
+// revokeRefreshSuccessor drops a just-rotated refresh token with its family,
+// or on its own for tokens from before families existed
+func revokeRefreshSuccessor(c *gin.Context, token string) bool {
+	if err := utils.DeleteRefreshToken(config.DB, token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke refresh token"})
+		return false
+	}
+	return true
+}
+
 func LogoutHandler(c *gin.Context) {
+	// Deny-list the access token too, if the client sent it
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		if claims, err := utils.ValidateJWT(strings.TrimPrefix(authHeader, "Bearer ")); err == nil {
+			if err := services.RevokeAccessToken(config.DB, claims); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not logout"})
+				return
+			}
+		}
+	}
+
 	// Get refresh token from cookie
 	refreshToken, err := c.Cookie("refresh_token")
 	if err != nil {
@@ -181,7 +233,7 @@ func LogoutHandler(c *gin.Context) {
 	}
 
 	// Clear cookie
-	c.SetCookie("refresh_token", "", -1, "/", "", false, true)
+	clearRefreshCookie(c)
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "success",
@@ -208,7 +260,7 @@ func ForgotPasswordHandler(c *gin.Context) {
 
 	// Generate OTP for password reset
 	if _, err := services.GenerateOTP(user.ID, user.Email, "reset_password"); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate/send OTP"})
+		respondOTPSendError(c, err, "Failed to generate/send OTP")
 		return
 	}
 
@@ -223,7 +275,7 @@ func ResetPasswordHandler(c *gin.Context) {
 	var input struct {
 		Email       string `json:"email" binding:"required,email"`
 		OTP         string `json:"otp" binding:"required"`
-		NewPassword string `json:"new_password" binding:"required,min=6"`
+		NewPassword string `json:"new_password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -237,26 +289,36 @@ func ResetPasswordHandler(c *gin.Context) {
 		return
 	}
 
-	// Validate OTP
-	valid, err := services.ValidateOTP(user.ID, input.OTP, "reset_password")
+	// A password the policy rejects must not cost the user their code
+	if err := services.ValidatePasswordPolicy(input.NewPassword); err != nil {
+		respondPasswordError(c, err, "Failed to reset password")
+		return
+	}
+
+	// History is only checked once the code is proven, since it reveals
+	// whether a guess matches the current password; the code is burned
+	// only if the new password passes
+	valid, err := services.ValidateOTPBefore(user.ID, input.OTP, "reset_password", func() error {
+		return services.CheckPasswordHistory(config.DB, &user, input.NewPassword)
+	})
 	if err != nil || !valid {
+		if errors.Is(err, services.ErrPasswordReused) {
+			respondPasswordError(c, err, "Failed to reset password")
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Hash new password
-	hashedPassword, err := utils.HashPassword(input.NewPassword)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash new password"})
+	// Check policy and history, store the new password and cut off old access tokens
+	if err := services.ChangePassword(config.DB, &user, input.NewPassword); err != nil {
+		respondPasswordError(c, err, "Failed to reset password")
 		return
 	}
 
-	// Update password and updated_at
-	if err := config.DB.Model(&user).Updates(map[string]interface{}{
-		"password_hash": hashedPassword,
-		"updated_at":    time.Now(),
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+	// Whoever had the old password loses every session too
+	if err := utils.RevokeUserSessions(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke existing sessions"})
 		return
 	}
 
@@ -279,6 +341,12 @@ func VerifyOTPHandler(c *gin.Context) {
 		return
 	}
 
+	// Only signup and reset codes are checked here; the rest belong to their own flows
+	if !services.IsPublicOTPPurpose(input.Purpose) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OTP purpose"})
+		return
+	}
+
 	// Find user
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
@@ -342,6 +410,11 @@ func ResendOTPHandler(c *gin.Context) {
 		return
 	}
 
+	if !services.IsPublicOTPPurpose(input.Purpose) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OTP purpose"})
+		return
+	}
+
 	// Find user
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
@@ -355,9 +428,9 @@ func ResendOTPHandler(c *gin.Context) {
 		return
 	}
 
-	// Generate new OTP
+	// Generate new OTP (subject to the purpose's resend cooldown)
 	if _, err := services.GenerateOTP(user.ID, user.Email, input.Purpose); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate OTP"})
+		respondOTPSendError(c, err, "Could not generate OTP")
 		return
 	}
 
@@ -366,3 +439,144 @@ func ResendOTPHandler(c *gin.Context) {
 		"message": "OTP resent successfully. Please check your email.",
 	})
 }
+
+// setRefreshCookie stores the refresh token as an HTTP-only cookie
+func setRefreshCookie(c *gin.Context, refreshToken string, expiresAt time.Time) {
+	c.SetCookie(
+		"refresh_token",
+		refreshToken,
+		int(time.Until(expiresAt).Seconds()),
+		"/", // path
+		"",
+		false,
+		true,
+	)
+}
+
+// clearRefreshCookie removes the refresh token cookie
+func clearRefreshCookie(c *gin.Context) {
+	c.SetCookie("refresh_token", "", -1, "/", "", false, true)
+}
+
+// sessionInfo captures the client details recorded on a session
+func sessionInfo(c *gin.Context) utils.SessionInfo {
+	return utils.SessionInfo{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
+// respondOTPSendError maps OTP generation errors to HTTP responses
+func respondOTPSendError(c *gin.Context, err error, fallback string) {
+	var cooldown *services.OTPCooldownError
+	switch {
+	case errors.As(err, &cooldown):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(cooldown.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnknownOTPPurpose):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OTP purpose"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// completeLogin runs once the password (or another first factor) checked out.
+// Users with 2FA get a challenge token instead of tokens; users whose role
+// requires 2FA but who haven't set it up get a setup challenge.
+// method names the first factor in the login audit trail.
+func completeLogin(c *gin.Context, user models.User, method string) {
+	purpose := ""
+	status := ""
+	switch {
+	case services.IsTwoFactorEnabled(config.DB, user.ID):
+		purpose, status = utils.ChallengeTwoFactor, "2fa_required"
+	case services.RoleRequires2FA(config.DB, user.Role):
+		purpose, status = utils.ChallengeTwoFactorSetup, "2fa_setup_required"
+	default:
+		loginSucceeded(c, user, method, nil)
+		return
+	}
+
+	challengeToken, err := services.StartLoginChallenge(config.DB, user.ID, purpose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating challenge token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":          status,
+		"challenge_token": challengeToken,
+		"expires_in":      int(utils.ChallengeTokenTTL.Seconds()),
+	})
+}
+
+// loginSucceeded issues the session tokens and only then records the login,
+// so a first factor alone never resets the lockout streak or counts as a login
+func loginSucceeded(c *gin.Context, user models.User, method string, extra gin.H) {
+	if issueTokens(c, user, extra) {
+		services.RegisterSuccessfulLogin(config.DB, user, sessionInfo(c), method)
+	}
+}
+
+// issueTokens starts a new session: access token in the body, refresh token in a cookie.
+// Reports whether the tokens went out.
+func issueTokens(c *gin.Context, user models.User, extra gin.H) bool {
+	// Generate refresh token
+	refreshToken, hashedToken, err := utils.GenerateRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
+		return false
+	}
+
+	// Every login starts a new token family that later refreshes rotate within
+	familyID, err := utils.NewTokenFamily()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
+		return false
+	}
+
+	// Generate JWT access token, tied to the family so revoking the session cuts it off
+	accessToken, err := utils.GenerateJWT(user, familyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating access token"})
+		return false
+	}
+
+	// Save hashed refresh token in DB
+	expiresAt := time.Now().Add(utils.RefreshTokenTTL)
+	if err := utils.SaveRefreshToken(config.DB, user.ID, hashedToken, familyID, expiresAt, sessionInfo(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save refresh token"})
+		return false
+	}
+
+	// Set refresh token as HTTP-only cookie
+	setRefreshCookie(c, refreshToken, expiresAt)
+
+	resp := gin.H{
+		"status":       "success",
+		"userId":       user.ID,
+		"access_token": accessToken,
+	}
+	for k, v := range extra {
+		resp[k] = v
+	}
+
+	c.JSON(http.StatusOK, resp)
+	return true
+}
+
+// respondPasswordError maps password policy and history errors to HTTP responses
+func respondPasswordError(c *gin.Context, err error, fallback string) {
+	var policyErr *services.PasswordPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Password does not meet the requirements",
+			"details": policyErr.Problems,
+		})
+	case errors.Is(err, services.ErrPasswordReused), errors.Is(err, services.ErrCurrentPasswordWrong):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
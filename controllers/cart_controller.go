@@ -8,7 +8,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
-	// "gorm.io/gorm"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"gorm.io/gorm"
 )
 
 type CartItemResponse struct {
@@ -20,19 +21,30 @@ type CartItemResponse struct {
 }
 
 type ProductSummary struct {
-	ID            uint    `json:"id"`
-	Name          string  `json:"name"`
-	Description   string  `json:"description"`
-	Price         float64 `json:"price"`
-	StockQuantity int     `json:"stock_quantity"`
-	ImageURL      string  `json:"image_url"`
+	ID             uint              `json:"id"`
+	VariantID      uint              `json:"variant_id"`
+	SKU            string            `json:"sku"`
+	Name           string            `json:"name"`
+	Description    string            `json:"description"`
+	Options        map[string]string `json:"options"`
+	Price          float64           `json:"price"`            // what the customer pays now, sales included
+	CompareAtPrice *float64          `json:"compare_at_price"` // "was" price, if reduced
+	SaleEndsAt     *time.Time        `json:"sale_ends_at,omitempty"`
+	StockQuantity  int               `json:"stock_quantity"`
+	ImageURL       string            `json:"image_url"`
+}
+
+// Preloads mapCartItem needs
+func preloadCartItem(db *gorm.DB) *gorm.DB {
+	return db.Preload("Product").Preload("Variant." + models.VariantOptionsPreload)
 }
 
 func AddToCart(c *gin.Context) {
 	userID := getUserID(c) // helper to safely get userID
 
 	var input struct {
-		ProductID uint `json:"product_id" binding:"required"`
+		ProductID uint `json:"product_id" binding:"required_without=VariantID"`
+		VariantID uint `json:"variant_id"` // optional, the product's default variant otherwise
 		Quantity  int  `json:"quantity" binding:"required,min=1"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -40,22 +52,22 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	// 🔹 Check product exists and not soft-deleted
-	var product models.Product
-	if err := config.DB.First(&product, input.ProductID).Error; err != nil {
+	// 🔹 Check product and variant exist and are not soft-deleted
+	variant, err := services.ResolveVariant(config.DB, input.ProductID, input.VariantID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
 	// 🔹 Check stock availability
-	if input.Quantity > product.StockQuantity {
+	if input.Quantity > variant.StockQuantity {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Not enough stock available"})
 		return
 	}
 
 	// 🔹 Check if already in cart → STRICT separation (reject if exists)
 	var existingItem models.CartItem
-	if err := config.DB.Where("user_id = ? AND product_id = ?", userID, input.ProductID).First(&existingItem).Error; err == nil {
+	if err := config.DB.Where("user_id = ? AND variant_id = ?", userID, variant.ID).First(&existingItem).Error; err == nil {
 		// Already exists → reject, force client to use PUT
 		c.JSON(http.StatusConflict, gin.H{"error": "Product already in cart. Use PUT /cart/:id to update quantity."})
 		return
@@ -64,7 +76,8 @@ func AddToCart(c *gin.Context) {
 	// 🔹 Create new cart item
 	cartItem := models.CartItem{
 		UserID:    userID,
-		ProductID: input.ProductID,
+		ProductID: variant.ProductID,
+		VariantID: variant.ID,
 		Quantity:  input.Quantity,
 	}
 	if err := config.DB.Create(&cartItem).Error; err != nil {
@@ -73,14 +86,20 @@ func AddToCart(c *gin.Context) {
 	}
 
 	// 🔹 Preload product info for response
-	if err := config.DB.Preload("Product").First(&cartItem, cartItem.ID).Error; err != nil {
+	if err := preloadCartItem(config.DB).First(&cartItem, cartItem.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart item"})
+		return
+	}
+
+	resp, err := mapCartItems([]models.CartItem{cartItem})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart item"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message":   "Product added to cart",
-		"cart_item": mapCartItem(cartItem),
+		"cart_item": resp[0],
 	})
 }
 
@@ -88,11 +107,12 @@ func GetCartItems(c *gin.Context) {
 	userID := getUserID(c)
 
 	var cartItems []models.CartItem
-	config.DB.Preload("Product").Where("user_id = ?", userID).Find(&cartItems)
+	preloadCartItem(config.DB).Where("user_id = ?", userID).Find(&cartItems)
 
-	var resp []CartItemResponse
-	for _, item := range cartItems {
-		resp = append(resp, mapCartItem(item))
+	resp, err := mapCartItems(cartItems)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart"})
+		return
 	}
 
 	c.JSON(200, gin.H{"cart_items": resp})
@@ -111,12 +131,12 @@ func UpdateCartItem(c *gin.Context) {
 	}
 
 	var cartItem models.CartItem
-	if err := config.DB.Preload("Product").Where("id = ? AND user_id = ?", cartID, userID).First(&cartItem).Error; err != nil {
+	if err := preloadCartItem(config.DB).Where("id = ? AND user_id = ?", cartID, userID).First(&cartItem).Error; err != nil {
 		c.JSON(404, gin.H{"error": "Cart item not found"})
 		return
 	}
 
-	if input.Quantity > cartItem.Product.StockQuantity {
+	if input.Quantity > cartItem.Variant.StockQuantity {
 		c.JSON(400, gin.H{"error": "Not enough stock available"})
 		return
 	}
@@ -124,7 +144,13 @@ func UpdateCartItem(c *gin.Context) {
 	cartItem.Quantity = input.Quantity
 	config.DB.Save(&cartItem)
 
-	c.JSON(200, gin.H{"message": "Cart updated", "cart_item": mapCartItem(cartItem)})
+	resp, err := mapCartItems([]models.CartItem{cartItem})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch cart item"})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Cart updated", "cart_item": resp[0]})
 }
 
 func DeleteCartItem(c *gin.Context) {
@@ -159,16 +185,39 @@ func getUserID(c *gin.Context) uint {
 	}
 }
 
+// mapCartItems prices the items as of now and shapes them for the response
+func mapCartItems(items []models.CartItem) ([]CartItemResponse, error) {
+	if err := services.PriceCartItems(config.DB, items, time.Now()); err != nil {
+		return nil, err
+	}
+
+	var resp []CartItemResponse
+	for _, item := range items {
+		resp = append(resp, mapCartItem(item))
+	}
+	return resp, nil
+}
+
 func mapCartItem(item models.CartItem) CartItemResponse {
+	imageURL := item.Variant.ImageURL
+	if imageURL == "" {
+		imageURL = item.Product.ImageURL
+	}
+
 	return CartItemResponse{
 		ID: item.ID,
 		Product: ProductSummary{
-			ID:            item.Product.ID,
-			Name:          item.Product.Name,
-			Description:   item.Product.Description,
-			Price:         item.Product.Price,
-			StockQuantity: item.Product.StockQuantity,
-			ImageURL:      item.Product.ImageURL,
+			ID:             item.Product.ID,
+			VariantID:      item.Variant.ID,
+			SKU:            item.Variant.SKU,
+			Name:           item.Product.Name,
+			Description:    item.Product.Description,
+			Options:        item.Variant.Options(),
+			Price:          item.Variant.EffectivePrice,
+			CompareAtPrice: services.CompareAtFor(item.Variant),
+			SaleEndsAt:     item.Variant.SaleEndsAt,
+			StockQuantity:  item.Variant.StockQuantity,
+			ImageURL:       imageURL,
 		},
 		Quantity:  item.Quantity,
 		CreatedAt: item.CreatedAt,
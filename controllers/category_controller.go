@@ -0,0 +1,163 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// GET /categories - the category tree (public)
+func GetCategoryTreeHandler(c *gin.Context) {
+	tree, err := services.CategoryTree(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": tree})
+}
+
+// GET /categories/:ref - one category by ID or slug (public)
+func GetCategoryHandler(c *gin.Context) {
+	category, err := services.FindCategory(config.DB, c.Param("ref"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"category": category})
+}
+
+// categoryInput is the JSON body for creating and editing categories
+type categoryInput struct {
+	Name        *string         `json:"name" binding:"omitempty,min=1,max=100"`
+	Slug        *string         `json:"slug" binding:"omitempty,max=120"`
+	Description *string         `json:"description"`
+	ImageURL    *string         `json:"image_url"`
+	Position    *int            `json:"position"`
+	ParentID    json.RawMessage `json:"parent_id"` // an ID, or null to move to the root
+}
+
+func (in categoryInput) toService() (services.CategoryInput, error) {
+	out := services.CategoryInput{
+		Name:        in.Name,
+		Slug:        in.Slug,
+		Description: in.Description,
+		ImageURL:    in.ImageURL,
+		Position:    in.Position,
+	}
+
+	switch string(in.ParentID) {
+	case "":
+	case "null":
+		out.ClearParent = true
+	default:
+		var id uint
+		if err := json.Unmarshal(in.ParentID, &id); err != nil {
+			return out, errors.New("parent_id must be a category id or null")
+		}
+		out.ParentID = &id
+	}
+	return out, nil
+}
+
+// POST /admin/categories - create a category
+func CreateCategoryHandler(c *gin.Context) {
+	var input categoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+
+	in, err := input.toService()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := services.CreateCategory(config.DB, in)
+	if err != nil {
+		respondCategoryError(c, err, "Failed to create category")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":   "success",
+		"category": category,
+	})
+}
+
+// PUT /admin/categories/:id - edit, rename, reorder or move a category
+func UpdateCategoryHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+
+	var input categoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	in, err := input.toService()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := services.UpdateCategory(config.DB, uint(id), in)
+	if err != nil {
+		respondCategoryError(c, err, "Failed to update category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"category": category,
+	})
+}
+
+// DELETE /admin/categories/:id - delete a category with no subcategories or products
+func DeleteCategoryHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid category id"})
+		return
+	}
+
+	if err := services.DeleteCategory(config.DB, uint(id)); err != nil {
+		respondCategoryError(c, err, "Failed to delete category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Category deleted",
+	})
+}
+
+// respondCategoryError maps category errors to HTTP responses
+func respondCategoryError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCategoryExists), errors.Is(err, services.ErrSlugTaken),
+		errors.Is(err, services.ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCategoryCycle), errors.Is(err, services.ErrInvalidSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+// POST /user/email - request a change of email; an OTP goes to the new address
+func RequestEmailChangeHandler(c *gin.Context) {
+	var input struct {
+		NewEmail        string `json:"new_email" binding:"required,email"`
+		CurrentPassword string `json:"current_password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, getUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !utils.CheckPasswordHash(input.CurrentPassword, user.PasswordHash) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrCurrentPasswordWrong.Error()})
+		return
+	}
+
+	if err := services.RequestEmailChange(config.DB, user, input.NewEmail); err != nil {
+		if !respondEmailChangeError(c, err) {
+			respondOTPSendError(c, err, "Failed to send verification code")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "A verification code has been sent to your new email address.",
+	})
+}
+
+// POST /user/email/confirm - confirm the new email with the OTP; tokens are re-issued
+func ConfirmEmailChangeHandler(c *gin.Context) {
+	var input struct {
+		OTP string `json:"otp" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := services.ConfirmEmailChange(config.DB, getUserID(c), input.OTP)
+	if err != nil {
+		if !respondEmailChangeError(c, err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Every old session was revoked, so this one starts fresh
+	issueTokens(c, user, gin.H{
+		"message": "Email updated successfully",
+		"email":   user.Email,
+	})
+}
+
+// POST /auth/email/revert - undo an email change from the link sent to the old address
+func RevertEmailChangeHandler(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req, err := services.RevertEmailChange(config.DB, input.Token)
+	if err != nil {
+		if !respondEmailChangeError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revert email change"})
+		}
+		return
+	}
+
+	clearRefreshCookie(c)
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Your email has been restored and all sessions were signed out. Please reset your password.",
+		"email":   req.OldEmail,
+	})
+}
+
+// respondEmailChangeError writes a response for known email change errors
+// and reports whether it did
+func respondEmailChangeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSameEmail),
+		errors.Is(err, services.ErrNoPendingEmailChange),
+		errors.Is(err, services.ErrInvalidRevertToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
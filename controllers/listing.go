@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+// respondListError maps list paging/filter errors to HTTP responses
+func respondListError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, utils.ErrInvalidListParams) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// POST /auth/magic-link - email a passwordless sign-in link
+func RequestMagicLinkHandler(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Same answer whether or not the account exists, so emails can't be probed
+	response := gin.H{
+		"status":  "success",
+		"message": "If an account exists for this email, a sign-in link has been sent.",
+	}
+
+	var user models.User
+	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil || user.IsBlocked {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Cooldowns and send failures get the same reply too; a 429 or 500 only
+	// for known emails would reveal that the account exists
+	var cooldown *services.OTPCooldownError
+	if err := services.SendMagicLink(user); err != nil && !errors.As(err, &cooldown) {
+		log.Printf("❌ Could not send sign-in link to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST /auth/magic-link/consume - log in with the token from a sign-in link
+func ConsumeMagicLinkHandler(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := services.ConsumeMagicLink(input.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.IsBlocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked. Please contact support."})
+		return
+	}
+
+	// Opening the link proves the user owns the email
+	if !user.IsVerified {
+		if err := config.DB.Model(&user).Update("is_verified", true).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify user"})
+			return
+		}
+	}
+
+	completeLogin(c, user, "magic_link")
+}
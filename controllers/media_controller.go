@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+// Room for the multipart framing around the files themselves
+const multipartOverhead = 1 << 20
+
+// POST /admin/products/:id/images - upload one or more gallery images (multipart field "images")
+func UploadProductImagesHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	// A gallery upload can't be bigger than a full gallery of maximum-size files
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxGalleryImages*services.MaxUploadBytes()+multipartOverhead)
+	form, err := c.MultipartForm()
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	files := form.File["images"]
+	if len(files) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no files in the images field"})
+		return
+	}
+	altText := c.PostForm("alt_text")
+
+	images := make([]models.ProductImage, 0, len(files))
+	for _, header := range files {
+		if header.Size > services.MaxUploadBytes() {
+			respondMediaError(c, fmt.Errorf("%s: %w", header.Filename, services.ErrImageTooLarge), "Failed to upload image")
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			respondMediaError(c, err, "Failed to read upload")
+			return
+		}
+		image, err := services.AddProductImage(c.Request.Context(), config.DB, uint(productID), file, altText)
+		file.Close()
+		if err != nil {
+			respondMediaError(c, fmt.Errorf("%s: %w", header.Filename, err), "Failed to upload image")
+			return
+		}
+		images = append(images, image)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"images": images,
+	})
+}
+
+// GET /products/:id/images - a product's gallery in display order
+func GetProductImagesHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	images, err := services.ProductImages(config.DB, uint(productID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch images"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"images": images})
+}
+
+// PUT /admin/products/:id/images/order - rearrange the gallery; the first image becomes the main one
+func ReorderProductImagesHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var input struct {
+		ImageIDs []uint `json:"image_ids" binding:"required,min=1"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	images, err := services.ReorderProductImages(config.DB, uint(productID), input.ImageIDs)
+	if err != nil {
+		respondMediaError(c, err, "Failed to reorder images")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"images": images,
+	})
+}
+
+// DELETE /admin/products/:id/images/:image_id - remove an image from the gallery
+func DeleteProductImageHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	imageID, err := strconv.Atoi(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image id"})
+		return
+	}
+
+	if err := services.DeleteProductImage(c.Request.Context(), config.DB, uint(productID), uint(imageID)); err != nil {
+		respondMediaError(c, err, "Failed to delete image")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Image deleted",
+	})
+}
+
+// POST /user/avatar - upload a profile picture (multipart field "avatar")
+func UploadAvatarHandler(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxUploadBytes()+multipartOverhead)
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if header.Size > services.MaxUploadBytes() {
+		respondMediaError(c, services.ErrImageTooLarge, "Failed to upload avatar")
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		respondMediaError(c, err, "Failed to read upload")
+		return
+	}
+	defer file.Close()
+
+	url, err := services.SetAvatar(c.Request.Context(), config.DB, getUserID(c), file)
+	if err != nil {
+		respondMediaError(c, err, "Failed to upload avatar")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     "success",
+		"avatar_url": url,
+	})
+}
+
+// DELETE /user/avatar - remove the profile picture
+func DeleteAvatarHandler(c *gin.Context) {
+	if err := services.RemoveAvatar(c.Request.Context(), config.DB, getUserID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove avatar"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Avatar removed",
+	})
+}
+
+// GET /media/*key - serve an uploaded file from storage
+func ServeMediaHandler(c *gin.Context) {
+	key, err := services.CleanObjectKey(c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// Keys get a fresh random name on every upload, so a file never changes
+	cacheControl := "public, max-age=31536000, immutable"
+	if strings.HasPrefix(key, services.ReviewMediaPrefix) {
+		// Review photos wait for moderation; before that only a signed link opens them
+		public, err := services.ReviewMediaPublic(config.DB, key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+			return
+		}
+		if !public && !utils.ValidateMediaToken(c.Query("token"), key) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		// Short-lived, so unpublishing a review takes effect
+		cacheControl = "private, max-age=300"
+	}
+
+	body, contentType, err := services.FileStorage().Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrObjectNotFound) || errors.Is(err, services.ErrInvalidObjectKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		log.Printf("⚠️ Could not read media %s: %v", c.Param("key"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer body.Close()
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.Header("Cache-Control", cacheControl)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, body)
+}
+
+func respondMediaError(c *gin.Context, err error, fallback string) {
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooBig), errors.Is(err, services.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":     services.ErrImageTooLarge.Error(),
+			"max_bytes": services.MaxUploadBytes(),
+		})
+	case errors.Is(err, services.ErrUnsupportedImage):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImageTooManyPixels), errors.Is(err, services.ErrImageOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrImageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrGalleryFull):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// respondUploadError answers a multipart body that couldn't be parsed
+func respondUploadError(c *gin.Context, err error) {
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) {
+		respondMediaError(c, err, "")
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart/form-data upload: " + err.Error()})
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthLinkCookie  = "oauth_link" // binds a link URL to the browser that asked for it
+)
+
+// GET /auth/oauth/:provider/login - redirect the browser to the provider
+func OAuthLoginHandler(c *gin.Context) {
+	provider, err := services.GetOAuthProvider(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownOAuthProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+			return
+		}
+		log.Printf("❌ oauth provider %s: %v", c.Param("provider"), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login provider unavailable"})
+		return
+	}
+
+	state, err := utils.NewOAuthState(provider.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login"})
+		return
+	}
+
+	// ?link= comes from POST /user/oauth/:provider/link, so the identity is
+	// attached to that signed-in user instead of logging in. Only the browser
+	// that made that request has the matching cookie.
+	if link := c.Query("link"); link != "" {
+		nonce, _ := c.Cookie(oauthLinkCookie)
+		c.SetCookie(oauthLinkCookie, "", -1, "/auth/oauth", "", false, true)
+		state.LinkUserID, err = services.ConsumeOAuthLink(link, provider.Name, nonce)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Link request is invalid or expired, please try again"})
+			return
+		}
+	}
+
+	signed, err := state.Sign()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start login"})
+		return
+	}
+
+	// Lax so the cookie survives the top-level redirect back from the provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, signed, int(utils.OAuthStateTTL.Seconds()), "/auth/oauth", "", false, true)
+
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state))
+}
+
+// GET /auth/oauth/:provider/callback - finish the login or link, then send the
+// browser back to the storefront with a one-time code or an error
+func OAuthCallbackHandler(c *gin.Context) {
+	providerName := c.Param("provider")
+
+	if errParam := c.Query("error"); errParam != "" {
+		oauthRedirect(c, "error", "access_denied")
+		return
+	}
+
+	cookie, err := c.Cookie(oauthStateCookie)
+	if err != nil {
+		oauthRedirect(c, "error", "session_expired")
+		return
+	}
+	// The state is single use
+	c.SetCookie(oauthStateCookie, "", -1, "/auth/oauth", "", false, true)
+
+	state, err := utils.ParseOAuthState(cookie)
+	if err != nil || state.Provider != providerName || state.State != c.Query("state") {
+		oauthRedirect(c, "error", "invalid_state")
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		oauthRedirect(c, "error", "invalid_request")
+		return
+	}
+
+	provider, err := services.GetOAuthProvider(c.Request.Context(), providerName)
+	if err != nil {
+		oauthRedirect(c, "error", "unknown_provider")
+		return
+	}
+
+	ident, err := provider.Exchange(c.Request.Context(), code, state)
+	if err != nil {
+		log.Printf("❌ oauth exchange with %s failed: %v", providerName, err)
+		oauthRedirect(c, "error", "provider_error")
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		if err := services.LinkIdentityToUser(config.DB, state.LinkUserID, ident); err != nil {
+			oauthRedirect(c, "error", oauthErrorCode(err))
+			return
+		}
+		oauthRedirect(c, "linked", providerName)
+		return
+	}
+
+	user, err := services.LinkExternalIdentity(config.DB, ident)
+	if err != nil {
+		oauthRedirect(c, "error", oauthErrorCode(err))
+		return
+	}
+
+	if user.IsBlocked {
+		oauthRedirect(c, "error", "account_blocked")
+		return
+	}
+
+	loginCode, err := services.IssueOAuthLoginCode(user, providerName)
+	if err != nil {
+		log.Printf("❌ oauth login code for user %d: %v", user.ID, err)
+		oauthRedirect(c, "error", "server_error")
+		return
+	}
+
+	oauthRedirect(c, "code", loginCode)
+}
+
+// POST /auth/oauth/exchange - trade the one-time code from the callback redirect for a session
+func OAuthExchangeHandler(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, providerName, err := services.ConsumeOAuthLoginCode(input.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.IsBlocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked. Please contact support."})
+		return
+	}
+
+	completeLogin(c, user, "oauth:"+providerName)
+}
+
+// POST /user/oauth/:provider/link - start linking a provider to the signed-in account.
+// The same browser then opens the returned URL (the request must send credentials
+// so the link cookie is stored), which continues at the provider.
+func StartOAuthLinkHandler(c *gin.Context) {
+	provider, err := services.GetOAuthProvider(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownOAuthProvider) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown login provider"})
+			return
+		}
+		log.Printf("❌ oauth provider %s: %v", c.Param("provider"), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Login provider unavailable"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, getUserID(c)).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	token, nonce, err := services.StartOAuthLink(user, provider.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start linking"})
+		return
+	}
+
+	// Lax so the cookie comes along when the browser opens the returned URL
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthLinkCookie, nonce, int(utils.OAuthStateTTL.Seconds()), "/auth/oauth", "", false, true)
+
+	c.JSON(http.StatusOK, gin.H{
+		"url": "/auth/oauth/" + provider.Name + "/login?link=" + url.QueryEscape(token),
+	})
+}
+
+// oauthRedirect sends the browser back to the storefront with one query parameter
+func oauthRedirect(c *gin.Context, key, value string) {
+	params := url.Values{}
+	params.Set(key, value)
+	c.Redirect(http.StatusFound, services.OAuthFrontendURL()+"?"+params.Encode())
+}
+
+// oauthErrorCode maps a linking error to the code the storefront shows a message for
+func oauthErrorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrOAuthEmailUnverified):
+		return "email_unverified"
+	case errors.Is(err, services.ErrOAuthEmailTaken):
+		return "email_taken"
+	case errors.Is(err, services.ErrOAuthIdentityLinked):
+		return "identity_linked"
+	default:
+		log.Printf("❌ oauth sign-in failed: %v", err)
+		return "server_error"
+	}
+}
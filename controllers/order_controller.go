@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
 )
 
 type PlaceOrderRequest struct {
@@ -64,16 +65,33 @@ func GetUserOrders(c *gin.Context) {
 	c.JSON(http.StatusOK, orders)
 }
 
-// GET /admin/orders - Admin view all orders
+// GET /admin/orders - Admin view orders
+// ?status=&user_id=&created_from=&created_to= plus the usual paging and ?sort=
 func GetAllOrders(c *gin.Context) {
-	status := c.Query("status") // optional
-	orders, err := services.GetAllOrders(config.DB, status)
+	params, err := utils.ParseListParams(c.Request.URL.Query(), services.OrderListSorts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	f := utils.NewListFilters(c.Request.URL.Query())
+	filters := services.OrderFilters{
+		Status: f.String("status"),
+		UserID: f.Uint("user_id"),
+	}
+	filters.CreatedFrom, filters.CreatedTo = f.TimeRange("created_from", "created_to")
+	if err := f.Err(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, pageInfo, err := services.GetAllOrders(config.DB, filters, params)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch orders")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": orders, "page_info": pageInfo})
 }
 
 // PUT /admin/order/:id - Admin updates order status
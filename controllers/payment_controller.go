@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -158,9 +160,9 @@ func UpdatePaymentStatus(c *gin.Context) {
 	switch body.Status {
 	case "succeeded":
 		for _, item := range payment.Order.OrderItems {
-			if item.Product.StockQuantity >= item.Quantity {
-				item.Product.StockQuantity -= item.Quantity
-				config.DB.Save(&item.Product)
+			// Leaves stock alone when there isn't enough left
+			if err := services.AdjustVariantStock(config.DB, item.VariantID, -item.Quantity); err != nil && !errors.Is(err, services.ErrInsufficientStock) {
+				log.Printf("❌ Could not update stock for variant %d: %v", item.VariantID, err)
 			}
 		}
 		// Clear user's cart
@@ -178,6 +180,8 @@ func UpdatePaymentStatus(c *gin.Context) {
 	for _, item := range payment.Order.OrderItems {
 		orderItemsResp = append(orderItemsResp, services.OrderItemResponse{
 			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			SKU:       item.SKU,
 			Name:      item.Product.Name,
 			Quantity:  item.Quantity,
 			Price:     item.Price,
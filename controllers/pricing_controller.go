@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+var priceHistoryListSorts = utils.ListSpec{
+	SortFields:  map[string]string{"created_at": "created_at", "id": "id"},
+	DefaultSort: "-created_at",
+}
+
+// POST /admin/products/:id/sales - schedule a sale price or percentage off
+// for the whole product or one variant (variant_id)
+func CreateSaleHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var input struct {
+		VariantID  *uint      `json:"variant_id"`
+		SalePrice  *float64   `json:"sale_price"`
+		PercentOff *float64   `json:"percent_off"`
+		StartsAt   *time.Time `json:"starts_at"` // defaults to now
+		EndsAt     *time.Time `json:"ends_at"`   // open-ended until cancelled
+		Note       string     `json:"note" binding:"max=255"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sale, err := services.CreateSale(config.DB, uint(productID), services.SaleInput{
+		VariantID:  input.VariantID,
+		SalePrice:  input.SalePrice,
+		PercentOff: input.PercentOff,
+		StartsAt:   input.StartsAt,
+		EndsAt:     input.EndsAt,
+		Note:       input.Note,
+		CreatedBy:  priceAuthor(c).UserID,
+	})
+	if err != nil {
+		respondPricingError(c, err, "Failed to create sale")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"sale":   sale,
+	})
+}
+
+// GET /admin/products/:id/sales - a product's sales (?active=true for running and upcoming only)
+func GetSalesHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	activeOnly, err := strconv.ParseBool(c.DefaultQuery("active", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "active must be true or false"})
+		return
+	}
+
+	sales, err := services.ProductSales(config.DB, uint(productID), activeOnly)
+	if err != nil {
+		respondPricingError(c, err, "Failed to fetch sales")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sales": sales})
+}
+
+// DELETE /admin/products/:id/sales/:sale_id - end a running or upcoming sale now
+func CancelSaleHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	saleID, err := strconv.Atoi(c.Param("sale_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sale id"})
+		return
+	}
+
+	sale, err := services.CancelSale(config.DB, uint(productID), uint(saleID), priceAuthor(c).UserID)
+	if err != nil {
+		respondPricingError(c, err, "Failed to cancel sale")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"sale":   sale,
+	})
+}
+
+// GET /admin/products/:id/price-history - every price change of a product's
+// variants (?variant_id=, ?field=price|compare_at_price, ?from=&to=)
+func GetPriceHistoryHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	params, err := utils.ParseListParams(c.Request.URL.Query(), priceHistoryListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch price history")
+		return
+	}
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	variantID := f.Uint("variant_id")
+	field := f.String("field")
+	from, to := f.TimeRange("from", "to")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch price history")
+		return
+	}
+
+	query := config.DB.Where("product_id = ?", productID)
+	if variantID != nil {
+		query = query.Where("variant_id = ?", *variantID)
+	}
+	if field != "" {
+		query = query.Where("field = ?", field)
+	}
+	query = utils.WhereRange(query, "created_at", from, to)
+
+	var history []models.PriceHistory
+	pageInfo, err := utils.Paginate(query, params, &history)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch price history")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      history,
+		"page_info": pageInfo,
+	})
+}
+
+// GET /admin/products/:id/variants/:variant_id/price - what a variant cost at
+// a given moment (?at=, RFC 3339, defaults to now)
+func GetVariantPriceHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant id"})
+		return
+	}
+
+	at := time.Now()
+	if v := c.Query("at"); v != "" {
+		if at, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	price, err := services.PriceAt(config.DB, uint(productID), uint(variantID), at)
+	if err != nil {
+		respondPricingError(c, err, "Failed to work out the price")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"price": price})
+}
+
+// priceAuthor credits the signed-in admin with a price change
+func priceAuthor(c *gin.Context) services.PriceAuthor {
+	by := services.PriceAuthor{Source: services.PriceSourceAdmin}
+	if userID := getUserID(c); userID != 0 {
+		by.UserID = &userID
+	}
+	return by
+}
+
+func respondPricingError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrVariantNotFound),
+		errors.Is(err, services.ErrSaleNotFound), errors.Is(err, services.ErrNoPriceRecord):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidSale), errors.Is(err, services.ErrSaleWindow):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSaleNotActive):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
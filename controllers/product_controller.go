@@ -1,13 +1,19 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
 )
 
 // CreateProductHandler handles POST /admin/products
@@ -21,8 +27,12 @@ func CreateProductHandler(c *gin.Context) {
 		return
 	}
 
-	// Save to DB
-	if err := config.DB.Create(&input).Error; err != nil {
+	// Save to DB, with a default variant holding price and stock
+	if err := services.CreateProduct(config.DB, &input, priceAuthor(c)); err != nil {
+		if errors.Is(err, services.ErrCategoryNotFound) || errors.Is(err, services.ErrInvalidAttribute) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
 		return
 	}
@@ -33,26 +43,193 @@ func CreateProductHandler(c *gin.Context) {
 	})
 }
 
-// GetProductsHandler handles GET /products (public)
+// GetProductsHandler handles GET /products (public). ?category= takes an ID, slug or name and includes subcategories;
+// attr.<code>=a,b and attr.<code>.min/.max filter on attributes.
 func GetProductsHandler(c *gin.Context) {
+	params, err := utils.ParseListParams(c.Request.URL.Query(), productListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch products")
+		return
+	}
+
+	filters, ok := parseProductFilters(c, "Failed to fetch products")
+	if !ok {
+		return
+	}
+	query := services.ApplyAttributeFilters(filters.query, filters.attributes, "")
+
 	var products []models.Product
+	pageInfo, err := utils.Paginate(query, params, &products)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch products")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": products, "page_info": pageInfo})
+}
+
+// GetProductFacetsHandler handles GET /products/facets (public): attribute
+// value counts for the products GET /products would list with the same filters
+func GetProductFacetsHandler(c *gin.Context) {
+	filters, ok := parseProductFilters(c, "Failed to fetch facets")
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := services.ApplyAttributeFilters(filters.query.Session(&gorm.Session{}), filters.attributes, "").
+		Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch facets"})
+		return
+	}
+
+	facets, err := services.ProductFacets(config.DB, filters.query, filters.categoryID, filters.attributes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch facets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "facets": facets})
+}
+
+// productFilters are the filters GET /products and GET /products/facets share
+type productFilters struct {
+	query      *gorm.DB // every filter but the attribute ones applied
+	categoryID *uint
+	attributes []services.AttributeFilter
+}
+
+// categoryParam reads ?category=, where "All" means no filter as it always has for the storefront
+func categoryParam(value string) string {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(value, "all") {
+		return ""
+	}
+	return value
+}
+
+// parseProductFilters reads the listing filters, responding itself when one is invalid
+func parseProductFilters(c *gin.Context, fallback string) (productFilters, bool) {
+	var out productFilters
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	category := categoryParam(f.String("category"))
+	priceMin, priceMax := f.Float("price_min"), f.Float("price_max")
+	inStock := f.Bool("in_stock")
+	ratingMin := f.Float("rating_min")
+	createdFrom, createdTo := f.TimeRange("created_from", "created_to")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, fallback)
+		return out, false
+	}
+
+	attributes, err := services.ParseAttributeFilters(config.DB, c.Request.URL.Query())
+	if err != nil {
+		respondListError(c, err, fallback)
+		return out, false
+	}
+	out.attributes = attributes
+
+	query := config.DB.Model(&models.Product{})
+
+	if category != "" {
+		resolved, err := services.ResolveCategory(config.DB, category)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return out, false
+		}
+		categoryIDs, err := services.CategoryWithDescendants(config.DB, resolved.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+			return out, false
+		}
+		query = query.Where("category_id IN ?", categoryIDs)
+		out.categoryID = &resolved.ID
+	}
+	if priceMin != nil {
+		query = query.Where("price >= ?", *priceMin)
+	}
+	if priceMax != nil {
+		query = query.Where("price <= ?", *priceMax)
+	}
+	if inStock != nil {
+		if *inStock {
+			query = query.Where("stock_quantity > 0")
+		} else {
+			query = query.Where("stock_quantity <= 0")
+		}
+	}
+	if ratingMin != nil {
+		query = query.Where("rating_average >= ?", *ratingMin)
+	}
+	query = utils.WhereRange(query, "created_at", createdFrom, createdTo)
+
+	out.query = query
+	return out, true
+}
+
+// Fields GET /products can be sorted by
+var productListSorts = utils.ListSpec{
+	SortFields: map[string]string{
+		"created_at": "created_at",
+		"price":      "price",
+		"name":       "name",
+		"stock":      "stock_quantity",
+		"rating":     "rating_average",
+		"reviews":    "review_count",
+		"id":         "id",
+	},
+	DefaultSort: "-created_at",
+}
 
-	// read query parameter
-	category := c.Query("category")
+// SearchProductsHandler handles GET /products/search?q=&category=&limit=&offset= (public)
+func SearchProductsHandler(c *gin.Context) {
+	q := c.Query("q")
+	if strings.TrimSpace(q) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
 
-	query := config.DB
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
 
-	if category != "" && category != "All" {
-		query = query.Where("category = ?", category)
+	params := services.ProductSearchParams{
+		Query:  q,
+		Limit:  limit,
+		Offset: offset,
+	}
+	if category := categoryParam(c.Query("category")); category != "" {
+		categoryIDs, err := services.CategoryFilter(config.DB, category)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		params.CategoryIDs = categoryIDs
 	}
 
-	if err := query.Find(&products).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
+	results, total, err := services.SearchProducts(config.DB, params)
+	if err != nil {
+		if errors.Is(err, services.ErrEmptySearchQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search products"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"products": products,
+		"query":    q,
+		"total":    total,
+		"products": results,
 	})
 }
 
@@ -61,11 +238,22 @@ func GetProductByIDHandler(c *gin.Context) {
 	var product models.Product
 	id := c.Param("id")
 
-	if err := config.DB.First(&product, id).Error; err != nil {
+	if err := config.DB.
+		Preload("OptionTypes", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("OptionTypes.Values", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Variants.OptionValues").
+		Preload("Images", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		First(&product, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
+	if err := services.ApplyPricing(config.DB, product.Variants, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"product": product,
 	})
@@ -84,12 +272,15 @@ func UpdateProductHandler(c *gin.Context) {
 
 	// Bind JSON input
 	var input struct {
-		Name          *string  `json:"name"`
-		Description   *string  `json:"description"`
-		Price         *float64 `json:"price"`
-		StockQuantity *int     `json:"stock_quantity"`
-		Category      *string  `json:"category"`
-		ImageURL      *string  `json:"image_url"`
+		Name           *string                `json:"name"`
+		Description    *string                `json:"description"`
+		Price          *float64               `json:"price"`
+		CompareAtPrice *float64               `json:"compare_at_price"` // 0 removes it
+		StockQuantity  *int                   `json:"stock_quantity"`
+		CategoryID     *uint                  `json:"category_id"`
+		Category       *string                `json:"category"` // existing category name, category_id is preferred
+		ImageURL       *string                `json:"image_url"`
+		Attributes     map[string]interface{} `json:"attributes"` // merged into the current ones, null removes one
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -98,6 +289,7 @@ func UpdateProductHandler(c *gin.Context) {
 	}
 
 	updates := map[string]interface{}{}
+	categoryID := product.CategoryID
 
 	if input.Name != nil {
 		updates["name"] = *input.Name
@@ -105,32 +297,63 @@ func UpdateProductHandler(c *gin.Context) {
 	if input.Description != nil {
 		updates["description"] = *input.Description
 	}
-	if input.Price != nil {
-		updates["price"] = *input.Price
-	}
-	if input.StockQuantity != nil {
-		updates["stock_quantity"] = *input.StockQuantity
-	}
-	if input.Category != nil {
-		updates["category"] = *input.Category
+	if input.CategoryID != nil || input.Category != nil {
+		target := models.Product{CategoryID: input.CategoryID}
+		if input.Category != nil {
+			target.Category = *input.Category
+		}
+		if err := services.AssignProductCategory(config.DB, &target); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["category_id"] = target.CategoryID
+		updates["category"] = target.Category
+		categoryID = target.CategoryID
 	}
 	if input.ImageURL != nil {
 		updates["image_url"] = *input.ImageURL
 	}
 
 	// Nothing to update
-	if len(updates) == 0 {
+	categoryChanged := input.CategoryID != nil || input.Category != nil
+	priceOrStock := input.Price != nil || input.CompareAtPrice != nil || input.StockQuantity != nil
+	if len(updates) == 0 && !priceOrStock && input.Attributes == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
 		return
 	}
 
-	// Update timestamp
-	updates["updated_at"] = time.Now()
+	// All or nothing, so attributes are never saved for a category change that failed
+	respond := respondVariantError
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Attributes must fit the category, the new one if it is changing
+		if input.Attributes != nil || categoryChanged {
+			if err := services.UpdateProductAttributes(tx, &product, categoryID, input.Attributes); err != nil {
+				respond = respondAttributeError
+				return err
+			}
+		}
+
+		updates["updated_at"] = time.Now()
+		if err := tx.Model(&product).Updates(updates).Error; err != nil {
+			return err
+		}
 
-	if err := config.DB.Model(&product).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
+		// Price and stock live on the variants
+		if !priceOrStock {
+			return nil
+		}
+		return services.SetProductPriceStock(tx, product.ID, services.VariantUpdate{
+			Price:          input.Price,
+			CompareAtPrice: input.CompareAtPrice,
+			StockQuantity:  input.StockQuantity,
+			By:             priceAuthor(c),
+		})
+	})
+	if err != nil {
+		respond(c, err, "Failed to update product")
 		return
 	}
+	config.DB.First(&product, product.ID) // price and stock may have changed through the variant
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Product updated successfully",
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+var importJobListSorts = utils.ListSpec{
+	SortFields:  map[string]string{"created_at": "created_at", "id": "id"},
+	DefaultSort: "-created_at",
+}
+
+// POST /admin/products/import - upsert products by SKU from a CSV or XLSX file
+// (multipart field "file"). ?dry_run=true only validates; ?async=true always
+// queues the file as a background job.
+func ImportProductsHandler(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+	background, err := strconv.ParseBool(c.DefaultQuery("async", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "async must be true or false"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxImportBytes()+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file is too large", "max_bytes": services.MaxImportBytes()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "upload the spreadsheet as multipart field \"file\""})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read upload"})
+		return
+	}
+
+	opts := services.ImportOptions{Filename: header.Filename, DryRun: dryRun, Background: background}
+	if userID := getUserID(c); userID != 0 {
+		opts.UserID = &userID
+	}
+	if id, ok := c.Get("serviceAccountID"); ok {
+		if serviceAccountID, ok := id.(uint); ok {
+			opts.ServiceAccountID = &serviceAccountID
+		}
+	}
+
+	job, err := services.StartProductImport(config.DB, data, opts)
+	if err != nil {
+		respondImportError(c, err, "Failed to import products")
+		return
+	}
+
+	if job.Status == "pending" {
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":     "accepted",
+			"job":        job,
+			"status_url": fmt.Sprintf("/admin/products/import/jobs/%d", job.ID),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": job.Status,
+		"job":    job,
+	})
+}
+
+// GET /admin/products/import/jobs - past and running imports
+func GetImportJobsHandler(c *gin.Context) {
+	params, err := utils.ParseListParams(c.Request.URL.Query(), importJobListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch import jobs")
+		return
+	}
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	status := f.String("status")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch import jobs")
+		return
+	}
+
+	// Row errors can be long; fetch a single job to see them
+	query := config.DB.Omit("errors")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var jobs []models.ProductImportJob
+	pageInfo, err := utils.Paginate(query, params, &jobs)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch import jobs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      jobs,
+		"page_info": pageInfo,
+	})
+}
+
+// GET /admin/products/import/jobs/:id - progress and row errors of an import
+func GetImportJobHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid job id"})
+		return
+	}
+
+	job, err := services.GetImportJob(config.DB, uint(id))
+	if err != nil {
+		respondImportError(c, err, "Failed to fetch import job")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// GET /admin/products/export - stream the whole catalog, one row per SKU (?format=csv|xlsx)
+func ExportProductsHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", services.FormatCSV)
+	contentTypes := map[string]string{
+		services.FormatCSV:  "text/csv; charset=utf-8",
+		services.FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+
+	filename := fmt.Sprintf("products-%s.%s", time.Now().Format("2006-01-02"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+
+	if err := services.ExportProducts(c.Request.Context(), config.DB, c.Writer, format); err != nil {
+		// Headers are already out, all we can do is log it
+		log.Printf("❌ Product export failed: %v", err)
+	}
+}
+
+func respondImportError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrUnreadableSpreadsheet), errors.Is(err, services.ErrImportColumns),
+		errors.Is(err, services.ErrImportEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImportTooManyRows), errors.Is(err, services.ErrSpreadsheetTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImportJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,35 +1,54 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
 )
 
-// StartProductionHandler handles POST /admin/products/:id/production, also fetches/Preloads the associated product
+// StartProductionHandler handles POST /admin/products/:id/production, also fetches/Preloads the associated product.
+// An optional {"variant_id"} body picks the variant, the product's default otherwise.
 func StartProductionHandler(c *gin.Context) {
-	productID := c.Param("id")
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var input struct {
+		VariantID uint `json:"variant_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Check if product exists
-	var product models.Product
-	if err := config.DB.First(&product, productID).Error; err != nil {
+	// Check if product and variant exist
+	variant, err := services.ResolveVariant(config.DB, uint(productID), input.VariantID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
-	// Check if production already exists for this product
+	// Check if production already exists for this variant
 	var existingProduction models.ProductProduction
-	if err := config.DB.Where("product_id = ? AND deleted_at IS NULL", productID).First(&existingProduction).Error; err == nil {
+	if err := config.DB.Where("variant_id = ? AND deleted_at IS NULL", variant.ID).First(&existingProduction).Error; err == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Production already started for this product"})
 		return
 	}
 
 	// Create new production record
 	production := models.ProductProduction{
-		ProductID: product.ID,
+		ProductID: variant.ProductID,
+		VariantID: variant.ID,
 		Status:    "pending",
 		StartedAt: time.Now(),
 	}
@@ -40,7 +59,7 @@ func StartProductionHandler(c *gin.Context) {
 	}
 
 	// Preload the Product relation
-	if err := config.DB.Preload("Product").First(&production, production.ID).Error; err != nil {
+	if err := config.DB.Preload("Product").Preload("Variant").First(&production, production.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch production with product"})
 		return
 	}
@@ -56,7 +75,8 @@ func UpdateProductionStatusHandler(c *gin.Context) {
 	productID := c.Param("id")
 
 	var req struct {
-		Status string `json:"status" binding:"required"`
+		Status    string `json:"status" binding:"required"`
+		VariantID uint   `json:"variant_id"` // needed when several variants are in production
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -72,7 +92,11 @@ func UpdateProductionStatusHandler(c *gin.Context) {
 
 	// Find production record for product
 	var production models.ProductProduction
-	if err := config.DB.Where("product_id = ?", productID).First(&production).Error; err != nil {
+	query := config.DB.Where("product_id = ?", productID)
+	if req.VariantID != 0 {
+		query = query.Where("variant_id = ?", req.VariantID)
+	}
+	if err := query.First(&production).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Production record not found"})
 		return
 	}
@@ -91,7 +115,7 @@ func UpdateProductionStatusHandler(c *gin.Context) {
 	}
 
 	// Reload with Product preloaded
-	if err := config.DB.Preload("Product").First(&production, production.ID).Error; err != nil {
+	if err := config.DB.Preload("Product").Preload("Variant").First(&production, production.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch production with product"})
 		return
 	}
@@ -102,15 +126,20 @@ func UpdateProductionStatusHandler(c *gin.Context) {
 	})
 }
 
-// GetProductionDetailsHandler handles GET /admin/products/:id/production
+// GetProductionDetailsHandler handles GET /admin/products/:id/production (?variant_id= for one variant)
 func GetProductionDetailsHandler(c *gin.Context) {
 	productID := c.Param("id")
 
-	var production models.ProductProduction
-	if err := config.DB.
+	query := config.DB.
 		Preload("Product").
-		Where("product_id = ?", productID).
-		First(&production).Error; err != nil {
+		Preload("Variant").
+		Where("product_id = ?", productID)
+	if variantID := c.Query("variant_id"); variantID != "" {
+		query = query.Where("variant_id = ?", variantID)
+	}
+
+	var production models.ProductProduction
+	if err := query.First(&production).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Production record not found"})
 		return
 	}
@@ -123,17 +152,56 @@ func GetProductionDetailsHandler(c *gin.Context) {
 
 // GetAllProductionsHandler handles GET /admin/products/production
 func GetAllProductionsHandler(c *gin.Context) {
-	var productions []models.ProductProduction
+	params, err := utils.ParseListParams(c.Request.URL.Query(), productionListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch productions")
+		return
+	}
 
-	if err := config.DB.
-		Preload("Product").
-		Find(&productions).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch productions"})
+	f := utils.NewListFilters(c.Request.URL.Query())
+	status := f.String("status")
+	productID := f.Uint("product_id")
+	variantID := f.Uint("variant_id")
+	startedFrom, startedTo := f.TimeRange("started_from", "started_to")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch productions")
+		return
+	}
+
+	query := config.DB.Preload("Product").Preload("Variant")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if productID != nil {
+		query = query.Where("product_id = ?", *productID)
+	}
+	if variantID != nil {
+		query = query.Where("variant_id = ?", *variantID)
+	}
+	query = utils.WhereRange(query, "started_at", startedFrom, startedTo)
+
+	var productions []models.ProductProduction
+	pageInfo, err := utils.Paginate(query, params, &productions)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch productions")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"status":      "success",
-		"productions": productions,
+		"status":    "success",
+		"data":      productions,
+		"page_info": pageInfo,
 	})
 }
+
+// Fields GET /admin/products/production can be sorted by
+var productionListSorts = utils.ListSpec{
+	SortFields: map[string]string{
+		"started_at": "started_at",
+		"updated_at": "updated_at",
+		"status":     "status",
+		"id":         "id",
+	},
+	DefaultSort: "-started_at",
+}
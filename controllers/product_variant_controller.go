@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// POST /admin/products/:id/options - add an option such as size or color
+func CreateOptionTypeHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var input struct {
+		Name   string   `json:"name" binding:"required,max=50"`
+		Values []string `json:"values" binding:"required,min=1"` // e.g. ["S", "M", "L"]
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	optionType, err := services.CreateOptionType(config.DB, uint(productID), input.Name, input.Values)
+	if err != nil {
+		respondVariantError(c, err, "Failed to create option")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"option": optionType,
+	})
+}
+
+// DELETE /admin/products/:id/options/:option_id - remove an option no variant uses
+func DeleteOptionTypeHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	optionID, err := strconv.Atoi(c.Param("option_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid option id"})
+		return
+	}
+
+	if err := services.DeleteOptionType(config.DB, uint(productID), uint(optionID)); err != nil {
+		respondVariantError(c, err, "Failed to delete option")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Option deleted",
+	})
+}
+
+// POST /admin/products/:id/variants - add a SKU with its own price and stock
+func CreateVariantHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var input struct {
+		SKU            string            `json:"sku" binding:"required,max=64"`
+		Price          float64           `json:"price" binding:"required,gt=0"`
+		CompareAtPrice *float64          `json:"compare_at_price" binding:"omitempty,min=0"`
+		StockQuantity  int               `json:"stock_quantity" binding:"min=0"`
+		ImageURL       string            `json:"image_url"`
+		Barcode        string            `json:"barcode" binding:"max=64"`
+		Options        map[string]string `json:"options"` // e.g. {"size": "M", "color": "red"}
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant, err := services.CreateVariant(config.DB, uint(productID), services.VariantInput{
+		SKU:            input.SKU,
+		Price:          input.Price,
+		StockQuantity:  input.StockQuantity,
+		ImageURL:       input.ImageURL,
+		Barcode:        input.Barcode,
+		Options:        input.Options,
+		CompareAtPrice: input.CompareAtPrice,
+		By:             priceAuthor(c),
+	})
+	if err != nil {
+		respondVariantError(c, err, "Failed to create variant")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status":  "success",
+		"variant": variant,
+		"options": variant.Options(),
+	})
+}
+
+// PUT /admin/products/:id/variants/:variant_id - edit a variant
+func UpdateVariantHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant id"})
+		return
+	}
+
+	var input struct {
+		SKU            *string  `json:"sku" binding:"omitempty,max=64"`
+		Price          *float64 `json:"price" binding:"omitempty,gt=0"`
+		CompareAtPrice *float64 `json:"compare_at_price" binding:"omitempty,min=0"` // 0 removes it
+		StockQuantity  *int     `json:"stock_quantity" binding:"omitempty,min=0"`
+		ImageURL       *string  `json:"image_url"`
+		Barcode        *string  `json:"barcode" binding:"omitempty,max=64"`
+		IsDefault      *bool    `json:"is_default"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant, err := services.UpdateVariant(config.DB, uint(productID), uint(variantID), services.VariantUpdate{
+		SKU:            input.SKU,
+		Price:          input.Price,
+		StockQuantity:  input.StockQuantity,
+		ImageURL:       input.ImageURL,
+		Barcode:        input.Barcode,
+		IsDefault:      input.IsDefault,
+		CompareAtPrice: input.CompareAtPrice,
+		By:             priceAuthor(c),
+	})
+	if err != nil {
+		respondVariantError(c, err, "Failed to update variant")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"variant": variant,
+		"options": variant.Options(),
+	})
+}
+
+// DELETE /admin/products/:id/variants/:variant_id - retire a variant
+func DeleteVariantHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variant_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid variant id"})
+		return
+	}
+
+	if err := services.DeleteVariant(config.DB, uint(productID), uint(variantID)); err != nil {
+		respondVariantError(c, err, "Failed to delete variant")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Variant deleted",
+	})
+}
+
+// respondVariantError maps product variant errors to HTTP responses
+func respondVariantError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrVariantNotFound),
+		errors.Is(err, services.ErrOptionTypeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSKUTaken), errors.Is(err, services.ErrOptionTypeExists),
+		errors.Is(err, services.ErrDuplicateVariant), errors.Is(err, services.ErrOptionTypeInUse),
+		errors.Is(err, services.ErrLastVariant), errors.Is(err, services.ErrMultipleVariants):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSKURequired), errors.Is(err, services.ErrInvalidVariantOption),
+		errors.Is(err, services.ErrInsufficientStock):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
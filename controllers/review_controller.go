@@ -0,0 +1,395 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+// Fields review lists can be sorted by
+var reviewListSorts = utils.ListSpec{
+	SortFields: map[string]string{
+		"created_at": "created_at",
+		"rating":     "rating",
+		"helpful":    "helpful_count",
+	},
+	DefaultSort: "-created_at",
+}
+
+type reviewInput struct {
+	Rating *int    `json:"rating" binding:"omitempty,min=1,max=5"`
+	Title  *string `json:"title" binding:"omitempty,max=150"`
+	Body   *string `json:"body" binding:"omitempty,max=5000"`
+}
+
+func (in reviewInput) toService() services.ReviewInput {
+	return services.ReviewInput{Rating: in.Rating, Title: in.Title, Body: in.Body}
+}
+
+// GET /products/:id/reviews - approved reviews with the rating breakdown
+func GetProductReviewsHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	params, err := utils.ParseListParams(c.Request.URL.Query(), reviewListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	rating := f.Uint("rating")
+	withPhotos := f.Bool("with_photos")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	query := services.ReviewPreloads(config.DB).
+		Where("product_id = ? AND status = ?", productID, services.ReviewApproved)
+	if rating != nil {
+		query = query.Where("rating = ?", *rating)
+	}
+	if withPhotos != nil && *withPhotos {
+		query = query.Where("EXISTS (SELECT 1 FROM review_photos WHERE review_photos.review_id = reviews.id)")
+	}
+
+	var reviews []models.Review
+	pageInfo, err := utils.Paginate(query, params, &reviews)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	summary, err := services.ProductRatingSummary(config.DB, uint(productID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reviews"})
+		return
+	}
+
+	data := make([]services.ReviewResponse, 0, len(reviews))
+	for _, r := range reviews {
+		data = append(data, services.ToReviewResponse(r, false))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      data,
+		"page_info": pageInfo,
+		"summary":   summary,
+	})
+}
+
+// POST /products/:id/reviews - review a product you have received
+func CreateReviewHandler(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid product id"})
+		return
+	}
+
+	var input reviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := services.CreateReview(config.DB, getUserID(c), uint(productID), input.toService())
+	if err != nil {
+		respondReviewError(c, err, "Failed to create review")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"review": services.ToReviewResponse(review, true),
+	})
+}
+
+// GET /user/reviews - the reviews you have written, in any state
+func GetMyReviewsHandler(c *gin.Context) {
+	params, err := utils.ParseListParams(c.Request.URL.Query(), reviewListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	var reviews []models.Review
+	pageInfo, err := utils.Paginate(services.ReviewPreloads(config.DB).Where("user_id = ?", getUserID(c)), params, &reviews)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	data := make([]services.ReviewResponse, 0, len(reviews))
+	for _, r := range reviews {
+		data = append(data, services.ToReviewResponse(r, true))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data, "page_info": pageInfo})
+}
+
+// PUT /reviews/:id - edit your review
+func UpdateReviewHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	var input reviewInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := services.UpdateReview(config.DB, getUserID(c), uint(reviewID), input.toService())
+	if err != nil {
+		respondReviewError(c, err, "Failed to update review")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"review": services.ToReviewResponse(review, true),
+	})
+}
+
+// DELETE /reviews/:id - delete your review
+func DeleteReviewHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	if err := services.DeleteReview(c.Request.Context(), config.DB, getUserID(c), uint(reviewID)); err != nil {
+		respondReviewError(c, err, "Failed to delete review")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Review deleted",
+	})
+}
+
+// POST /reviews/:id/photos - attach a photo to your review (multipart field "photo")
+func UploadReviewPhotoHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxUploadBytes()+multipartOverhead)
+	header, err := c.FormFile("photo")
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	if header.Size > services.MaxUploadBytes() {
+		respondMediaError(c, services.ErrImageTooLarge, "Failed to upload photo")
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		respondMediaError(c, err, "Failed to read upload")
+		return
+	}
+	defer file.Close()
+
+	photo, err := services.AddReviewPhoto(c.Request.Context(), config.DB, getUserID(c), uint(reviewID), file)
+	if err != nil {
+		respondReviewError(c, err, "Failed to upload photo")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"photo":  photo,
+	})
+}
+
+// DELETE /reviews/:id/photos/:photo_id - remove a photo from your review
+func DeleteReviewPhotoHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+	photoID, err := strconv.Atoi(c.Param("photo_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid photo id"})
+		return
+	}
+
+	if err := services.DeleteReviewPhoto(c.Request.Context(), config.DB, getUserID(c), uint(reviewID), uint(photoID)); err != nil {
+		respondReviewError(c, err, "Failed to delete photo")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Photo deleted",
+	})
+}
+
+// POST /reviews/:id/helpful - mark a review as helpful
+func VoteReviewHelpfulHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	count, err := services.VoteHelpful(config.DB, getUserID(c), uint(reviewID))
+	if err != nil {
+		respondReviewError(c, err, "Failed to record vote")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "helpful_count": count})
+}
+
+// DELETE /reviews/:id/helpful - take back a helpful vote
+func UnvoteReviewHelpfulHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	count, err := services.UnvoteHelpful(config.DB, getUserID(c), uint(reviewID))
+	if err != nil {
+		respondReviewError(c, err, "Failed to remove vote")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "helpful_count": count})
+}
+
+// GET /admin/reviews - moderation queue (?status=pending by default, or approved, rejected, all)
+func GetReviewQueueHandler(c *gin.Context) {
+	params, err := utils.ParseListParams(c.Request.URL.Query(), reviewListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	productID := f.Uint("product_id")
+	userID := f.Uint("user_id")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	query := services.ReviewPreloads(config.DB)
+	if status := c.DefaultQuery("status", services.ReviewPending); status != "all" {
+		query = query.Where("status = ?", status)
+	}
+	if productID != nil {
+		query = query.Where("product_id = ?", *productID)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var reviews []models.Review
+	pageInfo, err := utils.Paginate(query, params, &reviews)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch reviews")
+		return
+	}
+
+	// Moderators see the whole record, including who wrote it
+	data := make([]gin.H, 0, len(reviews))
+	for _, r := range reviews {
+		data = append(data, gin.H{
+			"review":        services.ToReviewResponse(r, true),
+			"user_id":       r.UserID,
+			"order_item_id": r.OrderItemID,
+			"moderated_by":  r.ModeratedBy,
+			"moderated_at":  r.ModeratedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data, "page_info": pageInfo})
+}
+
+// PUT /admin/reviews/:id/moderation - approve or reject a review
+func ModerateReviewHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required,oneof=approved rejected"`
+		Note   string `json:"note" binding:"max=1000"` // shown to the author when rejected
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	review, err := services.ModerateReview(config.DB, getUserID(c), uint(reviewID), input.Status, input.Note)
+	if err != nil {
+		respondReviewError(c, err, "Failed to moderate review")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"review": services.ToReviewResponse(review, true),
+	})
+}
+
+// DELETE /admin/reviews/:id - remove any review
+func AdminDeleteReviewHandler(c *gin.Context) {
+	reviewID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid review id"})
+		return
+	}
+
+	if err := services.DeleteReview(c.Request.Context(), config.DB, 0, uint(reviewID)); err != nil {
+		respondReviewError(c, err, "Failed to delete review")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Review deleted",
+	})
+}
+
+func respondReviewError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound), errors.Is(err, services.ErrReviewNotFound),
+		errors.Is(err, services.ErrReviewPhotoNotFound), errors.Is(err, services.ErrReviewNotPublished):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotVerifiedPurchaser), errors.Is(err, services.ErrOwnReviewVote):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAlreadyReviewed), errors.Is(err, services.ErrTooManyReviewPhotos):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidRating), errors.Is(err, services.ErrInvalidReviewStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrImageTooLarge), errors.Is(err, services.ErrUnsupportedImage),
+		errors.Is(err, services.ErrImageTooManyPixels):
+		respondMediaError(c, err, fallback)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// GET /admin/permissions - list every permission a role can be granted
+func GetPermissionsHandler(c *gin.Context) {
+	var permissions []models.Permission
+	if err := config.DB.Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"permissions": permissions,
+	})
+}
+
+// GET /admin/roles - list roles with their permissions
+func GetRolesHandler(c *gin.Context) {
+	var roles []models.Role
+	if err := config.DB.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"roles":  roles,
+	})
+}
+
+// POST /admin/roles - create a custom staff role
+func CreateRoleHandler(c *gin.Context) {
+	var input struct {
+		Name        string   `json:"name" binding:"required,max=50"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := services.CreateRole(config.DB, callerRole(c), input.Name, input.Description, input.Permissions)
+	if err != nil {
+		respondRoleError(c, err, "Failed to create role")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "success",
+		"role":   role,
+	})
+}
+
+// PUT /admin/roles/:id - change a role's description or replace its permissions
+func UpdateRoleHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role id"})
+		return
+	}
+
+	var input struct {
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"` // omit to keep, [] to clear
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := services.UpdateRole(config.DB, callerRole(c), uint(id), input.Description, input.Permissions)
+	if err != nil {
+		respondRoleError(c, err, "Failed to update role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "success",
+		"role":   role,
+	})
+}
+
+// DELETE /admin/roles/:id - delete a custom role nobody holds
+func DeleteRoleHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid role id"})
+		return
+	}
+
+	if err := services.DeleteRole(config.DB, uint(id)); err != nil {
+		respondRoleError(c, err, "Failed to delete role")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Role deleted successfully",
+	})
+}
+
+// respondRoleError maps role management errors to HTTP responses
+func respondRoleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRoleExists), errors.Is(err, services.ErrRoleInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPermissionNotHeld):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSystemRole), errors.Is(err, services.ErrSystemRoleLocked), errors.Is(err, services.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// callerRole is the role of the logged-in staff member making the request
+func callerRole(c *gin.Context) string {
+	role, _ := c.Get("role")
+	name, _ := role.(string)
+	return name
+}
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+type SessionResponse struct {
+	ID          string     `json:"id"`
+	DeviceLabel string     `json:"device_label"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddress   string     `json:"ip_address"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Current     bool       `json:"current"`
+}
+
+// GET /user/sessions - list the logged-in user's active sessions
+func GetSessionsHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	sessions, err := utils.ListActiveSessions(config.DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	// Flag the session making this request, if it sent its refresh cookie
+	currentFamily := ""
+	if refreshToken, err := c.Cookie("refresh_token"); err == nil {
+		currentFamily = utils.FindSessionFamily(config.DB, refreshToken)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"sessions": mapSessions(sessions, currentFamily),
+	})
+}
+
+// DELETE /user/sessions/:id - revoke one of the logged-in user's sessions
+func RevokeSessionHandler(c *gin.Context) {
+	userID := getUserID(c)
+	sessionID := c.Param("id")
+
+	if err := services.RevokeSession(config.DB, userID, sessionID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Session revoked",
+	})
+}
+
+// DELETE /user/sessions - log out everywhere
+func RevokeAllSessionsHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	if err := utils.RevokeUserSessions(config.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	// Access tokens already handed out must stop working too
+	if err := services.BumpTokenVersion(config.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access tokens"})
+		return
+	}
+
+	clearRefreshCookie(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Logged out from all devices",
+	})
+}
+
+// GET /admin/users/:id/sessions - admin view of a user's active sessions
+func AdminGetUserSessionsHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	sessions, err := utils.ListActiveSessions(config.DB, uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"sessions": mapSessions(sessions, ""),
+	})
+}
+
+// DELETE /admin/users/:id/sessions - force-revoke every session of a user
+func AdminRevokeUserSessionsHandler(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := utils.RevokeUserSessions(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	if err := services.BumpTokenVersion(config.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "All sessions revoked for user",
+	})
+}
+
+func mapSessions(sessions []models.RefreshToken, currentFamily string) []SessionResponse {
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:          s.FamilyID,
+			DeviceLabel: s.DeviceLabel,
+			UserAgent:   s.UserAgent,
+			IPAddress:   s.IPAddress,
+			CreatedAt:   s.CreatedAt,
+			LastUsedAt:  s.LastUsedAt,
+			ExpiresAt:   s.ExpiresAt,
+			Current:     currentFamily != "" && s.FamilyID == currentFamily,
+		})
+	}
+	return resp
+}
@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+)
+
+// GET /admin/settings - list store settings
+func GetSettingsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":   "success",
+		"settings": services.GetAllSettings(config.DB),
+	})
+}
+
+// PUT /admin/settings/:key - update a store setting
+func UpdateSettingHandler(c *gin.Context) {
+	key := c.Param("key")
+
+	var input struct {
+		Value *string `json:"value" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.SetSetting(config.DB, key, *input.Value); err != nil {
+		if errors.Is(err, services.ErrUnknownSetting) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown setting"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update setting"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Setting updated successfully",
+	})
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+// ------------------ Login second step ------------------
+
+// POST /auth/2fa/verify - finish a login with a TOTP or recovery code
+func VerifyTwoFactorLoginHandler(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Code == "" && input.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	user, jti, ok := challengeUser(c, input.ChallengeToken, utils.ChallengeTwoFactor)
+	if !ok || !reserveChallengeAttempt(c, jti) {
+		return
+	}
+
+	if err := services.VerifySecondFactor(config.DB, user.ID, input.Code, input.RecoveryCode); err != nil {
+		// Wrong codes count towards the same lockout as wrong passwords
+		lockedFor, lockErr := services.RegisterFailedLogin(config.DB, &user, sessionInfo(c), "bad_2fa")
+		if lockErr != nil {
+			log.Printf("❌ Could not update lockout state for user %d: %v", user.ID, lockErr)
+		}
+		if lockedFor > 0 {
+			respondAccountLocked(c, lockedFor)
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	if !finishChallenge(c, jti) {
+		return
+	}
+	loginSucceeded(c, user, "2fa", nil)
+}
+
+// POST /auth/2fa/setup - start 2FA enrollment during login when the user's role requires it
+func SetupTwoFactorLoginHandler(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, _, ok := challengeUser(c, input.ChallengeToken, utils.ChallengeTwoFactorSetup)
+	if !ok {
+		return
+	}
+
+	startEnrollment(c, user)
+}
+
+// POST /auth/2fa/setup/confirm - confirm enrollment during login and receive tokens
+func ConfirmTwoFactorLoginHandler(c *gin.Context) {
+	var input struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, jti, ok := challengeUser(c, input.ChallengeToken, utils.ChallengeTwoFactorSetup)
+	if !ok || !reserveChallengeAttempt(c, jti) {
+		return
+	}
+
+	codes, err := services.ConfirmTOTPEnrollment(config.DB, user.ID, input.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	if !finishChallenge(c, jti) {
+		return
+	}
+	loginSucceeded(c, user, "2fa_setup", gin.H{"recovery_codes": codes})
+}
+
+// ------------------ Self-service (logged in) ------------------
+
+// GET /user/2fa - 2FA status of the logged-in user
+func GetTwoFactorStatusHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":                   "success",
+		"enabled":                  services.IsTwoFactorEnabled(config.DB, userID),
+		"required":                 services.RoleRequires2FA(config.DB, user.Role),
+		"recovery_codes_remaining": services.CountUnusedRecoveryCodes(config.DB, userID),
+	})
+}
+
+// POST /user/2fa/setup - start 2FA enrollment
+func SetupTwoFactorHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	startEnrollment(c, user)
+}
+
+// POST /user/2fa/confirm - enable 2FA with the first code from the authenticator
+func ConfirmTwoFactorHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := services.ConfirmTOTPEnrollment(config.DB, userID, input.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"message":        "Two-factor authentication enabled. Store your recovery codes somewhere safe.",
+		"recovery_codes": codes,
+	})
+}
+
+// POST /user/2fa/disable - turn 2FA off (not allowed when the role requires it)
+func DisableTwoFactorHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if services.RoleRequires2FA(config.DB, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+
+	if err := services.VerifySecondFactor(config.DB, userID, input.Code, input.RecoveryCode); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	if err := services.DisableTwoFactor(config.DB, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "success",
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// POST /user/2fa/recovery-codes - replace all recovery codes
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	userID := getUserID(c)
+
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.VerifySecondFactor(config.DB, userID, input.Code, ""); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	codes, err := services.RegenerateRecoveryCodes(config.DB, userID)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "success",
+		"recovery_codes": codes,
+	})
+}
+
+// ------------------ Helpers ------------------
+
+// challengeUser resolves the user behind a challenge token, writing the error response if it fails
+func challengeUser(c *gin.Context, challengeToken, purpose string) (models.User, string, bool) {
+	var user models.User
+
+	userID, jti, err := utils.ValidateChallengeToken(challengeToken, purpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return user, "", false
+	}
+
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge token"})
+		return user, "", false
+	}
+
+	// A lock set after the password step also stops the second one
+	if remaining := services.LockRemaining(user); remaining > 0 {
+		respondAccountLocked(c, remaining)
+		return user, "", false
+	}
+
+	if user.IsBlocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked. Please contact support."})
+		return user, "", false
+	}
+
+	return user, jti, true
+}
+
+// reserveChallengeAttempt counts one code attempt against the challenge,
+// answering the request itself when none are left
+func reserveChallengeAttempt(c *gin.Context, jti string) bool {
+	if err := services.ReserveChallengeAttempt(config.DB, jti); err != nil {
+		respondChallengeError(c, err)
+		return false
+	}
+	return true
+}
+
+// finishChallenge burns the challenge, so a token that just worked can't be replayed
+func finishChallenge(c *gin.Context, jti string) bool {
+	if err := services.FinishLoginChallenge(config.DB, jti); err != nil {
+		respondChallengeError(c, err)
+		return false
+	}
+	return true
+}
+
+func respondChallengeError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrChallengeSpent) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify challenge token"})
+}
+
+func startEnrollment(c *gin.Context, user models.User) {
+	secret, uri, err := services.StartTOTPEnrollment(config.DB, user)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":      "success",
+		"secret":      secret,
+		"otpauth_uri": uri, // render as a QR code for authenticator apps
+	})
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSecondFactor):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTwoFactorNotEnrolled), errors.Is(err, services.ErrTwoFactorAlreadyOn):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor operation failed"})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
 	"github.com/mahi-qwe/ecommerce-backend/utils"
 )
 
@@ -49,10 +50,11 @@ func UpdateProfileHandler(c *gin.Context) {
 
 	// Allow safe fields
 	var input struct {
-		FullName  string `json:"full_name"`
-		Password  string `json:"password"`
-		AvatarURL string `json:"avatar_url"`
-		Address   string `json:"address"`
+		FullName        string `json:"full_name"`
+		Password        string `json:"password"`
+		CurrentPassword string `json:"current_password"` // required to change the password
+		AvatarURL       string `json:"avatar_url"`
+		Address         string `json:"address"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -74,18 +76,49 @@ func UpdateProfileHandler(c *gin.Context) {
 		updates["address"] = input.Address
 	}
 
+	// If nothing to update
+	if len(updates) == 0 && input.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
+		return
+	}
+
+	// Password changes go first so a rejected password leaves the profile untouched
 	if input.Password != "" {
-		hashedPassword, err := utils.HashPassword(input.Password)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		if _, impersonating := c.Get("impersonatorID"); impersonating {
+			c.Set("impersonationBlocked", true) // logged as "blocked"
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
+			return
+		}
+
+		var user models.User
+		if err := config.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if input.CurrentPassword == "" || !utils.CheckPasswordHash(input.CurrentPassword, user.PasswordHash) {
+			respondPasswordError(c, services.ErrCurrentPasswordWrong, "Failed to update password")
+			return
+		}
+
+		// Also invalidates access tokens issued under the old password
+		if err := services.ChangePassword(config.DB, &user, input.Password); err != nil {
+			respondPasswordError(c, err, "Failed to update password")
+			return
+		}
+
+		// And ends every refresh-token family, so a stolen session dies with the old password
+		if err := utils.RevokeUserSessions(config.DB, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke existing sessions"})
 			return
 		}
-		updates["password_hash"] = hashedPassword
 	}
 
-	// If nothing to update
 	if len(updates) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No valid fields to update"})
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "success",
+			"message": "Profile updated successfully",
+		})
 		return
 	}
 
@@ -6,6 +6,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
 )
 
 // ✅ POST /wishlist - Add product to wishlist
@@ -13,23 +15,24 @@ func AddToWishlist(c *gin.Context) {
 	userID := getUserID(c)
 
 	var input struct {
-		ProductID uint `json:"product_id" binding:"required"`
+		ProductID uint `json:"product_id" binding:"required_without=VariantID"`
+		VariantID uint `json:"variant_id"` // optional, the product's default variant otherwise
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check product exists
-	var product models.Product
-	if err := config.DB.First(&product, input.ProductID).Error; err != nil {
+	// Check product and variant exist
+	variant, err := services.ResolveVariant(config.DB, input.ProductID, input.VariantID)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 		return
 	}
 
 	// Prevent duplicates
 	var existing models.WishlistItem
-	if err := config.DB.Where("user_id = ? AND product_id = ?", userID, input.ProductID).
+	if err := config.DB.Where("user_id = ? AND variant_id = ?", userID, variant.ID).
 		First(&existing).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Product already in wishlist"})
 		return
@@ -38,7 +41,8 @@ func AddToWishlist(c *gin.Context) {
 	// Create wishlist item
 	item := models.WishlistItem{
 		UserID:    userID,
-		ProductID: input.ProductID,
+		ProductID: variant.ProductID,
+		VariantID: variant.ID,
 	}
 	if err := config.DB.Create(&item).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add to wishlist"})
@@ -46,7 +50,7 @@ func AddToWishlist(c *gin.Context) {
 	}
 
 	// Preload product
-	config.DB.Preload("Product").First(&item, item.ID)
+	config.DB.Preload("Product").Preload("Variant."+models.VariantOptionsPreload).First(&item, item.ID)
 
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Product added to wishlist",
@@ -58,22 +62,68 @@ func AddToWishlist(c *gin.Context) {
 func GetWishlist(c *gin.Context) {
 	userID := getUserID(c)
 
+	params, err := utils.ParseListParams(c.Request.URL.Query(), wishlistListSorts)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch wishlist")
+		return
+	}
+
+	f := utils.NewListFilters(c.Request.URL.Query())
+	priceMin, priceMax := f.Float("price_min"), f.Float("price_max")
+	inStock := f.Bool("in_stock")
+	addedFrom, addedTo := f.TimeRange("created_from", "created_to")
+	if err := f.Err(); err != nil {
+		respondListError(c, err, "Failed to fetch wishlist")
+		return
+	}
+
+	query := config.DB.Preload("Product").Preload("Variant."+models.VariantOptionsPreload).
+		Joins("JOIN products ON products.id = wishlist_items.product_id AND products.deleted_at IS NULL").
+		Joins("JOIN product_variants ON product_variants.id = wishlist_items.variant_id AND product_variants.deleted_at IS NULL").
+		Where("wishlist_items.user_id = ?", userID)
+
+	if priceMin != nil {
+		query = query.Where("product_variants.price >= ?", *priceMin)
+	}
+	if priceMax != nil {
+		query = query.Where("product_variants.price <= ?", *priceMax)
+	}
+	if inStock != nil {
+		if *inStock {
+			query = query.Where("product_variants.stock_quantity > 0")
+		} else {
+			query = query.Where("product_variants.stock_quantity <= 0")
+		}
+	}
+	query = utils.WhereRange(query, "wishlist_items.created_at", addedFrom, addedTo)
+
 	var items []models.WishlistItem
-	if err := config.DB.Preload("Product").Where("user_id = ?", userID).Find(&items).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch wishlist"})
+	pageInfo, err := utils.Paginate(query, params, &items)
+	if err != nil {
+		respondListError(c, err, "Failed to fetch wishlist")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"wishlist": items})
+	c.JSON(http.StatusOK, gin.H{"data": items, "page_info": pageInfo})
 }
 
-// ✅ DELETE /wishlist/:product_id - Remove item from wishlist
+// The wishlist sorts by when items were added
+var wishlistListSorts = utils.ListSpec{
+	SortFields:  map[string]string{"created_at": "created_at"},
+	DefaultSort: "-created_at",
+}
+
+// ✅ DELETE /wishlist/:product_id - Remove item from wishlist (?variant_id= for just one variant)
 func RemoveFromWishlist(c *gin.Context) {
 	userID := getUserID(c)
 	productID := c.Param("product_id")
 
-	result := config.DB.Where("user_id = ? AND product_id = ?", userID, productID).
-		Delete(&models.WishlistItem{})
+	query := config.DB.Where("user_id = ? AND product_id = ?", userID, productID)
+	if variantID := c.Query("variant_id"); variantID != "" {
+		query = query.Where("variant_id = ?", variantID)
+	}
+
+	result := query.Delete(&models.WishlistItem{})
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove from wishlist"})
@@ -0,0 +1,32 @@
+import React from "react";
+
+// Previous/next controls for list endpoints, driven by their page_info
+export default function Pager({ pageInfo, onPageChange }) {
+  if (!pageInfo) return null;
+
+  const page = pageInfo.page || 1;
+  const totalPages = pageInfo.total_pages || 1;
+
+  return (
+    <div className="flex justify-between items-center mt-4">
+      <button
+        onClick={() => onPageChange(page - 1)}
+        disabled={page <= 1}
+        className="px-3 py-1 border rounded bg-white disabled:opacity-50"
+      >
+        Previous
+      </button>
+      <span className="text-sm text-gray-600">
+        Page {page} of {totalPages}
+        {pageInfo.total !== undefined ? ` (${pageInfo.total} total)` : ""}
+      </span>
+      <button
+        onClick={() => onPageChange(page + 1)}
+        disabled={!pageInfo.has_more}
+        className="px-3 py-1 border rounded bg-white disabled:opacity-50"
+      >
+        Next
+      </button>
+    </div>
+  );
+}
@@ -16,25 +16,21 @@ export default function Dashboard() {
       try {
         // You may need to create a backend endpoint like: GET /admin/dashboard
         // For now, we can call individual endpoints and count results
+        // Lists are paginated; page_info.total has the full count
         const [usersRes, productsRes, ordersRes] = await Promise.all([
-          api.get("/admin/users"),
-          api.get("/products"),
-          api.get("/admin/orders"),
+          api.get("/admin/users", { params: { role: "user", limit: 100 } }),
+          api.get("/products", { params: { limit: 1 } }),
+          api.get("/admin/orders", { params: { limit: 1 } }),
         ]);
 
-        // Filter to only include customers (exclude admins)
-        const customers = usersRes.data.users.filter(
-          (user) => user.role !== "admin"
-        );
-
         setStats({
-          users: customers.length,
-          products: productsRes.data.products.length,
-          orders: ordersRes.data.length,
+          users: usersRes.data.page_info.total,
+          products: productsRes.data.page_info.total,
+          orders: ordersRes.data.page_info.total,
         });
 
-        // Store all customer data for the table
-        setUsers(customers);
+        // Newest customers for the table
+        setUsers(usersRes.data.data);
       } catch (err) {
         console.error(err);
         setError("Failed to load dashboard stats");
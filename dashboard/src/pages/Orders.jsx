@@ -1,27 +1,32 @@
 import React, { useEffect, useState } from "react";
 import api from "../api";
+import Pager from "../components/Pager";
+
+// Every status the backend accepts, so filtering doesn't depend on what one page holds
+const ORDER_STATUSES = ["pending", "processing", "shipped", "delivered"];
+const PAGE_SIZE = 20;
 
 export default function Orders() {
   const [orders, setOrders] = useState([]);
+  const [pageInfo, setPageInfo] = useState(null);
+  const [page, setPage] = useState(1);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState("");
   const [filterStatus, setFilterStatus] = useState("all");
-  const [allStatuses, setAllStatuses] = useState([]); // ✅ master list of all statuses
 
-  // Fetch orders from backend with optional status filter
-  const fetchOrders = async (status = "all") => {
+  // Fetch one page of orders with optional status filter
+  const fetchOrders = async (status = "all", pageNumber = 1) => {
     setLoading(true);
     try {
       const res = await api.get("/admin/orders", {
-        params: status !== "all" ? { status } : {},
+        params: {
+          limit: PAGE_SIZE,
+          page: pageNumber,
+          ...(status !== "all" ? { status } : {}),
+        },
       });
-      setOrders(res.data);
-
-      // ✅ Build master list only when fetching ALL
-      if (status === "all") {
-        const uniqueStatuses = [...new Set(res.data.map((o) => o.status))];
-        setAllStatuses(uniqueStatuses);
-      }
+      setOrders(res.data.data);
+      setPageInfo(res.data.page_info);
     } catch (err) {
       console.error(err);
       setError("Failed to load orders");
@@ -30,10 +35,10 @@ export default function Orders() {
     }
   };
 
-  // Fetch orders when component mounts or filterStatus changes
+  // Fetch orders when component mounts or the filter or page changes
   useEffect(() => {
-    fetchOrders(filterStatus);
-  }, [filterStatus]);
+    fetchOrders(filterStatus, page);
+  }, [filterStatus, page]);
 
   // Handle status update
   const handleStatusChange = async (id, newStatus) => {
@@ -65,11 +70,14 @@ export default function Orders() {
         {/* Filter Dropdown */}
         <select
           value={filterStatus}
-          onChange={(e) => setFilterStatus(e.target.value)}
+          onChange={(e) => {
+            setFilterStatus(e.target.value);
+            setPage(1);
+          }}
           className="p-2 border rounded"
         >
           <option value="all">All</option>
-          {allStatuses.map((status) => (
+          {ORDER_STATUSES.map((status) => (
             <option key={status} value={status}>
               {status.charAt(0).toUpperCase() + status.slice(1)}
             </option>
@@ -132,7 +140,7 @@ export default function Orders() {
                     onChange={(e) => handleStatusChange(o.id, e.target.value)}
                     className="p-1 border rounded"
                   >
-                    {allStatuses.map((status) => (
+                    {ORDER_STATUSES.map((status) => (
                       <option key={status} value={status}>
                         {status}
                       </option>
@@ -150,6 +158,8 @@ export default function Orders() {
           )}
         </tbody>
       </table>
+
+      <Pager pageInfo={pageInfo} onPageChange={setPage} />
     </div>
   );
 }
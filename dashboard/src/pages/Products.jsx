@@ -1,11 +1,23 @@
 import React, { useEffect, useState } from "react";
 import api from "../api";
 import { MdDelete, MdModeEdit } from "react-icons/md";
+import Pager from "../components/Pager";
+
+const PAGE_SIZE = 20;
+
+// Flatten the category tree for a dropdown, indenting subcategories
+const flattenCategories = (nodes, depth = 0) =>
+  nodes.flatMap((cat) => [
+    { slug: cat.slug, label: `${"\u00a0\u00a0".repeat(depth)}${cat.name}` },
+    ...flattenCategories(cat.children || [], depth + 1),
+  ]);
 
 const Products = () => {
   const [products, setProducts] = useState([]);
   const [categories, setCategories] = useState([]); // ✅ keep all categories
   const [selectedCategory, setSelectedCategory] = useState("All");
+  const [pageInfo, setPageInfo] = useState(null);
+  const [page, setPage] = useState(1);
 
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState("");
@@ -23,22 +35,19 @@ const Products = () => {
     image_url: "",
   });
 
-  // ✅ Fetch products (with optional category filter)
-  const fetchProducts = async (category = "All") => {
+  // ✅ Fetch one page of products (with optional category filter by slug)
+  const fetchProducts = async (category = "All", pageNumber = 1) => {
     try {
       const res = await api.get("/products", {
-        params: category !== "All" ? { category } : {},
+        params: {
+          limit: PAGE_SIZE,
+          page: pageNumber,
+          ...(category !== "All" ? { category } : {}),
+        },
       });
 
-      setProducts(res.data.products);
-
-      // ✅ build categories only once (when fetching all)
-      if (category === "All") {
-        const uniqueCats = [
-          ...new Set(res.data.products.map((p) => p.category)),
-        ];
-        setCategories(uniqueCats);
-      }
+      setProducts(res.data.data);
+      setPageInfo(res.data.page_info);
     } catch (err) {
       console.error(err);
       setError("Failed to load products");
@@ -47,10 +56,24 @@ const Products = () => {
     }
   };
 
+  // ✅ Load every category for the filter, not just those on one page
+  const fetchCategories = async () => {
+    try {
+      const res = await api.get("/categories");
+      setCategories(flattenCategories(res.data.categories || []));
+    } catch (err) {
+      console.error(err);
+    }
+  };
+
   useEffect(() => {
-    fetchProducts();
+    fetchCategories();
   }, []);
 
+  useEffect(() => {
+    fetchProducts(selectedCategory, page);
+  }, [selectedCategory, page]);
+
   // ✅ Handle input change
   const handleChange = (e) => {
     const { name, value } = e.target;
@@ -84,7 +107,7 @@ const Products = () => {
       }
 
       resetForm();
-      fetchProducts();
+      fetchProducts(selectedCategory, page);
     } catch (err) {
       console.error("Product submit error:", err);
       alert("❌ Failed to save product");
@@ -136,9 +159,8 @@ const Products = () => {
 
   // ✅ Handle category filter
   const handleCategoryChange = (e) => {
-    const category = e.target.value;
-    setSelectedCategory(category);
-    fetchProducts(category);
+    setSelectedCategory(e.target.value);
+    setPage(1);
   };
 
   if (loading) return <p className="p-4">Loading...</p>;
@@ -170,8 +192,8 @@ const Products = () => {
         >
           <option value="All">All</option>
           {categories.map((cat) => (
-            <option key={cat} value={cat}>
-              {cat}
+            <option key={cat.slug} value={cat.slug}>
+              {cat.label}
             </option>
           ))}
         </select>
@@ -318,6 +340,8 @@ const Products = () => {
           )}
         </tbody>
       </table>
+
+      <Pager pageInfo={pageInfo} onPageChange={setPage} />
     </div>
   );
 };
@@ -2,9 +2,14 @@ import React, { useEffect, useState } from "react";
 import api from "../api";
 import { MdDelete, MdModeEdit, MdBlock } from "react-icons/md";
 import { CgUnblock } from "react-icons/cg";
+import Pager from "../components/Pager";
+
+const PAGE_SIZE = 20;
 
 export default function Users() {
   const [users, setUsers] = useState([]);
+  const [pageInfo, setPageInfo] = useState(null);
+  const [page, setPage] = useState(1);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState("");
   const [isEditing, setIsEditing] = useState(false);
@@ -18,11 +23,14 @@ export default function Users() {
     avatar_url: "",
   });
 
-  // Fetch users
-  const fetchUsers = async () => {
+  // Fetch one page of users
+  const fetchUsers = async (pageNumber = 1) => {
     try {
-      const res = await api.get("/admin/users");
-      setUsers(res.data.users);
+      const res = await api.get("/admin/users", {
+        params: { role: "user", limit: PAGE_SIZE, page: pageNumber },
+      });
+      setUsers(res.data.data);
+      setPageInfo(res.data.page_info);
     } catch (err) {
       console.error(err);
       setError("Failed to load users");
@@ -45,8 +53,8 @@ export default function Users() {
   };
 
   useEffect(() => {
-    fetchUsers();
-  }, []);
+    fetchUsers(page);
+  }, [page]);
 
   // Handle input change
   const handleChange = (e) => {
@@ -69,7 +77,7 @@ export default function Users() {
       await api.put(`/admin/users/${currentId}`, payload);
       alert("✅ User updated successfully");
       resetForm();
-      fetchUsers();
+      fetchUsers(page);
     } catch (err) {
       console.error("Update user error:", err);
       alert("❌ Failed to update user");
@@ -219,7 +227,7 @@ export default function Users() {
           </tr>
         </thead>
         <tbody>
-          {users.filter((u) => u.role === "user").length > 0 ? (
+          {users.length > 0 ? (
             users
               .filter((u) => u.role === "user")
               .map((u) => (
@@ -291,6 +299,8 @@ export default function Users() {
           )}
         </tbody>
       </table>
+
+      <Pager pageInfo={pageInfo} onPageChange={setPage} />
     </div>
   );
 }
@@ -1,16 +1,47 @@
 package middlewares
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"github.com/mahi-qwe/ecommerce-backend/services"
 	"github.com/mahi-qwe/ecommerce-backend/utils"
 )
 
+// AuthOption tweaks what AuthMiddleware accepts
+type AuthOption func(*authOptions)
+
+type authOptions struct {
+	apiKeys bool
+}
+
+// WithAPIKeys also accepts service account API keys, sent as "X-API-Key: ak_..."
+// or "Authorization: Bearer ak_...". API key requests carry scopes instead of a
+// user, so only use it on routes guarded by RequirePermission.
+func WithAPIKeys() AuthOption {
+	return func(o *authOptions) { o.apiKeys = true }
+}
+
 // AuthMiddleware checks JWT token and sets userID + role in context
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(opts ...AuthOption) gin.HandlerFunc {
+	var options authOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	return func(c *gin.Context) {
+		if options.apiKeys {
+			if apiKey := apiKeyFromRequest(c); apiKey != "" {
+				authenticateAPIKey(c, apiKey)
+				return
+			}
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
@@ -19,17 +50,118 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-		userID, role, err := utils.ValidateJWT(tokenStr)
+		claims, err := utils.ValidateJWT(tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		// Set userID and role in context (so AdminMiddleware can use it)
-		c.Set("userID", userID)
-		c.Set("role", role)
+		// Catch tokens cut off by a block, role/password change or logout
+		revoked, err := services.IsTokenRevoked(config.DB, claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		if claims.IsBlocked {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been blocked. Please contact support."})
+			c.Abort()
+			return
+		}
+
+		// Set userID and role in context (so RequirePermission can use it)
+		c.Set("userID", claims.UserID)
+		c.Set("role", claims.Role)
+
+		if claims.ActorID != 0 {
+			actAsUser(c, claims)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// actAsUser serves a request made with an impersonation token and writes it to the audit log
+func actAsUser(c *gin.Context, claims *utils.AccessClaims) {
+	allowed, err := services.ImpersonatorAllowed(config.DB, uint(claims.ActorID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not verify token"})
+		c.Abort()
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Impersonation is no longer allowed"})
+		c.Abort()
+		return
+	}
+
+	c.Set("impersonatorID", claims.ActorID)
+	c.Header("X-Impersonated-By", strconv.Itoa(claims.ActorID))
+
+	c.Next()
 
+	blocked := c.GetBool("impersonationBlocked")
+	if err := services.RecordImpersonatedRequest(config.DB, claims, c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP(), blocked); err != nil {
+		log.Printf("❌ Could not log impersonated request by admin %d: %v", claims.ActorID, err)
+	}
+}
+
+// DenyImpersonation blocks a route for impersonation tokens, e.g. payments,
+// password changes and deletions. The attempt is logged as "blocked". Runs
+// after AuthMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if IsImpersonating(c) {
+			c.Set("impersonationBlocked", true)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating a user"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
+
+// IsImpersonating reports whether the request uses an impersonation token
+func IsImpersonating(c *gin.Context) bool {
+	_, ok := c.Get("impersonatorID")
+	return ok
+}
+
+// apiKeyFromRequest returns the API key sent with the request, if any
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if bearer := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); strings.HasPrefix(bearer, services.APIKeyPrefix) {
+		return bearer
+	}
+	return ""
+}
+
+// authenticateAPIKey checks an API key and sets its scopes in context
+func authenticateAPIKey(c *gin.Context, apiKey string) {
+	key, err := services.AuthenticateAPIKey(config.DB, apiKey, c.ClientIP())
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, services.ErrAPIKeyIPNotAllowed) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+
+	c.Set("apiKeyID", key.ID)
+	c.Set("serviceAccountID", key.ServiceAccountID)
+	c.Set("scopes", key.Scopes)
+
+	c.Next()
+}
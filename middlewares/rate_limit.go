@@ -0,0 +1,198 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitStore counts hits per key in fixed windows. The in-memory store is
+// enough for a single node; implement this on a shared backend (Redis, Postgres...)
+// to enforce limits across several instances.
+type RateLimitStore interface {
+	// Increment records one hit and returns the hit count of the current window
+	// and when that window resets.
+	Increment(key string, window time.Duration) (count int, resetAt time.Time, err error)
+}
+
+// DefaultRateLimitStore is used by limits that don't set their own store
+var DefaultRateLimitStore RateLimitStore = NewMemoryRateLimitStore()
+
+// RateLimitKeyFunc returns the identity a limit applies to. An empty key skips the limit.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// RateLimitConfig describes one limit, e.g. 5 requests per minute per email
+type RateLimitConfig struct {
+	Name   string // namespaces the counters, e.g. "login-ip"
+	Limit  int
+	Window time.Duration
+	Key    RateLimitKeyFunc
+	Store  RateLimitStore // optional, defaults to DefaultRateLimitStore
+}
+
+// RateLimit rejects requests over the limit with 429 and sets Retry-After / X-RateLimit-* headers
+func RateLimit(cfg RateLimitConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := cfg.Key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		store := cfg.Store
+		if store == nil {
+			store = DefaultRateLimitStore
+		}
+
+		count, resetAt, err := store.Increment(cfg.Name+":"+key, cfg.Window)
+		if err != nil {
+			// Fail open: a broken limiter backend shouldn't take the API down
+			log.Printf("⚠️ rate limit store error (%s): %v", cfg.Name, err)
+			c.Next()
+			return
+		}
+
+		remaining := cfg.Limit - count
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(cfg.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(resetAt.Unix(), 10))
+
+		if count > cfg.Limit {
+			retryAfter := int(math.Ceil(time.Until(resetAt).Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// KeyByIP limits per client IP
+func KeyByIP() RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		return c.ClientIP()
+	}
+}
+
+// KeyByUserID limits per authenticated user (must run after AuthMiddleware)
+func KeyByUserID() RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		userID, exists := c.Get("userID")
+		if !exists {
+			return ""
+		}
+		return fmt.Sprint(userID)
+	}
+}
+
+// jsonKeyMaxBody caps how much of the body KeyByJSONField reads; the auth
+// bodies it is used on are a few hundred bytes
+const jsonKeyMaxBody = 8 << 10
+
+// KeyByJSONField limits per value of a field in the JSON body, e.g. "email".
+// The body is restored so the handler can still bind it.
+func KeyByJSONField(field string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		if c.Request.Body == nil {
+			return ""
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, jsonKeyMaxBody))
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return ""
+		}
+
+		value, ok := jsonFieldValue(body, field)
+		if !ok {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+}
+
+// jsonFieldValue finds the string that ShouldBindJSON would bind to field:
+// like encoding/json, keys match case-insensitively and the last match wins
+func jsonFieldValue(body []byte, field string) (string, bool) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", false
+	}
+
+	value, found := "", false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", false
+		}
+		key, _ := tok.(string)
+
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return "", false
+		}
+		if strings.EqualFold(key, field) {
+			value, found = v.(string)
+		}
+	}
+	return value, found
+}
+
+// MemoryRateLimitStore keeps fixed-window counters in process memory
+type MemoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*rateLimitCounter
+}
+
+type rateLimitCounter struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{counters: map[string]*rateLimitCounter{}}
+}
+
+func (s *MemoryRateLimitStore) Increment(key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+
+	// Drop finished windows now and then so memory stays bounded
+	if len(s.counters) > 10000 {
+		for k, counter := range s.counters {
+			if now.After(counter.resetAt) {
+				delete(s.counters, k)
+			}
+		}
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || now.After(counter.resetAt) {
+		counter = &rateLimitCounter{resetAt: now.Add(window)}
+		s.counters[key] = counter
+	}
+	counter.count++
+
+	return counter.count, counter.resetAt, nil
+}
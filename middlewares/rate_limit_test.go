@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJSONFieldValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		want  string
+		found bool
+	}{
+		{"exact key", `{"email":"a@x.io"}`, "a@x.io", true},
+		{"other case", `{"Email":"a@x.io"}`, "a@x.io", true},
+		{"upper case", `{"EMAIL":"a@x.io"}`, "a@x.io", true},
+		{"last match wins", `{"email":"decoy@x.io","Email":"a@x.io"}`, "a@x.io", true},
+		{"last exact match wins", `{"Email":"decoy@x.io","email":"a@x.io"}`, "a@x.io", true},
+		{"nested values are skipped", `{"meta":{"email":"decoy"},"email":"a@x.io"}`, "a@x.io", true},
+		{"not a string", `{"email":42}`, "", false},
+		{"later non-string overrides", `{"email":"a@x.io","EMAIL":null}`, "", false},
+		{"missing", `{"mail":"a@x.io"}`, "", false},
+		{"not an object", `["email","a@x.io"]`, "", false},
+		{"broken json", `{"email":"a@x.io"`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := jsonFieldValue([]byte(tt.body), "email")
+			if got != tt.want || found != tt.found {
+				t.Errorf("jsonFieldValue(%s) = %q, %v; want %q, %v", tt.body, got, found, tt.want, tt.found)
+			}
+		})
+	}
+}
+
+func TestKeyByJSONField(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"normalized", `{"Email":"  Victim@X.io "}`, "victim@x.io"},
+		{"oversized body", `{"email":"a@x.io","pad":"` + strings.Repeat("x", jsonKeyMaxBody) + `"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(tt.body))
+
+			if got := KeyByJSONField("email")(c); got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+
+			// The handler still gets the body (truncated when oversized)
+			rest, _ := io.ReadAll(c.Request.Body)
+			if len(tt.body) <= jsonKeyMaxBody && string(rest) != tt.body {
+				t.Errorf("body after key = %q, want %q", rest, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ServiceAccount is a non-human identity (ERP, warehouse scripts) that owns API keys
+type ServiceAccount struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string         `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description string         `gorm:"type:text" json:"description"`
+	IsDisabled  bool           `gorm:"default:false;not null" json:"is_disabled"`
+	CreatedByID uint           `gorm:"not null" json:"created_by_id"` // admin who created it
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"` // soft delete
+}
+
+// APIKey authenticates a service account. Only a hash of the key is stored.
+type APIKey struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ServiceAccountID uint       `gorm:"not null;index" json:"service_account_id"`
+	Name             string     `gorm:"type:varchar(100);not null" json:"name"`
+	Prefix           string     `gorm:"type:varchar(16);not null" json:"prefix"` // first characters, to recognise a key
+	KeyHash          string     `gorm:"type:varchar(255);uniqueIndex;not null" json:"-"`
+	Scopes           []string   `gorm:"type:text;serializer:json" json:"scopes"`      // permissions, e.g. products:write
+	AllowedIPs       []string   `gorm:"type:text;serializer:json" json:"allowed_ips"` // IPs or CIDRs; empty allows any
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP       string     `gorm:"type:varchar(64)" json:"last_used_ip,omitempty"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	CreatedByID      uint       `gorm:"not null" json:"created_by_id"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/config"
+)
+
+// Attribute types
+const (
+	AttributeText    = "text"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+	AttributeSelect  = "select"
+)
+
+// AttributeDefinition is a typed spec, such as material or weight, that the
+// products of a category and its subcategories can have. Values are kept in
+// Product.Attributes under Code. A code has the same type in every category,
+// so filters and facets mean the same thing across the catalog.
+type AttributeDefinition struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	CategoryID uint      `gorm:"not null;uniqueIndex:idx_attribute_category_code" json:"category_id"`
+	Code       string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_attribute_category_code;index" json:"code"` // e.g. "material"
+	Name       string    `gorm:"type:varchar(100);not null" json:"name"`                                              // e.g. "Material"
+	Type       string    `gorm:"type:varchar(20);not null" json:"type"`                                               // text, number, boolean, select
+	Unit       string    `gorm:"type:varchar(20)" json:"unit"`                                                        // e.g. "kg", shown with numbers
+	Options    []string  `gorm:"type:jsonb;serializer:json" json:"options,omitempty"`                                 // allowed values of a select
+	Required   bool      `gorm:"not null" json:"required"`
+	Filterable bool      `gorm:"not null" json:"filterable"` // offered as a product filter and facet
+	Position   int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Category *Category `gorm:"foreignKey:CategoryID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// migrateProductAttributes gives every product an attributes object and
+// indexes it for containment filters
+func migrateProductAttributes() {
+	statements := []string{
+		`UPDATE products SET attributes = '{}' WHERE attributes IS NULL OR jsonb_typeof(attributes) <> 'object'`,
+		`CREATE INDEX IF NOT EXISTS idx_products_attributes ON products USING GIN (attributes jsonb_path_ops)`,
+	}
+	for _, stmt := range statements {
+		if err := config.DB.Exec(stmt).Error; err != nil {
+			log.Fatal("❌ Product attribute migration failed: ", err)
+		}
+	}
+}
@@ -8,9 +8,11 @@ type CartItem struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID    uint      `gorm:"not null" json:"user_id"`
 	ProductID uint      `gorm:"not null" json:"product_id"`
+	VariantID uint      `gorm:"index" json:"variant_id"`
 	Quantity  int       `gorm:"not null;default:1" json:"quantity"`
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
-	Product Product `gorm:"foreignKey:ProductID" json:"product"` // preload for API
+	Product Product        `gorm:"foreignKey:ProductID" json:"product"` // preload for API
+	Variant ProductVariant `gorm:"foreignKey:VariantID" json:"variant"`
 }
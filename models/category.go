@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"gorm.io/gorm"
+)
+
+// Category is a node in the product taxonomy. Root categories have no parent.
+type Category struct {
+	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	ParentID    *uint          `gorm:"index" json:"parent_id"`
+	Name        string         `gorm:"type:varchar(100);not null" json:"name"`
+	Slug        string         `gorm:"type:varchar(120);uniqueIndex;not null" json:"slug"`
+	Description string         `gorm:"type:text" json:"description"`
+	ImageURL    string         `gorm:"type:text" json:"image_url"`
+	Position    int            `gorm:"not null;default:0" json:"position"` // order among siblings
+	CreatedAt   time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Parent   *Category  `gorm:"foreignKey:ParentID" json:"-"`
+	Children []Category `gorm:"-" json:"children,omitempty"` // filled in when building the tree
+}
+
+// Slugify turns a name into a URL-safe slug, e.g. "Men's T-Shirts" -> "mens-t-shirts"
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+			dash = false
+		case r == '\'' || r == '’':
+			// drop apostrophes instead of splitting the word
+		case !dash && b.Len() > 0:
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// UniqueCategorySlug returns base, or base-2, base-3... when it is taken
+// (soft-deleted categories included, since the index covers them).
+func UniqueCategorySlug(db *gorm.DB, base string, exceptID uint) string {
+	if base == "" {
+		base = "category"
+	}
+
+	slug := base
+	for n := 2; ; n++ {
+		var count int64
+		db.Unscoped().Model(&Category{}).Where("slug = ? AND id <> ?", slug, exceptID).Count(&count)
+		if count == 0 {
+			return slug
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// EnsureProductCategories turns free-text product categories that aren't
+// linked yet into root categories, merging spellings that differ only in case
+// or surrounding spaces, and links the products to them.
+func EnsureProductCategories(db *gorm.DB) error {
+	var names []string
+	if err := db.Unscoped().Model(&Product{}).
+		Where("category_id IS NULL AND trim(coalesce(category, '')) <> ''").
+		Distinct().Pluck("trim(category)", &names).Error; err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		var category Category
+		err := db.Where("parent_id IS NULL AND lower(name) = lower(?)", name).First(&category).Error
+		if err != nil {
+			category = Category{Name: name, Slug: UniqueCategorySlug(db, Slugify(name), 0)}
+			if err := db.Create(&category).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := db.Unscoped().Model(&Product{}).
+			Where("category_id IS NULL AND lower(trim(category)) = lower(?)", name).
+			Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateCategories moves the old free-text product categories into the taxonomy
+func migrateCategories() {
+	if err := EnsureProductCategories(config.DB); err != nil {
+		log.Fatal("❌ Category migration failed: ", err)
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmailChangeRequest tracks one change of a user's email, from request to
+// confirmation and the window in which the old address can revert it
+type EmailChangeRequest struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          uint       `gorm:"not null;index" json:"user_id"`
+	OldEmail        string     `gorm:"type:varchar(255);not null" json:"old_email"`
+	NewEmail        string     `gorm:"type:varchar(255);not null" json:"new_email"`
+	Status          string     `gorm:"type:varchar(20);not null;default:pending;index" json:"status"` // pending, cancelled, confirmed, reverted
+	RevertToken     string     `gorm:"type:varchar(255);index" json:"-"`                              // sha256 of the token mailed to the old address
+	RevertExpiresAt *time.Time `json:"revert_expires_at,omitempty"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	RevertedAt      *time.Time `json:"reverted_at,omitempty"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
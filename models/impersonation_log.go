@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ImpersonationLog records an impersonation token being issued and every
+// request made with it
+type ImpersonationLog struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AdminID    uint      `gorm:"not null;index" json:"admin_id"`
+	UserID     uint      `gorm:"not null;index" json:"user_id"`
+	TokenJTI   string    `gorm:"type:varchar(64);index" json:"token_jti"`
+	Action     string    `gorm:"type:varchar(20);not null" json:"action"` // issued, request, blocked
+	Method     string    `gorm:"type:varchar(10)" json:"method,omitempty"`
+	Path       string    `gorm:"type:text" json:"path,omitempty"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Reason     string    `gorm:"type:text" json:"reason,omitempty"` // why support started impersonating
+	IPAddress  string    `gorm:"type:varchar(64)" json:"ip_address"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
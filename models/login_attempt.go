@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginAttempt is one entry of the login audit trail
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    *uint     `gorm:"index;index:idx_login_attempts_user_success,priority:1" json:"user_id"` // nil when the email is unknown
+	Email     string    `gorm:"type:varchar(255);index" json:"email"`
+	IPAddress string    `gorm:"type:varchar(64)" json:"ip_address"`
+	UserAgent string    `gorm:"type:text" json:"user_agent"`
+	Success   bool      `gorm:"not null;index:idx_login_attempts_user_success,priority:2" json:"success"`
+	Reason    string    `gorm:"type:varchar(50)" json:"reason"` // e.g. bad_password, locked, password, magic_link, 2fa
+	CreatedAt time.Time `gorm:"autoCreateTime;index;index:idx_login_attempts_user_success,priority:3" json:"created_at"`
+}
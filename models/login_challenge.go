@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginChallenge tracks one challenge token of a multi-step login, so it can
+// be used once and only guessed at a few times
+type LoginChallenge struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	JTI       string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"jti"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Attempts  int        `gorm:"not null;default:0" json:"attempts"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	ExpiresAt time.Time  `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
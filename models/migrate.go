@@ -10,7 +10,16 @@ func Migrate() {
 	err := config.DB.AutoMigrate(
 		&User{},
 		&OTP{},
+		&Category{},
+		&AttributeDefinition{},
 		&Product{},
+		&OptionType{},
+		&OptionValue{},
+		&ProductVariant{},
+		&PriceHistory{},
+		&PriceSchedule{},
+		&ProductImage{},
+		&ProductImportJob{},
 		&ProductProduction{},
 		&CartItem{},
 		&WishlistItem{},
@@ -18,11 +27,34 @@ func Migrate() {
 		&OrderItem{},
 		&RefreshToken{},
 		&Payment{},
+		&RevokedAccessToken{},
+		&LoginChallenge{},
+		&UserTwoFactor{},
+		&RecoveryCode{},
+		&StoreSetting{},
+		&UserIdentity{},
+		&PasswordHistory{},
+		&LoginAttempt{},
+		&EmailChangeRequest{},
+		&Permission{},
+		&Role{},
+		&ServiceAccount{},
+		&APIKey{},
+		&ImpersonationLog{},
+		&Review{},
+		&ReviewPhoto{},
+		&ReviewVote{},
 	)
 
 	if err != nil {
 		log.Fatal("❌ Migration failed: ", err)
 	}
 
+	migrateProductVariants()
+	migratePriceHistory()
+	migrateCategories()
+	migrateProductSearch()
+	migrateProductAttributes()
+
 	log.Println("✅ All tables migrated successfully")
 }
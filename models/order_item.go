@@ -10,12 +10,15 @@ type OrderItem struct {
 	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	OrderID   uint           `gorm:"not null" json:"order_id"`
 	ProductID uint           `gorm:"not null" json:"product_id"`
+	VariantID uint           `gorm:"index" json:"variant_id"`
+	SKU       string         `gorm:"type:varchar(64)" json:"sku"` // as sold, in case the variant changes later
 	Quantity  int            `gorm:"not null" json:"quantity"`
 	Price     float64        `gorm:"not null" json:"price"`
 	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 
 	// Relations
-	Order   Order   `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"order"`
-	Product Product `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product"`
+	Order   Order          `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"order"`
+	Product Product        `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"product"`
+	Variant ProductVariant `gorm:"foreignKey:VariantID" json:"variant"`
 }
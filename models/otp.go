@@ -5,9 +5,11 @@ import "time"
 type OTP struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
 	UserID    uint      `gorm:"not null" json:"user_id"`
-	OTPCode   string    `gorm:"type:varchar(10);not null" json:"otp_code"`
+	OTPCode   string    `gorm:"type:varchar(255);not null" json:"-"` // bcrypt hash, never the plain code
 	ExpiresAt time.Time `gorm:"not null" json:"expires_at"`
 	Purpose   string    `gorm:"type:varchar(50);not null" json:"purpose"`
+	SentTo    string    `gorm:"type:varchar(255)" json:"-"`            // address the code was mailed to
+	Attempts  int       `gorm:"default:0;not null" json:"attempts"`    // failed guesses so far
 	IsUsed    bool      `gorm:"default:false;not null" json:"is_used"` // ✅ new
 	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// PasswordHistory remembers a user's previous passwords (hashed) to block reuse
+type PasswordHistory struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	PasswordHash string    `gorm:"type:varchar(255);not null" json:"-"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
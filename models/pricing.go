@@ -0,0 +1,56 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"gorm.io/gorm"
+)
+
+// PriceHistory records every change to a variant's regular or compare-at
+// price. Together with PriceSchedule it shows what any SKU cost at any time.
+type PriceHistory struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID uint      `gorm:"not null;index" json:"product_id"`
+	VariantID uint      `gorm:"not null;index:idx_price_history_variant_time" json:"variant_id"`
+	Field     string    `gorm:"type:varchar(20);not null" json:"field"` // price, compare_at_price
+	OldValue  *float64  `gorm:"type:decimal(10,2)" json:"old_value"`
+	NewValue  *float64  `gorm:"type:decimal(10,2)" json:"new_value"`
+	ChangedBy *uint     `json:"changed_by,omitempty"`                    // admin user, if a person made the change
+	Source    string    `gorm:"type:varchar(30);not null" json:"source"` // admin, import, initial
+	CreatedAt time.Time `gorm:"autoCreateTime;index:idx_price_history_variant_time" json:"created_at"`
+}
+
+// PriceSchedule is a sale: a fixed price or a percentage off for one variant,
+// or every variant of the product, between StartsAt and EndsAt. Sales are
+// cancelled rather than deleted so the history stays complete.
+type PriceSchedule struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID   uint       `gorm:"not null;index" json:"product_id"`
+	VariantID   *uint      `gorm:"index" json:"variant_id"` // nil applies to all variants
+	SalePrice   *float64   `gorm:"type:decimal(10,2)" json:"sale_price,omitempty"`
+	PercentOff  *float64   `gorm:"type:decimal(5,2)" json:"percent_off,omitempty"`
+	StartsAt    time.Time  `gorm:"not null;index" json:"starts_at"`
+	EndsAt      *time.Time `gorm:"index" json:"ends_at"` // nil runs until cancelled
+	Note        string     `gorm:"type:varchar(255)" json:"note"`
+	CreatedBy   *uint      `json:"created_by,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	CancelledBy *uint      `json:"cancelled_by,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// EnsurePriceHistory starts the history of variants that have none at their
+// current price
+func EnsurePriceHistory(db *gorm.DB) error {
+	return db.Exec(`INSERT INTO price_histories (product_id, variant_id, field, new_value, source, created_at)
+		SELECT v.product_id, v.id, 'price', v.price, 'initial', v.created_at
+		FROM product_variants v
+		WHERE NOT EXISTS (SELECT 1 FROM price_histories h WHERE h.variant_id = v.id AND h.field = 'price')`).Error
+}
+
+func migratePriceHistory() {
+	if err := EnsurePriceHistory(config.DB); err != nil {
+		log.Fatal("❌ Price history migration failed: ", err)
+	}
+}
@@ -7,14 +7,24 @@ import (
 )
 
 type Product struct {
-	ID            uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	Name          string         `gorm:"type:varchar(255);not null" json:"name"`
-	Description   string         `gorm:"type:text" json:"description"`
-	Price         float64        `gorm:"type:decimal(10,2);not null" json:"price"`
-	StockQuantity int            `gorm:"not null;default:0" json:"stock_quantity"`
-	Category      string         `gorm:"type:varchar(100)" json:"category"`
-	ImageURL      string         `gorm:"type:text" json:"image_url"`
-	CreatedAt     time.Time      `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt     time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
-	DeletedAt     gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint                   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name           string                 `gorm:"type:varchar(255);not null" json:"name"`
+	Description    string                 `gorm:"type:text" json:"description"`
+	Price          float64                `gorm:"type:decimal(10,2);not null" json:"price"`   // lowest variant price, sales included
+	CompareAtPrice *float64               `gorm:"type:decimal(10,2)" json:"compare_at_price"` // what the lowest price is reduced from, if it is
+	OnSale         bool                   `gorm:"not null;default:false" json:"on_sale"`
+	StockQuantity  int                    `gorm:"not null;default:0" json:"stock_quantity"` // total stock across variants
+	CategoryID     *uint                  `gorm:"index" json:"category_id"`
+	Category       string                 `gorm:"type:varchar(100)" json:"category"`                          // name of CategoryID, kept for search and older clients
+	ImageURL       string                 `gorm:"type:text" json:"image_url"`                                 // main gallery image once one is uploaded
+	RatingAverage  float64                `gorm:"type:decimal(3,2);not null;default:0" json:"rating_average"` // over approved reviews
+	ReviewCount    int                    `gorm:"not null;default:0" json:"review_count"`
+	Attributes     map[string]interface{} `gorm:"type:jsonb;serializer:json;not null;default:'{}'" json:"attributes"` // values of the category's AttributeDefinitions, by code
+	CreatedAt      time.Time              `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time              `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt         `gorm:"index" json:"-"`
+
+	OptionTypes []OptionType     `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"option_types,omitempty"`
+	Variants    []ProductVariant `gorm:"foreignKey:ProductID" json:"variants,omitempty"`
+	Images      []ProductImage   `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"images,omitempty"`
 }
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ProductImage is one picture in a product's gallery. Files live in storage
+// under Key and ThumbnailKey and are served by the API at URL and ThumbnailURL.
+type ProductImage struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID    uint      `gorm:"not null;index" json:"product_id"`
+	Key          string    `gorm:"type:varchar(255);not null" json:"-"`
+	ThumbnailKey string    `gorm:"type:varchar(255);not null" json:"-"`
+	URL          string    `gorm:"type:text;not null" json:"url"`
+	ThumbnailURL string    `gorm:"type:text;not null" json:"thumbnail_url"`
+	ContentType  string    `gorm:"type:varchar(50);not null" json:"content_type"`
+	Width        int       `gorm:"not null" json:"width"`
+	Height       int       `gorm:"not null" json:"height"`
+	SizeBytes    int64     `gorm:"not null" json:"size_bytes"`
+	AltText      string    `gorm:"type:varchar(255)" json:"alt_text"`
+	Position     int       `gorm:"not null;default:0" json:"position"` // 0 is the main image
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ProductImportJob tracks one spreadsheet import, run inline for small files
+// or in the background for large ones
+type ProductImportJob struct {
+	ID               uint             `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID           *uint            `gorm:"index" json:"user_id,omitempty"`            // admin who uploaded the file
+	ServiceAccountID *uint            `gorm:"index" json:"service_account_id,omitempty"` // or the API key's service account
+	Filename         string           `gorm:"type:varchar(255)" json:"filename"`
+	Format           string           `gorm:"type:varchar(10);not null" json:"format"` // csv, xlsx
+	DryRun           bool             `gorm:"not null;default:false" json:"dry_run"`
+	Status           string           `gorm:"type:varchar(20);not null;index" json:"status"` // pending, running, completed, failed
+	TotalRows        int              `gorm:"not null;default:0" json:"total_rows"`
+	ProcessedRows    int              `gorm:"not null;default:0" json:"processed_rows"`
+	CreatedCount     int              `gorm:"not null;default:0" json:"created"`
+	UpdatedCount     int              `gorm:"not null;default:0" json:"updated"`
+	FailedCount      int              `gorm:"not null;default:0" json:"failed"`
+	Errors           []ImportRowError `gorm:"type:jsonb;serializer:json" json:"errors"`
+	Error            string           `gorm:"type:text" json:"error,omitempty"` // why the whole job failed
+	StartedAt        *time.Time       `json:"started_at"`
+	FinishedAt       *time.Time       `json:"finished_at"`
+	CreatedAt        time.Time        `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt        time.Time        `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// ImportRowError is a row that was rejected; Row is the line in the file,
+// counting the header as line 1
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	SKU     string `json:"sku,omitempty"`
+	Message string `json:"message"`
+}
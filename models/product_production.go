@@ -9,6 +9,7 @@ import (
 type ProductProduction struct {
 	ID          uint           `gorm:"primaryKey;autoIncrement" json:"id"`
 	ProductID   uint           `gorm:"not null" json:"product_id"`
+	VariantID   uint           `gorm:"index" json:"variant_id"`
 	Status      string         `gorm:"type:varchar(50);not null" json:"status"` // pending, in_progress, completed
 	StartedAt   time.Time      `gorm:"autoCreateTime" json:"started_at"`
 	CompletedAt *time.Time     `json:"completed_at"`
@@ -16,5 +17,6 @@ type ProductProduction struct {
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relation
-	Product Product `gorm:"foreignKey:ProductID" json:"product"`
+	Product Product        `gorm:"foreignKey:ProductID" json:"product"`
+	Variant ProductVariant `gorm:"foreignKey:VariantID" json:"variant"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"log"
+
+	"github.com/mahi-qwe/ecommerce-backend/config"
+)
+
+// migrateProductSearch adds the full-text search column and indexes on
+// products. The tsvector is a generated column, so it never goes stale:
+// name weighs most (A), then category (B), then description (C).
+func migrateProductSearch() {
+	// Typo tolerance needs pg_trgm; search still works without it
+	if err := config.DB.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Println("⚠️ pg_trgm not available, product search will not tolerate typos:", err)
+	}
+
+	statements := []string{
+		`ALTER TABLE products ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('english'::regconfig, coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('english'::regconfig, coalesce(category, '')), 'B') ||
+				setweight(to_tsvector('english'::regconfig, coalesce(description, '')), 'C')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_products_search_vector ON products USING GIN (search_vector)`,
+	}
+	for _, stmt := range statements {
+		if err := config.DB.Exec(stmt).Error; err != nil {
+			log.Fatal("❌ Product search migration failed: ", err)
+		}
+	}
+
+	if err := config.DB.Exec(`CREATE INDEX IF NOT EXISTS idx_products_name_trgm ON products USING GIN (name gin_trgm_ops)`).Error; err != nil {
+		log.Println("⚠️ Could not create trigram index on products.name:", err)
+	}
+}
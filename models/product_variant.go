@@ -0,0 +1,103 @@
+package models
+
+import (
+	"log"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/config"
+	"gorm.io/gorm"
+)
+
+// OptionType is a way a product varies, e.g. "size" or "color"
+type OptionType struct {
+	ID        uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID uint          `gorm:"not null;uniqueIndex:idx_option_type_product_name" json:"product_id"`
+	Name      string        `gorm:"type:varchar(50);not null;uniqueIndex:idx_option_type_product_name" json:"name"`
+	Position  int           `gorm:"not null;default:0" json:"position"`
+	Values    []OptionValue `gorm:"foreignKey:OptionTypeID;constraint:OnDelete:CASCADE" json:"values"`
+	CreatedAt time.Time     `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// OptionValue is one choice of an option type, e.g. "M" or "red"
+type OptionValue struct {
+	ID           uint        `gorm:"primaryKey;autoIncrement" json:"id"`
+	OptionTypeID uint        `gorm:"not null;uniqueIndex:idx_option_value_type_value" json:"option_type_id"`
+	Value        string      `gorm:"type:varchar(100);not null;uniqueIndex:idx_option_value_type_value" json:"value"`
+	Position     int         `gorm:"not null;default:0" json:"position"`
+	OptionType   *OptionType `gorm:"foreignKey:OptionTypeID" json:"option_type,omitempty"`
+}
+
+// ProductVariant is a sellable SKU of a product with its own price and stock.
+// Every product has at least one; the default variant is used when a request
+// names only the product.
+type ProductVariant struct {
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID      uint           `gorm:"not null;index" json:"product_id"`
+	SKU            string         `gorm:"type:varchar(64);uniqueIndex;not null" json:"sku"`
+	Price          float64        `gorm:"type:decimal(10,2);not null" json:"price"`   // regular price, before any sale
+	CompareAtPrice *float64       `gorm:"type:decimal(10,2)" json:"compare_at_price"` // "was" price shown struck through
+	StockQuantity  int            `gorm:"not null;default:0" json:"stock_quantity"`
+	ImageURL       string         `gorm:"type:text" json:"image_url"` // empty falls back to the product image
+	Barcode        string         `gorm:"type:varchar(64);index" json:"barcode"`
+	IsDefault      bool           `gorm:"not null;default:false" json:"is_default"`
+	OptionValues   []OptionValue  `gorm:"many2many:variant_option_values;constraint:OnDelete:CASCADE" json:"option_values"`
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Product *Product `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+
+	// Filled in from the price schedules when a variant is shown or sold
+	EffectivePrice float64    `gorm:"-" json:"effective_price"`
+	SalePrice      *float64   `gorm:"-" json:"sale_price,omitempty"`
+	SaleEndsAt     *time.Time `gorm:"-" json:"sale_ends_at,omitempty"`
+}
+
+// Options returns the variant's choices by option name, e.g. {"size": "M"}.
+// OptionValues.OptionType must be preloaded.
+func (v ProductVariant) Options() map[string]string {
+	options := make(map[string]string, len(v.OptionValues))
+	for _, ov := range v.OptionValues {
+		if ov.OptionType != nil {
+			options[ov.OptionType.Name] = ov.Value
+		}
+	}
+	return options
+}
+
+// VariantOptionsPreload loads a variant's option values with their names
+const VariantOptionsPreload = "OptionValues.OptionType"
+
+// EnsureDefaultVariants gives every product without variants a default one
+// carrying the product's price, stock and image, then points cart, wishlist,
+// order and production rows that only name a product at that variant.
+func EnsureDefaultVariants(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO product_variants
+				(product_id, sku, price, stock_quantity, image_url, barcode, is_default, created_at, updated_at, deleted_at)
+			SELECT p.id, 'P' || lpad(p.id::text, greatest(6, length(p.id::text)), '0'), p.price, p.stock_quantity, '', '', true, now(), now(), p.deleted_at
+			FROM products p
+			WHERE NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id)`).Error; err != nil {
+			return err
+		}
+
+		for _, table := range []string{"cart_items", "wishlist_items", "order_items", "product_productions"} {
+			if err := tx.Exec(`UPDATE ` + table + ` t SET variant_id = v.id
+				FROM product_variants v
+				WHERE v.product_id = t.product_id AND v.is_default AND t.variant_id IS NULL`).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec(`UPDATE order_items t SET sku = v.sku
+			FROM product_variants v
+			WHERE v.id = t.variant_id AND coalesce(t.sku, '') = ''`).Error
+	})
+}
+
+// migrateProductVariants moves products from before variants onto a default variant
+func migrateProductVariants() {
+	if err := EnsureDefaultVariants(config.DB); err != nil {
+		log.Fatal("❌ Product variant migration failed: ", err)
+	}
+}
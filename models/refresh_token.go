@@ -7,11 +7,17 @@ import (
 )
 
 type RefreshToken struct {
-	ID        uint      `gorm:"primaryKey"`
-	UserID    uint      `gorm:"not null"`        // Foreign key to users
-	Token     string    `gorm:"not null;unique"` // Hashed token
-	ExpiresAt time.Time `gorm:"not null"`        // Expiration
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"` // Soft delete
+	ID          uint       `gorm:"primaryKey"`
+	UserID      uint       `gorm:"not null"`               // Foreign key to users
+	Token       string     `gorm:"not null;unique"`        // Hashed token
+	FamilyID    string     `gorm:"type:varchar(64);index"` // Shared by every token rotated from the same login
+	UsedAt      *time.Time // Set once the token has been exchanged for a new one
+	UserAgent   string     `gorm:"type:text"`         // Client that holds the session
+	IPAddress   string     `gorm:"type:varchar(64)"`  // Last IP the session was used from
+	DeviceLabel string     `gorm:"type:varchar(100)"` // Human readable device, e.g. "Chrome on Windows"
+	LastUsedAt  *time.Time // Last time the session was refreshed
+	ExpiresAt   time.Time  `gorm:"not null"` // Expiration
+	CreatedAt   time.Time  // When the session (login) started, kept across rotations
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"` // Soft delete
 }
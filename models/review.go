@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Review is a rating left by a customer who received the product. Only
+// approved reviews are shown and counted in the product's rating.
+type Review struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	ProductID      uint       `gorm:"not null;uniqueIndex:idx_review_product_user" json:"product_id"`
+	UserID         uint       `gorm:"not null;uniqueIndex:idx_review_product_user;index" json:"user_id"` // one review per user per product
+	OrderItemID    uint       `gorm:"not null" json:"order_item_id"`                                     // the delivered purchase that allows it
+	Rating         int        `gorm:"not null;check:rating BETWEEN 1 AND 5" json:"rating"`
+	Title          string     `gorm:"type:varchar(150)" json:"title"`
+	Body           string     `gorm:"type:text" json:"body"`
+	Status         string     `gorm:"type:varchar(20);not null;default:'pending';index" json:"status"` // pending, approved, rejected
+	ModerationNote string     `gorm:"type:text" json:"moderation_note,omitempty"`
+	ModeratedBy    *uint      `json:"moderated_by,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+	HelpfulCount   int        `gorm:"not null;default:0" json:"helpful_count"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+
+	Photos  []ReviewPhoto `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE" json:"photos"`
+	User    *User         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE" json:"-"`
+	Product *Product      `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ReviewPhoto is an image attached to a review
+type ReviewPhoto struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ReviewID     uint      `gorm:"not null;index" json:"-"`
+	Key          string    `gorm:"type:text;not null" json:"-"`
+	ThumbnailKey string    `gorm:"type:text" json:"-"`
+	URL          string    `gorm:"type:text;not null" json:"url"`
+	ThumbnailURL string    `gorm:"type:text" json:"thumbnail_url"`
+	Position     int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// ReviewVote is a user marking a review as helpful
+type ReviewVote struct {
+	ReviewID  uint      `gorm:"primaryKey" json:"review_id"`
+	UserID    uint      `gorm:"primaryKey;index" json:"user_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	Review *Review `gorm:"foreignKey:ReviewID;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RevokedAccessToken deny-lists a single access token (by jti) until it would have expired anyway
+type RevokedAccessToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	JTI       string    `gorm:"type:varchar(64);uniqueIndex;not null" json:"jti"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
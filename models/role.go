@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Role is a named set of permissions; User.Role holds the role name
+type Role struct {
+	ID          uint         `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string       `gorm:"type:varchar(50);uniqueIndex;not null" json:"name"`
+	Description string       `gorm:"type:text" json:"description"`
+	IsSystem    bool         `gorm:"default:false;not null" json:"is_system"` // seeded roles can't be deleted
+	Permissions []Permission `gorm:"many2many:role_permissions;" json:"permissions"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Permission is a single action on a resource, e.g. "orders:update"
+type Permission struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+}
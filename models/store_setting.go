@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// StoreSetting is a key/value setting admins can change at runtime
+type StoreSetting struct {
+	Key       string    `gorm:"primaryKey;type:varchar(100)" json:"key"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// UserTwoFactor holds a user's TOTP authenticator. Enabled stays false until
+// the user proves the authenticator works by entering a first code.
+type UserTwoFactor struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       uint       `gorm:"uniqueIndex;not null" json:"user_id"`
+	Secret       string     `gorm:"type:varchar(64);not null" json:"-"`
+	Enabled      bool       `gorm:"default:false;not null" json:"enabled"`
+	ConfirmedAt  *time.Time `json:"confirmed_at"`
+	LastUsedStep int64      `gorm:"default:0;not null" json:"-"` // last accepted time step, blocks code replay
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -15,7 +15,11 @@ type User struct {
 	IsBlocked    bool           `gorm:"default:false;not null" json:"is_blocked"`
 	IsVerified   bool           `gorm:"default:false;not null" json:"is_verified"` // ✅ new
 	AvatarURL    *string        `gorm:"type:text" json:"avatar_url,omitempty"`
+	AvatarKeys   string         `gorm:"type:text" json:"-"` // storage keys of an uploaded avatar, space separated
 	Address      string         `gorm:"type:text" json:"address"`
+	TokenVersion int            `gorm:"not null;default:0" json:"-"` // bumped to invalidate issued access tokens
+	LockedUntil  *time.Time     `json:"locked_until,omitempty"`      // login is refused until then
+	LockoutCount int            `gorm:"not null;default:0" json:"-"` // consecutive lockouts, makes each one longer
 	CreatedAt    time.Time      `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt    time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"` // soft delete
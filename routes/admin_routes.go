@@ -8,13 +8,38 @@ import (
 
 func AdminRoutes(r *gin.Engine) {
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware()) // protect with JWT + admin role
+	admin.Use(middlewares.AuthMiddleware(middlewares.WithAPIKeys())) // every route below also checks a permission
+	// Routes acting on one user also refuse targets whose role outranks the caller's
 	{
-		admin.PUT("/users/:id", controllers.UpdateUserHandler)
-		admin.POST("/users/:id/block", controllers.BlockUserHandler)
-		admin.POST("/users/:id/unblock", controllers.UnblockUserHandler)
-		admin.GET("/users", controllers.GetAllUsersHandler)
-		admin.GET("/users/:id", controllers.GetUserByIDHandler)
-		admin.DELETE("/users/:id", controllers.DeleteUserHandler)
+		admin.PUT("/users/:id", middlewares.RequirePermission("users:update"), middlewares.RequireTargetWithinRank(), controllers.UpdateUserHandler)
+		admin.POST("/users/:id/block", middlewares.RequirePermission("users:block"), middlewares.RequireTargetWithinRank(), controllers.BlockUserHandler)
+		admin.POST("/users/:id/unblock", middlewares.RequirePermission("users:block"), middlewares.RequireTargetWithinRank(), controllers.UnblockUserHandler)
+		admin.POST("/users/:id/unlock", middlewares.RequirePermission("users:block"), middlewares.RequireTargetWithinRank(), controllers.UnlockUserHandler) // lift a login lockout
+		admin.GET("/users", middlewares.RequirePermission("users:read"), controllers.GetAllUsersHandler)
+		admin.GET("/users/:id", middlewares.RequirePermission("users:read"), controllers.GetUserByIDHandler)
+		admin.DELETE("/users/:id", middlewares.RequirePermission("users:delete"), middlewares.RequireTargetWithinRank(), controllers.DeleteUserHandler)
+		admin.GET("/users/:id/sessions", middlewares.RequirePermission("users:read"), controllers.AdminGetUserSessionsHandler)
+		admin.DELETE("/users/:id/sessions", middlewares.RequirePermission("sessions:revoke"), middlewares.RequireTargetWithinRank(), controllers.AdminRevokeUserSessionsHandler) // force logout everywhere
+		admin.GET("/login-attempts", middlewares.RequirePermission("audit:read"), controllers.GetLoginAttemptsHandler)
+		admin.POST("/users/:id/impersonate", middlewares.DenyImpersonation(), middlewares.RequirePermission("users:impersonate"), controllers.ImpersonateUserHandler)
+		admin.GET("/impersonation-logs", middlewares.RequirePermission("audit:read"), controllers.GetImpersonationLogsHandler)
+
+		admin.GET("/settings", middlewares.RequirePermission("settings:read"), controllers.GetSettingsHandler)
+		admin.PUT("/settings/:key", middlewares.RequirePermission("settings:update"), controllers.UpdateSettingHandler) // e.g. require_2fa_roles
+
+		// Roles and permissions
+		admin.GET("/permissions", middlewares.RequirePermission("roles:read"), controllers.GetPermissionsHandler)
+		admin.GET("/roles", middlewares.RequirePermission("roles:read"), controllers.GetRolesHandler)
+		admin.POST("/roles", middlewares.RequirePermission("roles:manage"), controllers.CreateRoleHandler)
+		admin.PUT("/roles/:id", middlewares.RequirePermission("roles:manage"), controllers.UpdateRoleHandler)
+		admin.DELETE("/roles/:id", middlewares.RequirePermission("roles:manage"), controllers.DeleteRoleHandler)
+
+		// Service accounts and their API keys
+		admin.GET("/service-accounts", middlewares.RequirePermission("api_keys:manage"), controllers.GetServiceAccountsHandler)
+		admin.POST("/service-accounts", middlewares.RequirePermission("api_keys:manage"), controllers.CreateServiceAccountHandler)
+		admin.DELETE("/service-accounts/:id", middlewares.RequirePermission("api_keys:manage"), controllers.DeleteServiceAccountHandler)
+		admin.GET("/service-accounts/:id/api-keys", middlewares.RequirePermission("api_keys:manage"), controllers.GetAPIKeysHandler)
+		admin.POST("/service-accounts/:id/api-keys", middlewares.RequirePermission("api_keys:manage"), controllers.CreateAPIKeyHandler)
+		admin.DELETE("/api-keys/:id", middlewares.RequirePermission("api_keys:manage"), controllers.RevokeAPIKeyHandler)
 	}
 }
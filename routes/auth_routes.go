@@ -1,20 +1,55 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/controllers"
+	"github.com/mahi-qwe/ecommerce-backend/middlewares"
 )
 
 func AuthRoutes(r *gin.Engine) {
+	// Login: slow down credential stuffing per IP and per targeted account
+	loginIPLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "login-ip", Limit: 20, Window: time.Minute, Key: middlewares.KeyByIP()})
+	loginEmailLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "login-email", Limit: 5, Window: 15 * time.Minute, Key: middlewares.KeyByJSONField("email")})
+
+	// Anything that sends an email: protect inboxes and the SMTP quota
+	mailIPLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "mail-ip", Limit: 20, Window: time.Hour, Key: middlewares.KeyByIP()})
+	mailEmailLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "mail-email", Limit: 5, Window: time.Hour, Key: middlewares.KeyByJSONField("email")})
+
+	// Magic links get their own, tighter budget on top of the mail limits
+	magicLinkEmailLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "magic-link-email", Limit: 3, Window: 15 * time.Minute, Key: middlewares.KeyByJSONField("email")})
+	magicLinkIPLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "magic-link-ip", Limit: 10, Window: time.Hour, Key: middlewares.KeyByIP()})
+
+	// Second factor: a challenge token only gets a handful of guesses
+	twoFactorLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "2fa-challenge", Limit: 5, Window: 5 * time.Minute, Key: middlewares.KeyByJSONField("challenge_token")})
+
 	auth := r.Group("/auth")
 	{
-		auth.POST("/signup", controllers.SignupHandler) //✅
-		auth.POST("/login", controllers.LoginHandler)   //✅
+		auth.POST("/signup", controllers.SignupHandler)                              //✅
+		auth.POST("/login", loginIPLimit, loginEmailLimit, controllers.LoginHandler) //✅
 		// auth.POST("/send-otp", controllers.SendOTPHandler)
-		auth.POST("/verify-otp", controllers.VerifyOTPHandler)           //✅
-		auth.POST("/forgot-password", controllers.ForgotPasswordHandler) //✅
-		auth.POST("/reset-password", controllers.ResetPasswordHandler)   //✅
-		auth.POST("/resend-otp", controllers.ResendOTPHandler)           //✅
+		auth.POST("/verify-otp", controllers.VerifyOTPHandler)                                        //✅
+		auth.POST("/forgot-password", mailIPLimit, mailEmailLimit, controllers.ForgotPasswordHandler) //✅
+		auth.POST("/reset-password", controllers.ResetPasswordHandler)                                //✅
+		auth.POST("/resend-otp", mailIPLimit, mailEmailLimit, controllers.ResendOTPHandler)           //✅
+
+		// Two-factor login step
+		auth.POST("/2fa/verify", loginIPLimit, twoFactorLimit, controllers.VerifyTwoFactorLoginHandler)
+		auth.POST("/2fa/setup", loginIPLimit, controllers.SetupTwoFactorLoginHandler)
+		auth.POST("/2fa/setup/confirm", loginIPLimit, twoFactorLimit, controllers.ConfirmTwoFactorLoginHandler)
+
+		// Passwordless login
+		auth.POST("/magic-link", magicLinkIPLimit, magicLinkEmailLimit, mailIPLimit, mailEmailLimit, controllers.RequestMagicLinkHandler)
+		auth.POST("/magic-link/consume", loginIPLimit, controllers.ConsumeMagicLinkHandler)
+
+		// Social login (OAuth2 / OpenID Connect)
+		auth.GET("/oauth/:provider/login", loginIPLimit, controllers.OAuthLoginHandler)
+		auth.GET("/oauth/:provider/callback", loginIPLimit, controllers.OAuthCallbackHandler)
+		auth.POST("/oauth/exchange", loginIPLimit, controllers.OAuthExchangeHandler)
+
+		// Undo an email change from the link sent to the old address
+		auth.POST("/email/revert", loginIPLimit, controllers.RevertEmailChangeHandler)
 
 		// New refresh token endpoints
 		auth.POST("/refresh", controllers.RefreshTokenHandler) //✅
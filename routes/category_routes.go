@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/controllers"
+	"github.com/mahi-qwe/ecommerce-backend/middlewares"
+)
+
+func CategoryRoutes(r *gin.Engine) {
+	admin := r.Group("/admin/categories")
+	admin.Use(middlewares.AuthMiddleware(middlewares.WithAPIKeys()))
+	{
+		admin.POST("", middlewares.RequirePermission("products:write"), controllers.CreateCategoryHandler)
+		admin.PUT("/:id", middlewares.RequirePermission("products:write"), controllers.UpdateCategoryHandler)
+		admin.DELETE("/:id", middlewares.RequirePermission("products:write"), controllers.DeleteCategoryHandler)
+		admin.POST("/:id/attributes", middlewares.RequirePermission("products:write"), controllers.CreateAttributeHandler)
+		admin.PUT("/:id/attributes/:attribute_id", middlewares.RequirePermission("products:write"), controllers.UpdateAttributeHandler)
+		admin.DELETE("/:id/attributes/:attribute_id", middlewares.RequirePermission("products:write"), controllers.DeleteAttributeHandler)
+	}
+
+	public := r.Group("/categories")
+	{
+		public.GET("", controllers.GetCategoryTreeHandler)
+		public.GET("/:ref", controllers.GetCategoryHandler) // by id or slug
+		public.GET("/:ref/attributes", controllers.GetCategoryAttributesHandler)
+	}
+}
@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/controllers"
+)
+
+func MediaRoutes(r *gin.Engine) {
+	// Uploaded product images and avatars
+	r.GET("/media/*key", controllers.ServeMediaHandler)
+}
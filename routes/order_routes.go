@@ -10,16 +10,16 @@ func OrderRoutes(r *gin.Engine) {
 	order := r.Group("/order")
 	order.Use(middlewares.AuthMiddleware())
 	{
-		order.POST("", controllers.PlaceOrder) // place an order
+		order.POST("", middlewares.DenyImpersonation(), controllers.PlaceOrder) // place an order
 		order.GET("", controllers.GetUserOrders)
-		order.GET("/:id", controllers.GetOrder)       // GET /order/:id
-		order.DELETE("/:id", controllers.DeleteOrder) // DELETE /order/:id
+		order.GET("/:id", controllers.GetOrder)                                        // GET /order/:id
+		order.DELETE("/:id", middlewares.DenyImpersonation(), controllers.DeleteOrder) // DELETE /order/:id
 	}
 
 	adminOrders := r.Group("/admin/orders")
-	adminOrders.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	adminOrders.Use(middlewares.AuthMiddleware(middlewares.WithAPIKeys()))
 	{
-		adminOrders.GET("", controllers.GetAllOrders) // GET /admin/orders
-		adminOrders.PUT("/:id", controllers.UpdateOrderStatusAdmin)
+		adminOrders.GET("", middlewares.RequirePermission("orders:read"), controllers.GetAllOrders) // GET /admin/orders
+		adminOrders.PUT("/:id", middlewares.RequirePermission("orders:update"), controllers.UpdateOrderStatusAdmin)
 	}
 }
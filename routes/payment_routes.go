@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/controllers"
 	"github.com/mahi-qwe/ecommerce-backend/middlewares"
@@ -10,12 +12,16 @@ func PaymentRoutes(r *gin.Engine) {
 	payments := r.Group("/payments")
 	payments.Use(middlewares.AuthMiddleware())
 	{
-		payments.POST("/create", controllers.CreatePaymentIntent)
+		payments.POST("/create",
+			middlewares.DenyImpersonation(),
+			middlewares.RateLimit(middlewares.RateLimitConfig{Name: "checkout-user", Limit: 10, Window: time.Minute, Key: middlewares.KeyByUserID()}),
+			controllers.CreatePaymentIntent,
+		)
 	}
 
 	adminPayments := r.Group("/admin/payments")
-	adminPayments.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware())
+	adminPayments.Use(middlewares.AuthMiddleware())
 	{
-		payments.PUT("/:payment_id/update", controllers.UpdatePaymentStatus)
+		payments.PUT("/:payment_id/update", middlewares.RequirePermission("payments:update"), controllers.UpdatePaymentStatus)
 	}
 }
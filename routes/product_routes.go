@@ -8,21 +8,41 @@ import (
 
 func ProductRoutes(r *gin.Engine) {
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware(), middlewares.AdminMiddleware()) // protect admin routes
+	admin.Use(middlewares.AuthMiddleware(middlewares.WithAPIKeys())) // protect admin routes
 	{
-		admin.POST("/products", controllers.CreateProductHandler)
-		admin.PUT("/products/:id", controllers.UpdateProductHandler)
-		admin.DELETE("/products/:id", controllers.DeleteProductHandler)
-		admin.POST("/products/:id/production", controllers.StartProductionHandler)              // start production route
-		admin.PUT("/products/:id/production/status", controllers.UpdateProductionStatusHandler) // update production status route
-		admin.GET("/products/:id/production", controllers.GetProductionDetailsHandler)          // get production details route
-		admin.GET("/products/production", controllers.GetAllProductionsHandler)                 // get all productions route
+		admin.POST("/products", middlewares.RequirePermission("products:write"), controllers.CreateProductHandler)
+		admin.POST("/products/import", middlewares.RequirePermission("products:write"), controllers.ImportProductsHandler) // multipart, field "file"
+		admin.GET("/products/import/jobs", middlewares.RequirePermission("products:write"), controllers.GetImportJobsHandler)
+		admin.GET("/products/import/jobs/:id", middlewares.RequirePermission("products:write"), controllers.GetImportJobHandler)
+		admin.GET("/products/export", middlewares.RequirePermission("products:write"), controllers.ExportProductsHandler) // ?format=csv|xlsx
+		admin.PUT("/products/:id", middlewares.RequirePermission("products:write"), controllers.UpdateProductHandler)
+		admin.DELETE("/products/:id", middlewares.RequirePermission("products:write"), controllers.DeleteProductHandler)
+		admin.POST("/products/:id/options", middlewares.RequirePermission("products:write"), controllers.CreateOptionTypeHandler)
+		admin.DELETE("/products/:id/options/:option_id", middlewares.RequirePermission("products:write"), controllers.DeleteOptionTypeHandler)
+		admin.POST("/products/:id/variants", middlewares.RequirePermission("products:write"), controllers.CreateVariantHandler)
+		admin.PUT("/products/:id/variants/:variant_id", middlewares.RequirePermission("products:write"), controllers.UpdateVariantHandler)
+		admin.DELETE("/products/:id/variants/:variant_id", middlewares.RequirePermission("products:write"), controllers.DeleteVariantHandler)
+		admin.GET("/products/:id/variants/:variant_id/price", middlewares.RequirePermission("products:write"), controllers.GetVariantPriceHandler) // ?at=
+		admin.POST("/products/:id/sales", middlewares.RequirePermission("products:write"), controllers.CreateSaleHandler)
+		admin.GET("/products/:id/sales", middlewares.RequirePermission("products:write"), controllers.GetSalesHandler)
+		admin.DELETE("/products/:id/sales/:sale_id", middlewares.RequirePermission("products:write"), controllers.CancelSaleHandler)
+		admin.GET("/products/:id/price-history", middlewares.RequirePermission("products:write"), controllers.GetPriceHistoryHandler)
+		admin.POST("/products/:id/images", middlewares.RequirePermission("products:write"), controllers.UploadProductImagesHandler) // multipart, field "images"
+		admin.PUT("/products/:id/images/order", middlewares.RequirePermission("products:write"), controllers.ReorderProductImagesHandler)
+		admin.DELETE("/products/:id/images/:image_id", middlewares.RequirePermission("products:write"), controllers.DeleteProductImageHandler)
+		admin.POST("/products/:id/production", middlewares.RequirePermission("production:update"), controllers.StartProductionHandler)              // start production route
+		admin.PUT("/products/:id/production/status", middlewares.RequirePermission("production:update"), controllers.UpdateProductionStatusHandler) // update production status route
+		admin.GET("/products/:id/production", middlewares.RequirePermission("production:read"), controllers.GetProductionDetailsHandler)            // get production details route
+		admin.GET("/products/production", middlewares.RequirePermission("production:read"), controllers.GetAllProductionsHandler)                   // get all productions route
 	}
 
 	// Public routes
 	public := r.Group("/products")
 	{
 		public.GET("", controllers.GetProductsHandler)
+		public.GET("/search", controllers.SearchProductsHandler)   // full-text search, ?q=
+		public.GET("/facets", controllers.GetProductFacetsHandler) // same filters as GET /products
 		public.GET("/:id", controllers.GetProductByIDHandler)
+		public.GET("/:id/images", controllers.GetProductImagesHandler)
 	}
 }
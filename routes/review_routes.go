@@ -0,0 +1,33 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/controllers"
+	"github.com/mahi-qwe/ecommerce-backend/middlewares"
+)
+
+func ReviewRoutes(r *gin.Engine) {
+	r.GET("/products/:id/reviews", controllers.GetProductReviewsHandler) // approved reviews and rating breakdown
+
+	// Writing as the customer is off-limits while impersonating
+	customer := r.Group("")
+	customer.Use(middlewares.AuthMiddleware())
+	{
+		customer.POST("/products/:id/reviews", middlewares.DenyImpersonation(), controllers.CreateReviewHandler)
+		customer.GET("/user/reviews", controllers.GetMyReviewsHandler)
+		customer.PUT("/reviews/:id", middlewares.DenyImpersonation(), controllers.UpdateReviewHandler)
+		customer.DELETE("/reviews/:id", middlewares.DenyImpersonation(), controllers.DeleteReviewHandler)
+		customer.POST("/reviews/:id/photos", middlewares.DenyImpersonation(), controllers.UploadReviewPhotoHandler) // multipart, field "photo"
+		customer.DELETE("/reviews/:id/photos/:photo_id", middlewares.DenyImpersonation(), controllers.DeleteReviewPhotoHandler)
+		customer.POST("/reviews/:id/helpful", middlewares.DenyImpersonation(), controllers.VoteReviewHelpfulHandler)
+		customer.DELETE("/reviews/:id/helpful", middlewares.DenyImpersonation(), controllers.UnvoteReviewHelpfulHandler)
+	}
+
+	admin := r.Group("/admin/reviews")
+	admin.Use(middlewares.AuthMiddleware(middlewares.WithAPIKeys()))
+	{
+		admin.GET("", middlewares.RequirePermission("reviews:moderate"), controllers.GetReviewQueueHandler)
+		admin.PUT("/:id/moderation", middlewares.RequirePermission("reviews:moderate"), controllers.ModerateReviewHandler)
+		admin.DELETE("/:id", middlewares.RequirePermission("reviews:moderate"), controllers.AdminDeleteReviewHandler)
+	}
+}
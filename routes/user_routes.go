@@ -1,16 +1,49 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/mahi-qwe/ecommerce-backend/controllers"
 	"github.com/mahi-qwe/ecommerce-backend/middlewares"
 )
 
 func UserRoutes(r *gin.Engine) {
+	// Building an export touches every table, so keep it rare
+	exportLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "data-export", Limit: 5, Window: time.Hour, Key: middlewares.KeyByUserID()})
+	// Decoding and resizing an upload is expensive
+	avatarLimit := middlewares.RateLimit(middlewares.RateLimitConfig{Name: "avatar-upload", Limit: 10, Window: time.Hour, Key: middlewares.KeyByUserID()})
+
 	user := r.Group("/user")
 	user.Use(middlewares.AuthMiddleware())
 	{
 		user.GET("/profile", controllers.GetProfileHandler)
 		user.PUT("/profile", controllers.UpdateProfileHandler)
+		user.POST("/avatar", middlewares.DenyImpersonation(), avatarLimit, controllers.UploadAvatarHandler) // multipart, field "avatar"
+		user.DELETE("/avatar", middlewares.DenyImpersonation(), controllers.DeleteAvatarHandler)
+
+		// Email change (OTP to the new address)
+		user.POST("/email", middlewares.DenyImpersonation(), controllers.RequestEmailChangeHandler)
+		user.POST("/email/confirm", middlewares.DenyImpersonation(), controllers.ConfirmEmailChangeHandler)
+
+		// Link a social login provider to this account
+		user.POST("/oauth/:provider/link", middlewares.DenyImpersonation(), controllers.StartOAuthLinkHandler)
+
+		// Session / device management
+		user.GET("/sessions", controllers.GetSessionsHandler)
+		user.DELETE("/sessions/:id", middlewares.DenyImpersonation(), controllers.RevokeSessionHandler)
+		user.DELETE("/sessions", middlewares.DenyImpersonation(), controllers.RevokeAllSessionsHandler) // log out everywhere
+
+		// Two-factor authentication
+		user.GET("/2fa", controllers.GetTwoFactorStatusHandler)
+		user.POST("/2fa/setup", middlewares.DenyImpersonation(), controllers.SetupTwoFactorHandler)
+		user.POST("/2fa/confirm", middlewares.DenyImpersonation(), controllers.ConfirmTwoFactorHandler)
+		user.POST("/2fa/disable", middlewares.DenyImpersonation(), controllers.DisableTwoFactorHandler)
+		user.POST("/2fa/recovery-codes", middlewares.DenyImpersonation(), controllers.RegenerateRecoveryCodesHandler)
+
+		// Personal data export and account deletion
+		user.GET("/data-export", middlewares.DenyImpersonation(), exportLimit, controllers.ExportUserDataHandler) // ?format=json|zip
+		user.POST("/account/delete", middlewares.DenyImpersonation(), controllers.RequestAccountDeletionHandler)
+		user.POST("/account/delete/confirm", middlewares.DenyImpersonation(), controllers.ConfirmAccountDeletionHandler)
 	}
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mahi-qwe/ecommerce-backend/controllers"
+)
+
+func WellKnownRoutes(r *gin.Engine) {
+	wellKnown := r.Group("/.well-known")
+	{
+		wellKnown.GET("/jwks.json", controllers.JWKSHandler) // public keys for verifying access tokens
+	}
+}
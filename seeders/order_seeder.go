@@ -4,6 +4,7 @@ import (
 	"log"
 
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
 	"gorm.io/gorm"
 )
 
@@ -74,22 +75,24 @@ func SeedOrders(db *gorm.DB) {
 			}
 			product := products[item.ProductIndex]
 
-			if product.StockQuantity < item.Quantity {
-				log.Printf("⚠️ Not enough stock for product %s, skipping order for user %d", product.Name, user.ID)
+			variant, err := services.ResolveVariant(db, product.ID, 0)
+			if err != nil {
+				log.Printf("⚠️ No variant for product %s, skipping order for user %d", product.Name, user.ID)
 				canCreate = false
 				break
 			}
 
 			// Deduct stock
-			product.StockQuantity -= item.Quantity
-			if err := db.Save(&product).Error; err != nil {
-				log.Printf("❌ Could not update stock for product %s: %v", product.Name, err)
+			if err := services.AdjustVariantStock(db, variant.ID, -item.Quantity); err != nil {
+				log.Printf("⚠️ Could not take stock for product %s, skipping order for user %d: %v", product.Name, user.ID, err)
 				canCreate = false
 				break
 			}
 
 			orderItems = append(orderItems, models.OrderItem{
 				ProductID: product.ID,
+				VariantID: variant.ID,
+				SKU:       variant.SKU,
 				Quantity:  item.Quantity,
 				Price:     product.Price * float64(item.Quantity),
 			})
@@ -108,5 +108,18 @@ func SeedProducts(db *gorm.DB) {
 		}
 	}
 
+	// Seeded category names become categories
+	if err := models.EnsureProductCategories(db); err != nil {
+		log.Printf("❌ Could not create categories: %v", err)
+	}
+
+	// Seeded products get a default variant holding their price and stock
+	if err := models.EnsureDefaultVariants(db); err != nil {
+		log.Printf("❌ Could not create default variants: %v", err)
+	}
+	if err := models.EnsurePriceHistory(db); err != nil {
+		log.Printf("❌ Could not start price history: %v", err)
+	}
+
 	log.Println("✅ Products seeded")
 }
@@ -0,0 +1,45 @@
+package seeders
+
+import (
+	"log"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+// SeedRoles makes sure every known permission and default role exists.
+// Roles that already exist are left alone so admin edits survive restarts.
+func SeedRoles(db *gorm.DB) {
+	for name, description := range services.Permissions {
+		permission := models.Permission{Name: name, Description: description}
+		if err := db.Where(models.Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+			log.Printf("❌ Could not seed permission %s: %v", name, err)
+		}
+	}
+
+	for _, def := range services.DefaultRoles {
+		var role models.Role
+		err := db.Where("name = ?", def.Name).First(&role).Error
+		if err == nil {
+			continue
+		}
+
+		var perms []models.Permission
+		if len(def.Permissions) > 0 {
+			db.Where("name IN ?", def.Permissions).Find(&perms)
+		}
+
+		role = models.Role{
+			Name:        def.Name,
+			Description: def.Description,
+			IsSystem:    true,
+			Permissions: perms,
+		}
+		if err := db.Create(&role).Error; err != nil {
+			log.Printf("❌ Could not seed role %s: %v", def.Name, err)
+		}
+	}
+
+	log.Println("✅ Roles and permissions seeded")
+}
@@ -9,6 +9,8 @@ import (
 func Seed(db *gorm.DB) {
 	log.Println("Starting database seeding...")
 
+	SeedSettings(db)
+	SeedRoles(db)
 	SeedUsers(db)
 	SeedProducts(db)
 	SeedOrders(db)
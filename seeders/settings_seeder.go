@@ -0,0 +1,20 @@
+package seeders
+
+import (
+	"log"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/services"
+	"gorm.io/gorm"
+)
+
+func SeedSettings(db *gorm.DB) {
+	for key, value := range services.DefaultSettings {
+		setting := models.StoreSetting{Key: key, Value: value}
+		if err := db.Where(models.StoreSetting{Key: key}).FirstOrCreate(&setting).Error; err != nil {
+			log.Printf("❌ Could not seed setting %s: %v", key, err)
+		}
+	}
+
+	log.Println("✅ Settings seeded")
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// ErrOrdersInProgress blocks account deletion while orders are still being fulfilled
+var ErrOrdersInProgress = errors.New("account has orders that are still pending, being processed or shipped")
+
+// Orders in these states must finish before the account can be deleted
+var openOrderStatuses = []string{"pending", "processing", "shipped"}
+
+// AnonymizedAddress replaces personal addresses on records we must keep
+const AnonymizedAddress = "[deleted]"
+
+type ExportProfile struct {
+	ID         uint      `json:"id"`
+	FullName   string    `json:"full_name"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	Address    string    `json:"address"`
+	AvatarURL  *string   `json:"avatar_url"`
+	IsVerified bool      `json:"is_verified"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type ExportPayment struct {
+	ID        uint      `json:"id"`
+	OrderID   uint      `json:"order_id"`
+	Gateway   string    `json:"gateway"`
+	PaymentID string    `json:"payment_id"`
+	Amount    float64   `json:"amount"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportCartItem struct {
+	ProductID   uint      `json:"product_id"`
+	VariantID   uint      `json:"variant_id"`
+	SKU         string    `json:"sku"`
+	ProductName string    `json:"product_name"`
+	Quantity    int       `json:"quantity"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+type ExportWishlistItem struct {
+	ProductID   uint      `json:"product_id"`
+	VariantID   uint      `json:"variant_id"`
+	SKU         string    `json:"sku"`
+	ProductName string    `json:"product_name"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+type ExportOTP struct {
+	Purpose   string    `json:"purpose"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Attempts  int       `json:"attempts"`
+	IsUsed    bool      `json:"is_used"`
+}
+
+type ExportSession struct {
+	Device     string     `json:"device"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type ExportReview struct {
+	ProductID   uint      `json:"product_id"`
+	ProductName string    `json:"product_name"`
+	Rating      int       `json:"rating"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	Status      string    `json:"status"`
+	PhotoURLs   []string  `json:"photo_urls"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DataExport is everything we hold about a user
+type DataExport struct {
+	GeneratedAt    time.Time             `json:"generated_at"`
+	Profile        ExportProfile         `json:"profile"`
+	Orders         []OrderResponse       `json:"orders"`
+	Payments       []ExportPayment       `json:"payments"`
+	Cart           []ExportCartItem      `json:"cart"`
+	Wishlist       []ExportWishlistItem  `json:"wishlist"`
+	Reviews        []ExportReview        `json:"reviews"`
+	OTPHistory     []ExportOTP           `json:"otp_history"`
+	Sessions       []ExportSession       `json:"sessions"`
+	LoginHistory   []models.LoginAttempt `json:"login_history"`
+	LinkedAccounts []models.UserIdentity `json:"linked_accounts"`
+}
+
+// BuildDataExport collects a user's personal data. OTP codes and other
+// secrets are never included, only their metadata.
+func BuildDataExport(db *gorm.DB, userID uint) (*DataExport, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	export := &DataExport{
+		GeneratedAt: time.Now(),
+		Profile: ExportProfile{
+			ID:         user.ID,
+			FullName:   user.FullName,
+			Email:      user.Email,
+			Role:       user.Role,
+			Address:    user.Address,
+			AvatarURL:  user.AvatarURL,
+			IsVerified: user.IsVerified,
+			CreatedAt:  user.CreatedAt,
+			UpdatedAt:  user.UpdatedAt,
+		},
+		Payments:       []ExportPayment{},
+		Cart:           []ExportCartItem{},
+		Wishlist:       []ExportWishlistItem{},
+		Reviews:        []ExportReview{},
+		OTPHistory:     []ExportOTP{},
+		Sessions:       []ExportSession{},
+		LoginHistory:   []models.LoginAttempt{},
+		LinkedAccounts: []models.UserIdentity{},
+	}
+
+	orders, err := GetUserOrders(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	export.Orders = orders
+	if export.Orders == nil {
+		export.Orders = []OrderResponse{}
+	}
+
+	var payments []models.Payment
+	if err := db.Joins("JOIN orders ON orders.id = payments.order_id").
+		Where("orders.user_id = ?", userID).
+		Order("payments.created_at").
+		Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		export.Payments = append(export.Payments, ExportPayment{
+			ID:        p.ID,
+			OrderID:   p.OrderID,
+			Gateway:   p.Gateway,
+			PaymentID: p.PaymentID,
+			Amount:    p.Amount,
+			Status:    p.Status,
+			CreatedAt: p.CreatedAt,
+		})
+	}
+
+	var cart []models.CartItem
+	if err := db.Preload("Product").Preload("Variant").Where("user_id = ?", userID).Find(&cart).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range cart {
+		export.Cart = append(export.Cart, ExportCartItem{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			SKU:         item.Variant.SKU,
+			ProductName: item.Product.Name,
+			Quantity:    item.Quantity,
+			AddedAt:     item.CreatedAt,
+		})
+	}
+
+	var wishlist []models.WishlistItem
+	if err := db.Preload("Product").Preload("Variant").Where("user_id = ?", userID).Find(&wishlist).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range wishlist {
+		export.Wishlist = append(export.Wishlist, ExportWishlistItem{
+			ProductID:   item.ProductID,
+			VariantID:   item.VariantID,
+			SKU:         item.Variant.SKU,
+			ProductName: item.Product.Name,
+			AddedAt:     item.CreatedAt,
+		})
+	}
+
+	var reviews []models.Review
+	if err := db.Preload("Photos").Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("user_id = ?", userID).Order("created_at").Find(&reviews).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range reviews {
+		review := ExportReview{
+			ProductID: r.ProductID,
+			Rating:    r.Rating,
+			Title:     r.Title,
+			Body:      r.Body,
+			Status:    r.Status,
+			PhotoURLs: []string{},
+			CreatedAt: r.CreatedAt,
+			UpdatedAt: r.UpdatedAt,
+		}
+		if r.Product != nil {
+			review.ProductName = r.Product.Name
+		}
+		for _, p := range r.Photos {
+			review.PhotoURLs = append(review.PhotoURLs, p.URL)
+		}
+		export.Reviews = append(export.Reviews, review)
+	}
+
+	var otps []models.OTP
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&otps).Error; err != nil {
+		return nil, err
+	}
+	for _, otp := range otps {
+		export.OTPHistory = append(export.OTPHistory, ExportOTP{
+			Purpose:   otp.Purpose,
+			CreatedAt: otp.CreatedAt,
+			ExpiresAt: otp.ExpiresAt,
+			Attempts:  otp.Attempts,
+			IsUsed:    otp.IsUsed,
+		})
+	}
+
+	sessions, err := utils.ListActiveSessions(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		export.Sessions = append(export.Sessions, ExportSession{
+			Device:     s.DeviceLabel,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+		})
+	}
+
+	if err := db.Where("user_id = ?", userID).Order("created_at").Find(&export.LoginHistory).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Find(&export.LinkedAccounts).Error; err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// WriteDataExportZip writes the export as a ZIP with one JSON file per section
+func WriteDataExportZip(w io.Writer, export *DataExport) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"orders.json", export.Orders},
+		{"payments.json", export.Payments},
+		{"cart.json", export.Cart},
+		{"wishlist.json", export.Wishlist},
+		{"reviews.json", export.Reviews},
+		{"otp_history.json", export.OTPHistory},
+		{"sessions.json", export.Sessions},
+		{"login_history.json", export.LoginHistory},
+		{"linked_accounts.json", export.LinkedAccounts},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: export.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// SendAccountDeletionCode emails the user the code that confirms deleting their account
+func SendAccountDeletionCode(user models.User) error {
+	_, err := sendOTP(user.ID, user.Email, deleteAccountPurpose)
+	return err
+}
+
+// VerifyAccountDeletionCode burns the account deletion code if it matches
+func VerifyAccountDeletionCode(user models.User, otp string) error {
+	_, err := validateOTP(user.ID, otp, deleteAccountPurpose, user.Email)
+	return err
+}
+
+// CheckAccountDeletable returns ErrOrdersInProgress while the user has open orders
+func CheckAccountDeletable(db *gorm.DB, userID uint) error {
+	var open int64
+	if err := db.Model(&models.Order{}).
+		Where("user_id = ? AND status IN ?", userID, openOrderStatuses).
+		Count(&open).Error; err != nil {
+		return err
+	}
+	if open > 0 {
+		return ErrOrdersInProgress
+	}
+	return nil
+}
+
+// DeleteAccount anonymizes a user's personal data and closes the account.
+// Orders, order items and payments are kept for bookkeeping, minus the address.
+func DeleteAccount(db *gorm.DB, userID uint) error {
+	if err := CheckAccountDeletable(db, userID); err != nil {
+		return err
+	}
+
+	unusablePassword := make([]byte, 32)
+	if _, err := rand.Read(unusablePassword); err != nil {
+		return err
+	}
+
+	anonymizedEmail := fmt.Sprintf("deleted-%d@deleted.invalid", userID)
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	var reviewPhotos []models.ReviewPhoto
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"full_name":     "Deleted user",
+			"email":         anonymizedEmail,
+			"password_hash": hex.EncodeToString(unusablePassword), // not a bcrypt hash, so never matches
+			"avatar_url":    nil,
+			"avatar_keys":   "",
+			"address":       "",
+			"is_verified":   false,
+			"is_blocked":    true,
+			"updated_at":    time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Model(&models.Order{}).
+			Where("user_id = ?", userID).
+			Update("address", AnonymizedAddress).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.LoginAttempt{}).Where("user_id = ?", userID).Updates(map[string]interface{}{
+			"email":      anonymizedEmail,
+			"ip_address": "",
+			"user_agent": "",
+		}).Error; err != nil {
+			return err
+		}
+
+		// Reviews are the user's own words, so they go with the account
+		photos, err := DeleteUserReviews(tx, userID)
+		if err != nil {
+			return err
+		}
+		reviewPhotos = photos
+
+		// Nothing here is needed once the account is gone
+		for _, model := range []interface{}{
+			&models.CartItem{},
+			&models.WishlistItem{},
+			&models.OTP{},
+			&models.UserTwoFactor{},
+			&models.RecoveryCode{},
+			&models.RefreshToken{},
+			&models.UserIdentity{},
+			&models.PasswordHistory{},
+			&models.EmailChangeRequest{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Cut off any access token still in flight
+		if err := BumpTokenVersion(tx, userID); err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.User{}, userID).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Uploaded avatars and review photos are personal data too
+	deleteAvatarFiles(context.Background(), user)
+	deleteReviewPhotoFiles(context.Background(), reviewPhotos)
+	return nil
+}
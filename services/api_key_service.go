@@ -0,0 +1,223 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// APIKeyPrefix marks a bearer credential as an API key rather than a JWT
+const APIKeyPrefix = "ak_"
+
+// Scopes an API key can never hold, so a leaked key can't mint keys or hand out roles
+var forbiddenScopes = map[string]bool{
+	PermissionAll:         true,
+	"api_keys:manage":     true,
+	"roles:manage":        true,
+	PermissionImpersonate: true,
+}
+
+// lastUsedInterval limits how often a key's last-used time is written
+const lastUsedInterval = time.Minute
+
+var (
+	ErrInvalidAPIKey          = errors.New("invalid or expired api key")
+	ErrAPIKeyIPNotAllowed     = errors.New("api key is not allowed from this ip")
+	ErrInvalidScope           = errors.New("invalid scope")
+	ErrScopeNotHeld           = errors.New("you can't grant a scope you don't have")
+	ErrInvalidIPAllowlist     = errors.New("invalid ip or cidr in allowlist")
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrServiceAccountExists   = errors.New("service account already exists")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+)
+
+// CreateServiceAccount adds a service account that API keys can be minted for
+func CreateServiceAccount(db *gorm.DB, name, description string, createdByID uint) (models.ServiceAccount, error) {
+	name = strings.TrimSpace(name)
+
+	var count int64
+	db.Unscoped().Model(&models.ServiceAccount{}).Where("name = ?", name).Count(&count)
+	if count > 0 {
+		return models.ServiceAccount{}, ErrServiceAccountExists
+	}
+
+	account := models.ServiceAccount{Name: name, Description: description, CreatedByID: createdByID}
+	err := db.Create(&account).Error
+	return account, err
+}
+
+// DeleteServiceAccount removes a service account and revokes all of its keys
+func DeleteServiceAccount(db *gorm.DB, id uint) error {
+	var account models.ServiceAccount
+	if err := db.First(&account, id).Error; err != nil {
+		return ErrServiceAccountNotFound
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.APIKey{}).
+			Where("service_account_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&account).Error
+	})
+}
+
+// CreateAPIKey mints a key for a service account. Every scope must be held by
+// creatorRole, so nobody hands a key more than they have. The plain key is
+// returned once and only its hash is stored.
+func CreateAPIKey(db *gorm.DB, creatorRole string, accountID uint, name string, scopes, allowedIPs []string, expiresAt *time.Time, createdByID uint) (string, models.APIKey, error) {
+	var account models.ServiceAccount
+	if err := db.First(&account, accountID).Error; err != nil {
+		return "", models.APIKey{}, ErrServiceAccountNotFound
+	}
+
+	for _, scope := range scopes {
+		if _, ok := Permissions[scope]; !ok || forbiddenScopes[scope] {
+			return "", models.APIKey{}, ErrInvalidScope
+		}
+		allowed, err := HasPermission(db, creatorRole, scope)
+		if err != nil {
+			return "", models.APIKey{}, err
+		}
+		if !allowed {
+			return "", models.APIKey{}, fmt.Errorf("%w: %s", ErrScopeNotHeld, scope)
+		}
+	}
+
+	allowlist, err := normalizeIPAllowlist(allowedIPs)
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	secret, hash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	plain := APIKeyPrefix + secret
+
+	key := models.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             name,
+		Prefix:           plain[:len(APIKeyPrefix)+8],
+		KeyHash:          hash,
+		Scopes:           scopes,
+		AllowedIPs:       allowlist,
+		ExpiresAt:        expiresAt,
+		CreatedByID:      createdByID,
+	}
+	if err := db.Create(&key).Error; err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	return plain, key, nil
+}
+
+// RevokeAPIKey stops a key from working; the row stays for auditing
+func RevokeAPIKey(db *gorm.DB, id uint) error {
+	result := db.Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey checks a presented key and the client IP, and records the use
+func AuthenticateAPIKey(db *gorm.DB, plain, clientIP string) (*models.APIKey, error) {
+	if !strings.HasPrefix(plain, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := db.Where("key_hash = ?", hashToken(strings.TrimPrefix(plain, APIKeyPrefix))).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var account models.ServiceAccount
+	if err := db.First(&account, key.ServiceAccountID).Error; err != nil || account.IsDisabled {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if !ipAllowed(key.AllowedIPs, clientIP) {
+		return nil, ErrAPIKeyIPNotAllowed
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval || key.LastUsedIP != clientIP {
+		db.Model(&key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		})
+	}
+
+	return &key, nil
+}
+
+// HasScope reports whether an API key's scopes include permission
+func HasScope(scopes []string, permission string) bool {
+	for _, scope := range scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeIPAllowlist validates entries and turns plain IPs into single-host CIDRs
+func normalizeIPAllowlist(entries []string) ([]string, error) {
+	allowlist := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, ErrInvalidIPAllowlist
+		}
+		allowlist = append(allowlist, network.String())
+	}
+	return allowlist, nil
+}
+
+func ipAllowed(allowlist []string, clientIP string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, entry := range allowlist {
+		if _, network, err := net.ParseCIDR(entry); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
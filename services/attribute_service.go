@@ -0,0 +1,693 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAttributeNotFound     = errors.New("attribute not found")
+	ErrAttributeExists       = errors.New("category already has an attribute with this code")
+	ErrInvalidAttributeCode  = errors.New("code must start with a letter and use only lower-case letters, digits and underscores")
+	ErrInvalidAttributeType  = errors.New("type must be text, number, boolean or select")
+	ErrAttributeTypeConflict = errors.New("this code is already used with a different type in another category")
+	ErrAttributeOptions      = errors.New("a select attribute needs at least one option")
+	ErrInvalidAttribute      = errors.New("invalid product attribute")
+)
+
+var attributeCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+const (
+	maxAttributeTextLength = 255
+	maxFacetValues         = 50 // per attribute, most common first
+	maxFacets              = 20 // attributes per facets response, by position
+	maxAttributeFilters    = 10 // attributes one listing can filter on
+)
+
+// AttributeInput describes an attribute definition to create or the fields to
+// change. Code and Type are fixed once created, since products hold values
+// under the code in that type.
+type AttributeInput struct {
+	Code       *string
+	Name       *string
+	Type       *string
+	Unit       *string
+	Options    []string // nil leaves a select's options alone
+	Required   *bool
+	Filterable *bool // defaults to true
+	Position   *int
+}
+
+// AttributeFilter narrows products to those whose attribute has one of
+// Values or, for numbers, lies between Min and Max
+type AttributeFilter struct {
+	Code   string
+	Type   string
+	Values []interface{}
+	Min    *float64
+	Max    *float64
+}
+
+// AttributeFacet counts the values of an attribute across a product listing
+type AttributeFacet struct {
+	Code   string       `json:"code"`
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Unit   string       `json:"unit,omitempty"`
+	Count  int64        `json:"count"`            // products that have a value
+	Values []FacetValue `json:"values,omitempty"` // text, select and boolean
+	Min    *float64     `json:"min,omitempty"`    // number
+	Max    *float64     `json:"max,omitempty"`
+}
+
+// FacetValue is one value of a facet and how many products have it
+type FacetValue struct {
+	Value    interface{} `json:"value"`
+	Count    int64       `json:"count"`
+	Selected bool        `json:"selected"`
+}
+
+// CategoryAttributes returns the attribute definitions that apply to a
+// category: its own and those inherited from its parents. A subcategory's
+// definition replaces a parent's with the same code.
+func CategoryAttributes(db *gorm.DB, categoryID uint) ([]models.AttributeDefinition, error) {
+	var ancestors []uint
+	if err := db.Raw(`WITH RECURSIVE up AS (
+			SELECT id, parent_id, 0 AS depth FROM categories WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT c.id, c.parent_id, up.depth + 1 FROM categories c JOIN up ON c.id = up.parent_id WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM up ORDER BY depth`, categoryID).Scan(&ancestors).Error; err != nil {
+		return nil, err
+	}
+	if len(ancestors) == 0 {
+		return nil, ErrCategoryNotFound
+	}
+
+	var all []models.AttributeDefinition
+	if err := db.Where("category_id IN ?", ancestors).Find(&all).Error; err != nil {
+		return nil, err
+	}
+
+	depth := make(map[uint]int, len(ancestors))
+	for i, id := range ancestors {
+		depth[id] = i
+	}
+	nearest := map[string]models.AttributeDefinition{}
+	for _, def := range all {
+		if current, ok := nearest[def.Code]; !ok || depth[def.CategoryID] < depth[current.CategoryID] {
+			nearest[def.Code] = def
+		}
+	}
+
+	defs := make([]models.AttributeDefinition, 0, len(nearest))
+	for _, def := range nearest {
+		defs = append(defs, def)
+	}
+	sortAttributes(defs)
+	return defs, nil
+}
+
+// CreateAttribute defines a new attribute for a category and its subcategories
+func CreateAttribute(db *gorm.DB, categoryID uint, input AttributeInput) (models.AttributeDefinition, error) {
+	if _, err := getCategory(db, categoryID); err != nil {
+		return models.AttributeDefinition{}, err
+	}
+
+	var code, name, kind string
+	if input.Code != nil {
+		code = strings.TrimSpace(*input.Code)
+	}
+	if input.Name != nil {
+		name = strings.TrimSpace(*input.Name)
+	}
+	if input.Type != nil {
+		kind = *input.Type
+	}
+	if !attributeCodePattern.MatchString(code) {
+		return models.AttributeDefinition{}, ErrInvalidAttributeCode
+	}
+	switch kind {
+	case models.AttributeText, models.AttributeNumber, models.AttributeBoolean, models.AttributeSelect:
+	default:
+		return models.AttributeDefinition{}, ErrInvalidAttributeType
+	}
+
+	var existing []models.AttributeDefinition
+	if err := db.Where("code = ?", code).Find(&existing).Error; err != nil {
+		return models.AttributeDefinition{}, err
+	}
+	for _, def := range existing {
+		if def.CategoryID == categoryID {
+			return models.AttributeDefinition{}, ErrAttributeExists
+		}
+		if def.Type != kind {
+			return models.AttributeDefinition{}, ErrAttributeTypeConflict
+		}
+	}
+
+	def := models.AttributeDefinition{CategoryID: categoryID, Code: code, Name: name, Type: kind, Filterable: true}
+	if def.Name == "" {
+		def.Name = code
+	}
+	if err := applyAttributeInput(&def, input); err != nil {
+		return def, err
+	}
+
+	err := db.Create(&def).Error
+	return def, err
+}
+
+// UpdateAttribute changes an attribute's name, unit, options, flags or position
+func UpdateAttribute(db *gorm.DB, categoryID, attributeID uint, input AttributeInput) (models.AttributeDefinition, error) {
+	def, err := getAttribute(db, categoryID, attributeID)
+	if err != nil {
+		return def, err
+	}
+
+	if input.Name != nil && strings.TrimSpace(*input.Name) != "" {
+		def.Name = strings.TrimSpace(*input.Name)
+	}
+	if err := applyAttributeInput(&def, input); err != nil {
+		return def, err
+	}
+
+	err = db.Save(&def).Error
+	return def, err
+}
+
+// DeleteAttribute removes a definition and clears its values from the
+// products it covered, unless another definition still covers them
+func DeleteAttribute(db *gorm.DB, categoryID, attributeID uint) error {
+	def, err := getAttribute(db, categoryID, attributeID)
+	if err != nil {
+		return err
+	}
+
+	categoryIDs, err := CategoryWithDescendants(db, categoryID)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&def).Error; err != nil {
+			return err
+		}
+
+		for _, id := range categoryIDs {
+			defs, err := CategoryAttributes(tx, id)
+			if err != nil {
+				return err
+			}
+			covered := false
+			for _, d := range defs {
+				covered = covered || d.Code == def.Code
+			}
+			if covered {
+				continue
+			}
+			if err := tx.Model(&models.Product{}).Where("category_id = ?", id).
+				Update("attributes", gorm.Expr("attributes - ?::text", def.Code)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MergeProductAttributes applies changes to a product's current attribute
+// values and checks the result against the definitions of its category.
+// A nil value in changes removes that attribute, values the category no
+// longer defines are dropped, and when requireAll is set every required
+// attribute must end up with a value.
+func MergeProductAttributes(db *gorm.DB, categoryID *uint, current, changes map[string]interface{}, requireAll bool) (map[string]interface{}, error) {
+	var defs []models.AttributeDefinition
+	if categoryID != nil {
+		var err error
+		if defs, err = CategoryAttributes(db, *categoryID); err != nil {
+			return nil, err
+		}
+	}
+
+	byCode := make(map[string]models.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		byCode[def.Code] = def
+	}
+
+	result := map[string]interface{}{}
+	for code, value := range current {
+		if _, ok := byCode[code]; ok {
+			result[code] = value
+		}
+	}
+
+	for code, value := range changes {
+		def, ok := byCode[code]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not an attribute of this product's category", ErrInvalidAttribute, code)
+		}
+		if value == nil {
+			delete(result, code)
+			continue
+		}
+		normalized, err := normalizeAttributeValue(def, value)
+		if err != nil {
+			return nil, err
+		}
+		result[code] = normalized
+	}
+
+	if requireAll {
+		for _, def := range defs {
+			if _, ok := result[def.Code]; def.Required && !ok {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidAttribute, def.Code)
+			}
+		}
+	}
+	return result, nil
+}
+
+// UpdateProductAttributes applies attribute changes to a product, checked
+// against the definitions of categoryID (the product's new category, if it
+// is moving). Attributes the category doesn't define are dropped.
+func UpdateProductAttributes(db *gorm.DB, product *models.Product, categoryID *uint, changes map[string]interface{}) error {
+	attributes, err := MergeProductAttributes(db, categoryID, product.Attributes, changes, changes != nil)
+	if err != nil {
+		return err
+	}
+
+	if err := db.Model(&models.Product{}).Where("id = ?", product.ID).
+		Select("attributes").Updates(&models.Product{Attributes: attributes}).Error; err != nil {
+		return err
+	}
+	product.Attributes = attributes
+	return nil
+}
+
+// ParseAttributeFilters reads attribute filters from a product listing's
+// query: attr.<code>=a,b matches any of the values and attr.<code>.min /
+// attr.<code>.max bound numbers. At most maxAttributeFilters attributes can
+// be filtered on at once.
+func ParseAttributeFilters(db *gorm.DB, query url.Values) ([]AttributeFilter, error) {
+	type param struct{ code, bound, key, value string }
+	var params []param
+	seen := map[string]bool{}
+	var codes []string
+
+	for key, values := range query {
+		rest, ok := strings.CutPrefix(key, "attr.")
+		if !ok || len(values) == 0 || strings.TrimSpace(values[0]) == "" {
+			continue
+		}
+		code, bound, _ := strings.Cut(rest, ".")
+		params = append(params, param{code: code, bound: bound, key: key, value: values[0]})
+		if !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	if len(codes) > maxAttributeFilters {
+		return nil, fmt.Errorf("%w: at most %d attributes can be filtered on", utils.ErrInvalidListParams, maxAttributeFilters)
+	}
+
+	var defs []models.AttributeDefinition
+	if err := db.Where("code IN ?", codes).Find(&defs).Error; err != nil {
+		return nil, err
+	}
+	defsByCode := map[string][]models.AttributeDefinition{}
+	for _, def := range defs {
+		defsByCode[def.Code] = append(defsByCode[def.Code], def)
+	}
+
+	// Map order is random; keep the errors and the SQL stable
+	sort.Strings(codes)
+	sort.Slice(params, func(a, b int) bool { return params[a].key < params[b].key })
+
+	byCode := make(map[string]*AttributeFilter, len(codes))
+	for _, code := range codes {
+		if len(defsByCode[code]) == 0 {
+			return nil, fmt.Errorf("%w: unknown attribute %q", utils.ErrInvalidListParams, code)
+		}
+		byCode[code] = &AttributeFilter{Code: code, Type: defsByCode[code][0].Type}
+	}
+
+	for _, p := range params {
+		filter := byCode[p.code]
+		if p.bound == "" {
+			var err error
+			if filter.Values, err = parseFilterValues(defsByCode[p.code], p.value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if filter.Type != models.AttributeNumber || (p.bound != "min" && p.bound != "max") {
+			return nil, fmt.Errorf("%w: %s is not a valid filter", utils.ErrInvalidListParams, p.key)
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(p.value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s must be a number", utils.ErrInvalidListParams, p.key)
+		}
+		if p.bound == "min" {
+			filter.Min = &n
+		} else {
+			filter.Max = &n
+		}
+	}
+
+	filters := make([]AttributeFilter, 0, len(codes))
+	for _, code := range codes {
+		filters = append(filters, *byCode[code])
+	}
+	return filters, nil
+}
+
+// ApplyAttributeFilters adds the filters to a products query, leaving out
+// the one on except so a facet can count its own alternatives
+func ApplyAttributeFilters(query *gorm.DB, filters []AttributeFilter, except string) *gorm.DB {
+	for _, f := range filters {
+		if f.Code == except {
+			continue
+		}
+
+		if len(f.Values) > 0 {
+			conditions := make([]string, len(f.Values))
+			args := make([]interface{}, len(f.Values))
+			for i, v := range f.Values {
+				doc, _ := json.Marshal(map[string]interface{}{f.Code: v})
+				conditions[i] = "attributes @> ?::jsonb"
+				args[i] = string(doc)
+			}
+			query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+		}
+
+		number := "CASE WHEN jsonb_typeof(attributes -> ?::text) = 'number' THEN (attributes ->> ?::text)::numeric END"
+		if f.Min != nil {
+			query = query.Where(number+" >= ?", f.Code, f.Code, *f.Min)
+		}
+		if f.Max != nil {
+			query = query.Where(number+" <= ?", f.Code, f.Code, *f.Max)
+		}
+	}
+	return query
+}
+
+// ProductFacets counts attribute values across the products base selects,
+// which has every filter but the attribute ones applied. Each facet honours
+// the other attributes' filters but not its own, so a storefront can offer
+// the alternatives to what is selected. With a category, the facets are the
+// filterable attributes of it, its parents and its subcategories; without
+// one, those of the whole catalog. Either way only the first maxFacets are
+// counted.
+func ProductFacets(db, base *gorm.DB, categoryID *uint, filters []AttributeFilter) ([]AttributeFacet, error) {
+	defs, err := facetDefinitions(db, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	base = base.Session(&gorm.Session{})
+	selected := map[string]AttributeFilter{}
+	for _, f := range filters {
+		selected[f.Code] = f
+	}
+
+	facets := make([]AttributeFacet, 0, len(defs))
+	for _, def := range defs {
+		facet := AttributeFacet{Code: def.Code, Name: def.Name, Type: def.Type, Unit: def.Unit}
+		query := ApplyAttributeFilters(base, filters, def.Code).Session(&gorm.Session{})
+
+		if def.Type == models.AttributeNumber {
+			var r struct {
+				Min   *float64
+				Max   *float64
+				Count int64
+			}
+			if err := query.
+				Select("min((attributes ->> ?::text)::numeric) AS min, max((attributes ->> ?::text)::numeric) AS max, count(*) AS count", def.Code, def.Code).
+				Where("jsonb_typeof(attributes -> ?::text) = 'number'", def.Code).
+				Scan(&r).Error; err != nil {
+				return nil, err
+			}
+			facet.Min, facet.Max, facet.Count = r.Min, r.Max, r.Count
+		} else {
+			var rows []struct {
+				Value string
+				Count int64
+			}
+			// Counted apart from the values, which stop at maxFacetValues
+			if err := query.
+				Select("count(*)").
+				Where("attributes -> ?::text IS NOT NULL", def.Code).
+				Scan(&facet.Count).Error; err != nil {
+				return nil, err
+			}
+
+			if err := query.
+				Select("attributes ->> ?::text AS value, count(*) AS count", def.Code).
+				Where("attributes -> ?::text IS NOT NULL", def.Code).
+				Group("value").Order("count DESC, value").Limit(maxFacetValues).
+				Scan(&rows).Error; err != nil {
+				return nil, err
+			}
+
+			for _, row := range rows {
+				var value interface{} = row.Value
+				if def.Type == models.AttributeBoolean {
+					value = row.Value == "true"
+				}
+				facet.Values = append(facet.Values, FacetValue{
+					Value:    value,
+					Count:    row.Count,
+					Selected: filterHasValue(selected[def.Code], value),
+				})
+			}
+		}
+
+		if facet.Count > 0 {
+			facets = append(facets, facet)
+		}
+	}
+	return facets, nil
+}
+
+// facetDefinitions picks one filterable definition per code for the facets
+func facetDefinitions(db *gorm.DB, categoryID *uint) ([]models.AttributeDefinition, error) {
+	var defs []models.AttributeDefinition
+	query := db.Where("filterable")
+
+	if categoryID != nil {
+		inherited, err := CategoryAttributes(db, *categoryID)
+		if err != nil {
+			return nil, err
+		}
+		below, err := CategoryWithDescendants(db, *categoryID)
+		if err != nil {
+			return nil, err
+		}
+		var subcategories []models.AttributeDefinition
+		if err := query.Where("category_id IN ?", below).Find(&subcategories).Error; err != nil {
+			return nil, err
+		}
+		for _, def := range inherited {
+			if def.Filterable {
+				defs = append(defs, def)
+			}
+		}
+		defs = append(defs, subcategories...)
+	} else if err := query.Find(&defs).Error; err != nil {
+		return nil, err
+	}
+
+	sortAttributes(defs)
+	seen := map[string]bool{}
+	unique := defs[:0]
+	for _, def := range defs {
+		if len(unique) == maxFacets {
+			break
+		}
+		if !seen[def.Code] {
+			seen[def.Code] = true
+			unique = append(unique, def)
+		}
+	}
+	return unique, nil
+}
+
+func getAttribute(db *gorm.DB, categoryID, attributeID uint) (models.AttributeDefinition, error) {
+	var def models.AttributeDefinition
+	if err := db.Where("id = ? AND category_id = ?", attributeID, categoryID).First(&def).Error; err != nil {
+		return def, ErrAttributeNotFound
+	}
+	return def, nil
+}
+
+// applyAttributeInput copies the changeable fields of a definition
+func applyAttributeInput(def *models.AttributeDefinition, input AttributeInput) error {
+	if input.Unit != nil {
+		def.Unit = strings.TrimSpace(*input.Unit)
+	}
+	if input.Required != nil {
+		def.Required = *input.Required
+	}
+	if input.Filterable != nil {
+		def.Filterable = *input.Filterable
+	}
+	if input.Position != nil {
+		def.Position = *input.Position
+	}
+
+	if def.Type != models.AttributeSelect {
+		def.Options = nil
+		return nil
+	}
+	if input.Options != nil {
+		seen := map[string]bool{}
+		options := make([]string, 0, len(input.Options))
+		for _, o := range input.Options {
+			o = strings.TrimSpace(o)
+			if o == "" || seen[strings.ToLower(o)] {
+				continue
+			}
+			seen[strings.ToLower(o)] = true
+			options = append(options, o)
+		}
+		def.Options = options
+	}
+	if len(def.Options) == 0 {
+		return ErrAttributeOptions
+	}
+	return nil
+}
+
+// normalizeAttributeValue checks a value against its definition and returns
+// it in the form it is stored and filtered in
+func normalizeAttributeValue(def models.AttributeDefinition, value interface{}) (interface{}, error) {
+	invalid := func(want string) error {
+		return fmt.Errorf("%w: %s must be %s", ErrInvalidAttribute, def.Code, want)
+	}
+
+	switch def.Type {
+	case models.AttributeNumber:
+		var n float64
+		switch v := value.(type) {
+		case float64:
+			n = v
+		case string:
+			var err error
+			if n, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				return nil, invalid("a number")
+			}
+		default:
+			return nil, invalid("a number")
+		}
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, invalid("a number")
+		}
+		return n, nil
+
+	case models.AttributeBoolean:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b, nil
+			}
+		}
+		return nil, invalid("true or false")
+
+	case models.AttributeSelect:
+		s, ok := value.(string)
+		if !ok {
+			return nil, invalid("one of " + strings.Join(def.Options, ", "))
+		}
+		for _, option := range def.Options {
+			if strings.EqualFold(option, strings.TrimSpace(s)) {
+				return option, nil
+			}
+		}
+		return nil, invalid("one of " + strings.Join(def.Options, ", "))
+
+	default:
+		s, ok := value.(string)
+		s = strings.TrimSpace(s)
+		if !ok || s == "" || len(s) > maxAttributeTextLength {
+			return nil, invalid(fmt.Sprintf("text of 1 to %d characters", maxAttributeTextLength))
+		}
+		return s, nil
+	}
+}
+
+// parseFilterValues reads "a,b" into values of the attribute's type, given
+// its definitions. Select values are matched to the defined options
+// regardless of case.
+func parseFilterValues(defs []models.AttributeDefinition, raw string) ([]interface{}, error) {
+	kind := defs[0].Type
+
+	var values []interface{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		switch kind {
+		case models.AttributeNumber:
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: attr.%s values must be numbers", utils.ErrInvalidListParams, defs[0].Code)
+			}
+			values = append(values, n)
+		case models.AttributeBoolean:
+			b, err := strconv.ParseBool(part)
+			if err != nil {
+				return nil, fmt.Errorf("%w: attr.%s must be true or false", utils.ErrInvalidListParams, defs[0].Code)
+			}
+			values = append(values, b)
+		case models.AttributeSelect:
+			value := part
+			for _, def := range defs {
+				for _, option := range def.Options {
+					if strings.EqualFold(option, part) {
+						value = option
+					}
+				}
+			}
+			values = append(values, value)
+		default:
+			values = append(values, part)
+		}
+	}
+	return values, nil
+}
+
+func filterHasValue(f AttributeFilter, value interface{}) bool {
+	for _, v := range f.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortAttributes(defs []models.AttributeDefinition) {
+	sort.SliceStable(defs, func(i, j int) bool {
+		if defs[i].Position != defs[j].Position {
+			return defs[i].Position < defs[j].Position
+		}
+		return defs[i].Name < defs[j].Name
+	})
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("a category with this name already exists here")
+	ErrCategoryCycle    = errors.New("a category can't be moved under itself or one of its subcategories")
+	ErrCategoryInUse    = errors.New("category still has subcategories or products")
+	ErrSlugTaken        = errors.New("slug is already in use")
+	ErrInvalidSlug      = errors.New("slug must contain letters or digits")
+)
+
+// CategoryInput describes a category to create or the fields to change. On
+// update, nil fields are left alone; ClearParent moves it to the root.
+type CategoryInput struct {
+	Name        *string
+	Slug        *string
+	Description *string
+	ImageURL    *string
+	Position    *int
+	ParentID    *uint
+	ClearParent bool
+}
+
+// CategoryTree returns all categories nested under their parents, siblings
+// ordered by position and then name
+func CategoryTree(db *gorm.DB) ([]models.Category, error) {
+	var categories []models.Category
+	if err := db.Order("position, name").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := map[uint][]models.Category{}
+	var roots []models.Category
+	for _, c := range categories {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var attach func(nodes []models.Category) []models.Category
+	attach = func(nodes []models.Category) []models.Category {
+		for i := range nodes {
+			nodes[i].Children = attach(children[nodes[i].ID])
+		}
+		return nodes
+	}
+
+	if roots == nil {
+		return []models.Category{}, nil
+	}
+	return attach(roots), nil
+}
+
+// FindCategory looks a category up by numeric ID or slug
+func FindCategory(db *gorm.DB, ref string) (models.Category, error) {
+	var category models.Category
+
+	query := db.Where("slug = ?", strings.ToLower(strings.TrimSpace(ref)))
+	if id, err := strconv.ParseUint(ref, 10, 64); err == nil {
+		query = db.Where("id = ?", id)
+	}
+
+	if err := query.First(&category).Error; err != nil {
+		return category, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// FindCategoryBySlug looks a category up by slug only, so values that happen to
+// be numbers are never taken for IDs
+func FindCategoryBySlug(db *gorm.DB, slug string) (models.Category, error) {
+	var category models.Category
+	if err := db.Where("slug = ?", strings.ToLower(strings.TrimSpace(slug))).First(&category).Error; err != nil {
+		return category, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+func getCategory(db *gorm.DB, id uint) (models.Category, error) {
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		return category, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// FindCategoryByName resolves the old free-text category field to a category.
+// Names are matched case-insensitively; unknown names are rejected so typos
+// don't create phantom categories.
+func FindCategoryByName(db *gorm.DB, name string) (models.Category, error) {
+	var category models.Category
+	if err := db.Where("lower(name) = lower(?)", strings.TrimSpace(name)).
+		Order("parent_id NULLS FIRST, id").
+		First(&category).Error; err != nil {
+		return category, ErrCategoryNotFound
+	}
+	return category, nil
+}
+
+// CategoryWithDescendants returns the IDs of a category and everything below it
+func CategoryWithDescendants(db *gorm.DB, categoryID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Raw(`WITH RECURSIVE tree AS (
+			SELECT id FROM categories WHERE id = ? AND deleted_at IS NULL
+			UNION
+			SELECT c.id FROM categories c JOIN tree ON c.parent_id = tree.id WHERE c.deleted_at IS NULL
+		)
+		SELECT id FROM tree`, categoryID).Scan(&ids).Error
+	return ids, err
+}
+
+// ResolveCategory looks a ?category= value up by ID, slug or name
+func ResolveCategory(db *gorm.DB, ref string) (models.Category, error) {
+	category, err := FindCategory(db, ref)
+	if err != nil {
+		return FindCategoryByName(db, ref)
+	}
+	return category, nil
+}
+
+// CategoryFilter resolves a ?category= value (ID, slug or name) to the IDs of
+// that category and its subcategories
+func CategoryFilter(db *gorm.DB, ref string) ([]uint, error) {
+	category, err := ResolveCategory(db, ref)
+	if err != nil {
+		return nil, err
+	}
+	return CategoryWithDescendants(db, category.ID)
+}
+
+// CreateCategory adds a category, generating the slug from the name when none is given
+func CreateCategory(db *gorm.DB, input CategoryInput) (models.Category, error) {
+	category := models.Category{ParentID: input.ParentID}
+	if input.Name != nil {
+		category.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		category.Description = *input.Description
+	}
+	if input.ImageURL != nil {
+		category.ImageURL = *input.ImageURL
+	}
+	if input.Position != nil {
+		category.Position = *input.Position
+	}
+
+	if category.ParentID != nil {
+		if _, err := getCategory(db, *category.ParentID); err != nil {
+			return category, err
+		}
+	}
+	if err := ensureSiblingNameFree(db, category.ParentID, category.Name, 0); err != nil {
+		return category, err
+	}
+
+	if input.Slug != nil && strings.TrimSpace(*input.Slug) != "" {
+		slug := models.Slugify(*input.Slug)
+		if err := slugAvailable(db, slug, 0); err != nil {
+			return category, err
+		}
+		category.Slug = slug
+	} else {
+		category.Slug = models.UniqueCategorySlug(db, models.Slugify(category.Name), 0)
+	}
+
+	err := db.Create(&category).Error
+	return category, err
+}
+
+// UpdateCategory edits a category. Moving it under a new parent is refused
+// when that would create a cycle. A rename is copied to its products.
+func UpdateCategory(db *gorm.DB, id uint, input CategoryInput) (models.Category, error) {
+	category, err := getCategory(db, id)
+	if err != nil {
+		return category, err
+	}
+
+	updates := map[string]interface{}{}
+
+	parentID := category.ParentID
+	if input.ClearParent {
+		parentID = nil
+		updates["parent_id"] = nil
+	} else if input.ParentID != nil {
+		if err := ensureNoCycle(db, category.ID, *input.ParentID); err != nil {
+			return category, err
+		}
+		parentID = input.ParentID
+		updates["parent_id"] = *input.ParentID
+	}
+
+	name := category.Name
+	if input.Name != nil {
+		name = strings.TrimSpace(*input.Name)
+		updates["name"] = name
+	}
+	if input.Name != nil || input.ParentID != nil || input.ClearParent {
+		if err := ensureSiblingNameFree(db, parentID, name, category.ID); err != nil {
+			return category, err
+		}
+	}
+
+	if input.Slug != nil {
+		slug := models.Slugify(*input.Slug)
+		if err := slugAvailable(db, slug, category.ID); err != nil {
+			return category, err
+		}
+		updates["slug"] = slug
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.ImageURL != nil {
+		updates["image_url"] = *input.ImageURL
+	}
+	if input.Position != nil {
+		updates["position"] = *input.Position
+	}
+
+	if len(updates) == 0 {
+		return category, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&category).Updates(updates).Error; err != nil {
+			return err
+		}
+		if input.Name != nil {
+			return tx.Unscoped().Model(&models.Product{}).Where("category_id = ?", category.ID).Update("category", name).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return category, err
+	}
+
+	err = db.First(&category, category.ID).Error
+	return category, err
+}
+
+// DeleteCategory removes an empty category along with its attribute definitions
+func DeleteCategory(db *gorm.DB, id uint) error {
+	category, err := getCategory(db, id)
+	if err != nil {
+		return err
+	}
+
+	var children, products int64
+	db.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children)
+	db.Model(&models.Product{}).Where("category_id = ?", id).Count(&products)
+	if children > 0 || products > 0 {
+		return ErrCategoryInUse
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("category_id = ?", id).Delete(&models.AttributeDefinition{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+}
+
+// AssignProductCategory points a product at a category, by ID or by the old
+// free-text name, and copies the name onto the product
+func AssignProductCategory(db *gorm.DB, product *models.Product) error {
+	var (
+		category models.Category
+		err      error
+	)
+
+	switch {
+	case product.CategoryID != nil:
+		category, err = getCategory(db, *product.CategoryID)
+	case strings.TrimSpace(product.Category) != "":
+		category, err = FindCategoryByName(db, product.Category)
+	default:
+		product.Category = ""
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	product.CategoryID = &category.ID
+	product.Category = category.Name
+	return nil
+}
+
+// ensureNoCycle refuses a parent that is the category itself or below it
+func ensureNoCycle(db *gorm.DB, categoryID, parentID uint) error {
+	if _, err := getCategory(db, parentID); err != nil {
+		return err
+	}
+
+	below, err := CategoryWithDescendants(db, categoryID)
+	if err != nil {
+		return err
+	}
+	for _, id := range below {
+		if id == parentID {
+			return ErrCategoryCycle
+		}
+	}
+	return nil
+}
+
+// ensureSiblingNameFree keeps names unique among siblings
+func ensureSiblingNameFree(db *gorm.DB, parentID *uint, name string, exceptID uint) error {
+	query := db.Model(&models.Category{}).Where("lower(name) = lower(?) AND id <> ?", name, exceptID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		return ErrCategoryExists
+	}
+	return nil
+}
+
+func slugAvailable(db *gorm.DB, slug string, exceptID uint) error {
+	if slug == "" {
+		return ErrInvalidSlug
+	}
+
+	var count int64
+	db.Unscoped().Model(&models.Category{}).Where("slug = ? AND id <> ?", slug, exceptID).Count(&count)
+	if count > 0 {
+		return ErrSlugTaken
+	}
+	return nil
+}
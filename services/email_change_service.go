@@ -0,0 +1,253 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailTaken           = errors.New("email is already in use")
+	ErrSameEmail            = errors.New("new email is the same as the current one")
+	ErrNoPendingEmailChange = errors.New("no pending email change")
+	ErrInvalidRevertToken   = errors.New("revert link is invalid or has expired")
+)
+
+// RequestEmailChange starts a change of the user's email by sending an OTP to
+// the new address. A newer request replaces any pending one.
+func RequestEmailChange(db *gorm.DB, user models.User, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		return ErrSameEmail
+	}
+
+	taken, err := emailTaken(db, newEmail, user.ID)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrEmailTaken
+	}
+
+	// Cooldown errors surface here, before the pending request is replaced
+	if _, err := GenerateOTP(user.ID, newEmail, "change_email"); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.EmailChangeRequest{}).
+			Where("user_id = ? AND status = ?", user.ID, "pending").
+			Update("status", "cancelled").Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.EmailChangeRequest{
+			UserID:   user.ID,
+			OldEmail: user.Email,
+			NewEmail: newEmail,
+			Status:   "pending",
+		}).Error
+	})
+}
+
+// ConfirmEmailChange checks the OTP sent to the new address and switches the
+// user over to it. A code mailed anywhere else, such as the current address,
+// is not accepted. Returns the updated user.
+func ConfirmEmailChange(db *gorm.DB, userID uint, otp string) (models.User, error) {
+	var req models.EmailChangeRequest
+	if err := db.Where("user_id = ? AND status = ?", userID, "pending").
+		Order("created_at desc").
+		First(&req).Error; err != nil {
+		return models.User{}, ErrNoPendingEmailChange
+	}
+
+	if _, err := ValidateOTPSentTo(userID, otp, "change_email", req.NewEmail); err != nil {
+		return models.User{}, err
+	}
+
+	return applyEmailChange(db, &req)
+}
+
+// AdminChangeEmail changes a user's email without an OTP. The old address is
+// still notified and can revert the change.
+func AdminChangeEmail(db *gorm.DB, userID uint, newEmail string) (models.User, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return models.User{}, err
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if strings.EqualFold(newEmail, user.Email) {
+		return models.User{}, ErrSameEmail
+	}
+
+	req := models.EmailChangeRequest{
+		UserID:   user.ID,
+		OldEmail: user.Email,
+		NewEmail: newEmail,
+		Status:   "pending",
+	}
+	if err := db.Create(&req).Error; err != nil {
+		return models.User{}, err
+	}
+
+	return applyEmailChange(db, &req)
+}
+
+// RevertEmailChange puts the old email back, using the link mailed to the old
+// address. All sessions are revoked since the account may have been taken over.
+func RevertEmailChange(db *gorm.DB, token string) (models.EmailChangeRequest, error) {
+	var req models.EmailChangeRequest
+	if err := db.Where("revert_token = ? AND status = ?", hashToken(token), "confirmed").
+		First(&req).Error; err != nil {
+		return req, ErrInvalidRevertToken
+	}
+	if req.RevertExpiresAt == nil || time.Now().After(*req.RevertExpiresAt) {
+		return req, ErrInvalidRevertToken
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		taken, err := emailTaken(tx, req.OldEmail, req.UserID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+
+		// Only revert if the email hasn't been changed again since
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND email = ?", req.UserID, req.NewEmail).
+			Updates(map[string]interface{}{"email": req.OldEmail, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidRevertToken
+		}
+
+		now := time.Now()
+		return tx.Model(&req).Updates(map[string]interface{}{
+			"status":      "reverted",
+			"reverted_at": now,
+		}).Error
+	})
+	if err != nil {
+		return req, err
+	}
+
+	if err := revokeAllUserTokens(db, req.UserID); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+// applyEmailChange moves the user to req.NewEmail, revokes their tokens and
+// mails a revert link to the old address
+func applyEmailChange(db *gorm.DB, req *models.EmailChangeRequest) (models.User, error) {
+	revertToken, revertHash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return models.User{}, err
+	}
+	revertExpiresAt := time.Now().Add(emailChangeRevertWindow())
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// The unique index would reject it anyway; this gives a clean error
+		taken, err := emailTaken(tx, req.NewEmail, req.UserID)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+
+		if err := tx.Model(&models.User{}).
+			Where("id = ?", req.UserID).
+			Updates(map[string]interface{}{
+				"email":       req.NewEmail,
+				"is_verified": true,
+				"updated_at":  time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(req).Updates(map[string]interface{}{
+			"status":            "confirmed",
+			"confirmed_at":      now,
+			"revert_token":      revertHash,
+			"revert_expires_at": revertExpiresAt,
+		}).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	// Sessions and access tokens were issued to the old identity
+	if err := revokeAllUserTokens(db, req.UserID); err != nil {
+		return models.User{}, err
+	}
+
+	sendEmailChangedNotice(req.OldEmail, req.NewEmail, revertToken, revertExpiresAt)
+
+	var user models.User
+	if err := db.First(&user, req.UserID).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// emailTaken reports whether another account, soft-deleted ones included, uses email
+func emailTaken(db *gorm.DB, email string, exceptUserID uint) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&models.User{}).
+		Where("LOWER(email) = LOWER(?) AND id <> ?", email, exceptUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func revokeAllUserTokens(db *gorm.DB, userID uint) error {
+	if err := BumpTokenVersion(db, userID); err != nil {
+		return err
+	}
+	return utils.RevokeUserSessions(db, userID)
+}
+
+func sendEmailChangedNotice(oldEmail, newEmail, revertToken string, expiresAt time.Time) {
+	link := emailChangeRevertURL() + "?token=" + url.QueryEscape(revertToken)
+	body := fmt.Sprintf("The email address on your account was changed to %s.\r\n\r\nIf you didn't do this, use the link below before %s to switch it back and sign out every session:\r\n\r\n%s",
+		newEmail, expiresAt.Format(time.RFC1123), link)
+
+	if err := SendEmail(oldEmail, "Your account email was changed", body); err != nil {
+		log.Printf("❌ Could not send email change notice to %s: %v", oldEmail, err)
+	}
+}
+
+// hashToken returns the sha256 hex digest we store in place of a bearer token
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// emailChangeRevertWindow is how long the old address can undo a change (EMAIL_CHANGE_REVERT_WINDOW)
+func emailChangeRevertWindow() time.Duration {
+	return envDuration("EMAIL_CHANGE_REVERT_WINDOW", 72*time.Hour)
+}
+
+// emailChangeRevertURL is the storefront page that posts the token back to /auth/email/revert
+func emailChangeRevertURL() string {
+	if base := os.Getenv("EMAIL_CHANGE_REVERT_URL"); base != "" {
+		return base
+	}
+	return "http://localhost:5173/revert-email"
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// stripImageMetadata drops the parts of an image file that carry metadata
+// rather than pixels (EXIF with GPS and camera details, XMP, comments)
+// without re-encoding, so the stored original keeps its quality
+func stripImageMetadata(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	case "image/gif":
+		return stripGIFMetadata(data)
+	}
+	return nil, ErrUnsupportedImage
+}
+
+// stripJPEGMetadata drops APPn segments other than JFIF (APP0), the ICC
+// color profile (APP2) and Adobe's color transform (APP14), and comments
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrUnsupportedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	for i := 2; ; {
+		if i+1 >= len(data) || data[i] != 0xFF {
+			return nil, ErrUnsupportedImage
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF: // fill byte before a marker
+			i++
+			continue
+		case marker == 0xDA: // start of scan: the rest is image data
+			return append(out, data[i:]...), nil
+		case marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			out = append(out, data[i:i+2]...) // markers without a length
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		metadata := marker == 0xFE || (marker >= 0xE1 && marker <= 0xEF && marker != 0xE2 && marker != 0xEE)
+		if !metadata {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// pngMetadataChunks carry text, EXIF or timestamps rather than pixels
+var pngMetadataChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil, ErrUnsupportedImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, signature...)
+	for i := len(signature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end < i+12 || end > len(data) {
+			return nil, ErrUnsupportedImage
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// stripGIFMetadata drops comment extensions and application extensions other
+// than the animation loop count, which is where GIFs carry XMP
+func stripGIFMetadata(data []byte) ([]byte, error) {
+	if len(data) < 13 || (!bytes.HasPrefix(data, []byte("GIF87a")) && !bytes.HasPrefix(data, []byte("GIF89a"))) {
+		return nil, ErrUnsupportedImage
+	}
+
+	// Header, logical screen descriptor and global color table
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, ErrUnsupportedImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+
+	// subBlocks returns where a chain of data sub-blocks starting at j ends
+	subBlocks := func(j int) (int, bool) {
+		for j < len(data) {
+			size := int(data[j])
+			j += 1 + size
+			if size == 0 {
+				return j, j <= len(data)
+			}
+		}
+		return 0, false
+	}
+
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3B: // trailer
+			return append(out, data[i]), nil
+		case 0x21: // extension
+			if i+2 > len(data) {
+				return nil, ErrUnsupportedImage
+			}
+			label := data[i+1]
+			end, ok := subBlocks(i + 2)
+			if !ok {
+				return nil, ErrUnsupportedImage
+			}
+			keep := label != 0xFE
+			if label == 0xFF {
+				app := data[i+2 : min(i+14, end)]
+				keep = bytes.HasPrefix(app, []byte("\x0bNETSCAPE2.0")) || bytes.HasPrefix(app, []byte("\x0bANIMEXTS1.0"))
+			}
+			if keep {
+				out = append(out, data[start:end]...)
+			}
+			i = end
+		case 0x2C: // image descriptor, optional local color table, then LZW data
+			if i+10 > len(data) {
+				return nil, ErrUnsupportedImage
+			}
+			j := i + 10
+			if flags := data[i+9]; flags&0x80 != 0 {
+				j += 3 << (flags&0x07 + 1)
+			}
+			end, ok := subBlocks(j + 1) // skip the LZW minimum code size
+			if !ok {
+				return nil, ErrUnsupportedImage
+			}
+			out = append(out, data[start:end]...)
+			i = end
+		default:
+			return nil, ErrUnsupportedImage
+		}
+	}
+	// Some encoders leave off the trailer; the decoder accepted it already
+	return out, nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+var (
+	ErrImageTooLarge      = errors.New("image is too large")
+	ErrUnsupportedImage   = errors.New("only JPEG, PNG and GIF images are supported")
+	ErrImageTooManyPixels = errors.New("image dimensions are too large")
+)
+
+// Formats we accept, by sniffed content type, with the file extension they get
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// maxImagePixels guards against decompression bombs (tiny files, huge bitmaps).
+// Decoding plus the thumbnail's RGBA copy costs about 8 bytes per pixel.
+const maxImagePixels = 40_000_000
+
+// MaxUploadBytes is the largest image file accepted (UPLOAD_MAX_BYTES, default 5 MB)
+func MaxUploadBytes() int64 {
+	return int64(envInt("UPLOAD_MAX_BYTES", 5<<20))
+}
+
+// thumbnailSize is the longest edge of generated thumbnails (THUMBNAIL_SIZE, default 320)
+func thumbnailSize() int {
+	return envInt("THUMBNAIL_SIZE", 320)
+}
+
+// StoredImage is an uploaded image and its thumbnail, as saved to storage
+type StoredImage struct {
+	Key          string
+	ThumbnailKey string
+	ContentType  string
+	Width        int
+	Height       int
+	SizeBytes    int64
+}
+
+// StoreImage checks an upload really is a supported image, then saves it
+// under prefix along with a thumbnail whose longest edge is thumbEdge pixels
+// (0 for the configured default). Images over maxPixels (0 for the default
+// cap) are refused. The content type is sniffed from the bytes; whatever the
+// client claimed is ignored, and EXIF and other metadata are stripped before
+// the original is stored.
+func StoreImage(ctx context.Context, r io.Reader, prefix string, thumbEdge, maxPixels int) (*StoredImage, error) {
+	limit := MaxUploadBytes()
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrImageTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedImage
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+	if maxPixels <= 0 {
+		maxPixels = maxImagePixels
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, ErrImageTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	// Location and camera details must not be served with the original
+	data, err = stripImageMetadata(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	if thumbEdge <= 0 {
+		thumbEdge = thumbnailSize()
+	}
+	thumb, thumbType, err := encodeThumbnail(img, contentType, thumbEdge)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := randomName()
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &StoredImage{
+		Key:          prefix + "/" + name + ext,
+		ThumbnailKey: prefix + "/" + name + "_thumb" + imageExtensions[thumbType],
+		ContentType:  contentType,
+		Width:        cfg.Width,
+		Height:       cfg.Height,
+		SizeBytes:    int64(len(data)),
+	}
+
+	store := FileStorage()
+	if err := store.Put(ctx, stored.Key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+	if err := store.Put(ctx, stored.ThumbnailKey, bytes.NewReader(thumb), int64(len(thumb)), thumbType); err != nil {
+		store.Delete(ctx, stored.Key)
+		return nil, err
+	}
+	return stored, nil
+}
+
+// DeleteStoredFiles removes files from storage, ignoring empty keys
+func DeleteStoredFiles(ctx context.Context, keys ...string) error {
+	var firstErr error
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := FileStorage().Delete(ctx, key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// encodeThumbnail scales img to fit within edge x edge. JPEGs stay JPEG;
+// PNG and GIF become PNG so transparency survives.
+func encodeThumbnail(img image.Image, contentType string, edge int) ([]byte, string, error) {
+	thumb := fitWithin(img, edge)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "image/jpeg", nil
+	}
+
+	if err := png.Encode(&buf, thumb); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// fitWithin downscales by averaging every source pixel that falls in each
+// target pixel, which keeps thumbnails smooth without an imaging library.
+// Images already small enough are returned as they are.
+func fitWithin(src image.Image, edge int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= edge && h <= edge {
+		return src
+	}
+
+	tw, th := edge, h*edge/w
+	if h > w {
+		tw, th = w*edge/h, edge
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := y*h/th, max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := x*w/tw, max((x+1)*w/tw, x*w/tw+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					bl += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(bl / n), uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+func randomName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("random name: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// PermissionImpersonate lets support staff act as a customer
+const PermissionImpersonate = "users:impersonate"
+
+var (
+	ErrImpersonateSelf    = errors.New("you can't impersonate yourself")
+	ErrImpersonateStaff   = errors.New("staff accounts can't be impersonated")
+	ErrImpersonateBlocked = errors.New("blocked accounts can't be impersonated")
+)
+
+// StartImpersonation issues an impersonation token for the target user and
+// logs who asked for it and why
+func StartImpersonation(db *gorm.DB, adminID, userID uint, reason, ip string) (string, models.User, error) {
+	if adminID == userID {
+		return "", models.User{}, ErrImpersonateSelf
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return "", user, err
+	}
+	if user.IsBlocked {
+		return "", user, ErrImpersonateBlocked
+	}
+
+	// Acting as someone with admin permissions would be a privilege escalation
+	perms, err := rolePermissions(db, user.Role)
+	if err != nil {
+		return "", user, err
+	}
+	if len(perms) > 0 {
+		return "", user, ErrImpersonateStaff
+	}
+
+	token, jti, err := utils.GenerateImpersonationJWT(user, adminID)
+	if err != nil {
+		return "", user, err
+	}
+
+	entry := models.ImpersonationLog{
+		AdminID:   adminID,
+		UserID:    user.ID,
+		TokenJTI:  jti,
+		Action:    "issued",
+		Reason:    reason,
+		IPAddress: ip,
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		return "", user, err
+	}
+
+	return token, user, nil
+}
+
+// ImpersonatorAllowed reports whether the admin behind an impersonation token
+// may still impersonate, so demoting or blocking them ends it at once
+func ImpersonatorAllowed(db *gorm.DB, adminID uint) (bool, error) {
+	var admin models.User
+	if err := db.First(&admin, adminID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if admin.IsBlocked {
+		return false, nil
+	}
+	return HasPermission(db, admin.Role, PermissionImpersonate)
+}
+
+// RecordImpersonatedRequest adds a request made with an impersonation token to the audit log
+func RecordImpersonatedRequest(db *gorm.DB, claims *utils.AccessClaims, method, path string, status int, ip string, blocked bool) error {
+	action := "request"
+	if blocked {
+		action = "blocked"
+	}
+	return db.Create(&models.ImpersonationLog{
+		AdminID:    uint(claims.ActorID),
+		UserID:     uint(claims.UserID),
+		TokenJTI:   claims.JTI,
+		Action:     action,
+		Method:     method,
+		Path:       path,
+		StatusCode: status,
+		IPAddress:  ip,
+	}).Error
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// Lockout settings, overridable via LOGIN_MAX_FAILURES, LOGIN_FAILURE_WINDOW,
+// LOGIN_LOCKOUT_BASE and LOGIN_LOCKOUT_MAX
+func lockoutPolicy() (maxFailures int, window, base, max time.Duration) {
+	maxFailures = envInt("LOGIN_MAX_FAILURES", 5)
+	window = envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute)
+	base = envDuration("LOGIN_LOCKOUT_BASE", 5*time.Minute)
+	max = envDuration("LOGIN_LOCKOUT_MAX", 24*time.Hour)
+	return
+}
+
+// lockoutReasons are the failures that count towards a lockout: wrong
+// credentials. Attempts refused for other reasons (locked, unverified,
+// blocked...) never extend or escalate a lock.
+var lockoutReasons = []string{"bad_password", "bad_2fa"}
+
+// RecordLoginAttempt writes one entry to the login audit trail
+func RecordLoginAttempt(db *gorm.DB, userID *uint, email string, client utils.SessionInfo, success bool, reason string) {
+	attempt := models.LoginAttempt{
+		UserID:    userID,
+		Email:     email,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+		Success:   success,
+		Reason:    reason,
+	}
+	if err := db.Create(&attempt).Error; err != nil {
+		log.Printf("❌ Could not record login attempt for %s: %v", email, err)
+	}
+}
+
+// LockRemaining returns how long the account stays locked, or 0
+func LockRemaining(user models.User) time.Duration {
+	if user.LockedUntil == nil {
+		return 0
+	}
+	if remaining := time.Until(*user.LockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// RegisterFailedLogin records a failed password or 2FA code and locks the account once the
+// limit is reached. Every lockout doubles the previous one, up to the max.
+func RegisterFailedLogin(db *gorm.DB, user *models.User, client utils.SessionInfo, reason string) (time.Duration, error) {
+	RecordLoginAttempt(db, &user.ID, user.Email, client, false, reason)
+
+	maxFailures, window, base, max := lockoutPolicy()
+
+	// Only failures after the last success and after the last lock count
+	since := time.Now().Add(-window)
+	if user.LockedUntil != nil && user.LockedUntil.After(since) {
+		since = *user.LockedUntil
+	}
+	var lastSuccess models.LoginAttempt
+	if err := db.Where("user_id = ? AND success = ?", user.ID, true).
+		Order("created_at desc").
+		First(&lastSuccess).Error; err == nil && lastSuccess.CreatedAt.After(since) {
+		since = lastSuccess.CreatedAt
+	}
+
+	var failures int64
+	if err := db.Model(&models.LoginAttempt{}).
+		Where("user_id = ? AND success = ? AND reason IN ? AND created_at > ?", user.ID, false, lockoutReasons, since).
+		Count(&failures).Error; err != nil {
+		return 0, err
+	}
+
+	if int(failures) < maxFailures {
+		return 0, nil
+	}
+
+	duration := base << user.LockoutCount
+	if duration > max || duration <= 0 {
+		duration = max
+	}
+	lockedUntil := time.Now().Add(duration)
+
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"locked_until":  lockedUntil,
+		"lockout_count": gorm.Expr("lockout_count + 1"),
+	}).Error; err != nil {
+		return 0, err
+	}
+
+	go sendLockoutEmail(user.Email, duration)
+	return duration, nil
+}
+
+// knownDeviceLogins is how many past successful logins are checked for a known IP and device
+const knownDeviceLogins = 100
+
+// RegisterSuccessfulLogin records the login, resets the lockout streak and
+// alerts the user when the login comes from a device or IP we haven't seen
+func RegisterSuccessfulLogin(db *gorm.DB, user models.User, client utils.SessionInfo, method string) {
+	// Only the most recent logins count as known devices, which keeps this
+	// an index range scan however long the history grows
+	var previous []models.LoginAttempt
+	db.Select("ip_address", "user_agent").
+		Where("user_id = ? AND success = ?", user.ID, true).
+		Order("created_at DESC").
+		Limit(knownDeviceLogins).
+		Find(&previous)
+
+	RecordLoginAttempt(db, &user.ID, user.Email, client, true, method)
+
+	if user.LockoutCount > 0 {
+		db.Model(&user).Update("lockout_count", 0)
+	}
+
+	// First login ever is not "new" for the user
+	if len(previous) == 0 {
+		return
+	}
+
+	knownIP, knownAgent := false, false
+	for _, p := range previous {
+		knownIP = knownIP || p.IPAddress == client.IPAddress
+		knownAgent = knownAgent || p.UserAgent == client.UserAgent
+	}
+
+	if !knownIP || !knownAgent {
+		go sendNewLoginEmail(user.Email, client)
+	}
+}
+
+// UnlockAccount lifts a lockout; earlier failures no longer count towards the next one
+func UnlockAccount(db *gorm.DB, userID uint) error {
+	return db.Model(&models.User{}).
+		Where("id = ?", userID).
+		Updates(map[string]interface{}{
+			"locked_until":  time.Now(),
+			"lockout_count": 0,
+		}).Error
+}
+
+func sendNewLoginEmail(email string, client utils.SessionInfo) {
+	body := fmt.Sprintf("We noticed a new sign-in to your account.\r\n\r\nTime: %s\r\nIP address: %s\r\nDevice: %s\r\n\r\nIf this was you, no action is needed. If not, reset your password and log out of all sessions right away.",
+		time.Now().Format(time.RFC1123), client.IPAddress, client.UserAgent)
+
+	if err := SendEmail(email, "New sign-in to your account", body); err != nil {
+		log.Printf("❌ Could not send new sign-in alert to %s: %v", email, err)
+	}
+}
+
+func sendLockoutEmail(email string, duration time.Duration) {
+	body := fmt.Sprintf("Your account was locked for %s after too many failed sign-in attempts.\r\n\r\nIf this wasn't you, consider resetting your password.", duration.Round(time.Minute))
+
+	if err := SendEmail(email, "Your account has been temporarily locked", body); err != nil {
+		log.Printf("❌ Could not send lockout email to %s: %v", email, err)
+	}
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// maxChallengeAttempts is how many codes can be tried with one challenge token
+const maxChallengeAttempts = 5
+
+// ErrChallengeSpent is returned for a challenge that was used, ran out of attempts or expired
+var ErrChallengeSpent = errors.New("challenge token was already used or had too many attempts, please log in again")
+
+// StartLoginChallenge issues a challenge token for the next login step and
+// records it, so it can be used once and only guessed at a few times
+func StartLoginChallenge(db *gorm.DB, userID uint, purpose string) (string, error) {
+	token, jti, err := utils.GenerateChallengeToken(userID, purpose)
+	if err != nil {
+		return "", err
+	}
+
+	if err := db.Create(&models.LoginChallenge{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(utils.ChallengeTokenTTL),
+	}).Error; err != nil {
+		return "", err
+	}
+
+	// Expired challenges are rejected by their token anyway
+	db.Where("expires_at < ?", time.Now()).Delete(&models.LoginChallenge{})
+
+	return token, nil
+}
+
+// ReserveChallengeAttempt counts one code attempt against a challenge before
+// the code is checked, so parallel guesses can't exceed the limit
+func ReserveChallengeAttempt(db *gorm.DB, jti string) error {
+	result := db.Model(&models.LoginChallenge{}).
+		Where("jti = ? AND used_at IS NULL AND attempts < ? AND expires_at > ?", jti, maxChallengeAttempts, time.Now()).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChallengeSpent
+	}
+	return nil
+}
+
+// FinishLoginChallenge burns a challenge once its step succeeded
+func FinishLoginChallenge(db *gorm.DB, jti string) error {
+	result := db.Model(&models.LoginChallenge{}).
+		Where("jti = ? AND used_at IS NULL", jti).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrChallengeSpent
+	}
+	return nil
+}
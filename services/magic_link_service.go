@@ -0,0 +1,53 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+)
+
+// SendMagicLink emails the user a single-use, short-lived sign-in link
+func SendMagicLink(user models.User) error {
+	code, cfg, err := issueOTP(user.ID, "magic_link", user.Email)
+	if err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateMagicLinkToken(user.ID, code, cfg.TTL)
+	if err != nil {
+		return err
+	}
+
+	link := magicLinkBaseURL() + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Click the link below to sign in. It expires in %d minutes and can only be used once.\r\n\r\n%s\r\n\r\nIf you didn't ask for this, you can ignore this email.", int(cfg.TTL.Minutes()), link)
+
+	if err := SendEmail(user.Email, cfg.Subject, body); err != nil {
+		return fmt.Errorf("failed to send sign-in link: %w", err)
+	}
+	return nil
+}
+
+// ConsumeMagicLink validates a sign-in link token, burns it and returns the user ID
+func ConsumeMagicLink(token string) (uint, error) {
+	userID, code, err := utils.ValidateMagicLinkToken(token)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := ValidateOTP(userID, code, "magic_link"); err != nil {
+		return 0, fmt.Errorf("sign-in link is invalid or was already used")
+	}
+
+	return userID, nil
+}
+
+// magicLinkBaseURL is the storefront page that posts the token back to /auth/magic-link/consume
+func magicLinkBaseURL() string {
+	if base := os.Getenv("MAGIC_LINK_URL"); base != "" {
+		return base
+	}
+	return "http://localhost:5173/magic-login"
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrImageNotFound = errors.New("image not found")
+	ErrImageOrder    = errors.New("image_ids must list every image of the product exactly once")
+	ErrGalleryFull   = errors.New("product gallery is full")
+)
+
+const (
+	MaxGalleryImages    = 20         // images per product
+	avatarThumbnailEdge = 256        // avatars are stored at this size for display
+	avatarMaxPixels     = 16_000_000 // enough for a phone photo, far below the catalog cap
+)
+
+// AddProductImage stores an uploaded image at the end of a product's gallery.
+// The first image becomes the product's main image.
+func AddProductImage(ctx context.Context, db *gorm.DB, productID uint, r io.Reader, altText string) (models.ProductImage, error) {
+	if err := productExists(db, productID); err != nil {
+		return models.ProductImage{}, err
+	}
+
+	var count int64
+	db.Model(&models.ProductImage{}).Where("product_id = ?", productID).Count(&count)
+	if count >= MaxGalleryImages {
+		return models.ProductImage{}, ErrGalleryFull
+	}
+
+	stored, err := StoreImage(ctx, r, fmt.Sprintf("products/%d", productID), 0, 0)
+	if err != nil {
+		return models.ProductImage{}, err
+	}
+
+	image := models.ProductImage{
+		ProductID:    productID,
+		Key:          stored.Key,
+		ThumbnailKey: stored.ThumbnailKey,
+		URL:          MediaURL(stored.Key),
+		ThumbnailURL: MediaURL(stored.ThumbnailKey),
+		ContentType:  stored.ContentType,
+		Width:        stored.Width,
+		Height:       stored.Height,
+		SizeBytes:    stored.SizeBytes,
+		AltText:      strings.TrimSpace(altText),
+		Position:     int(count),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&image).Error; err != nil {
+			return err
+		}
+		return syncMainImage(tx, productID, "")
+	})
+	if err != nil {
+		DeleteStoredFiles(ctx, stored.Key, stored.ThumbnailKey)
+		return models.ProductImage{}, err
+	}
+	return image, nil
+}
+
+// ProductImages lists a product's gallery in display order
+func ProductImages(db *gorm.DB, productID uint) ([]models.ProductImage, error) {
+	images := []models.ProductImage{}
+	err := db.Where("product_id = ?", productID).Order("position, id").Find(&images).Error
+	return images, err
+}
+
+// ReorderProductImages puts the gallery in the given order; the first becomes the main image
+func ReorderProductImages(db *gorm.DB, productID uint, imageIDs []uint) ([]models.ProductImage, error) {
+	images, err := ProductImages(db, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[uint]bool, len(images))
+	for _, img := range images {
+		existing[img.ID] = true
+	}
+	if len(imageIDs) != len(images) {
+		return nil, ErrImageOrder
+	}
+	for _, id := range imageIDs {
+		if !existing[id] {
+			return nil, ErrImageOrder
+		}
+		delete(existing, id) // catches duplicates
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for position, id := range imageIDs {
+			if err := tx.Model(&models.ProductImage{}).Where("id = ?", id).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return syncMainImage(tx, productID, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ProductImages(db, productID)
+}
+
+// DeleteProductImage removes an image from the gallery and from storage
+func DeleteProductImage(ctx context.Context, db *gorm.DB, productID, imageID uint) error {
+	var image models.ProductImage
+	if err := db.Where("id = ? AND product_id = ?", imageID, productID).First(&image).Error; err != nil {
+		return ErrImageNotFound
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&image).Error; err != nil {
+			return err
+		}
+		// Close the gap it leaves
+		if err := tx.Model(&models.ProductImage{}).
+			Where("product_id = ? AND position > ?", productID, image.Position).
+			Update("position", gorm.Expr("position - 1")).Error; err != nil {
+			return err
+		}
+		return syncMainImage(tx, productID, image.URL)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := DeleteStoredFiles(ctx, image.Key, image.ThumbnailKey); err != nil {
+		log.Printf("⚠️ Could not delete files of product image %d: %v", image.ID, err)
+	}
+	return nil
+}
+
+// syncMainImage points products.image_url at the first gallery image. When
+// the gallery is empty, an image_url that was removedURL is cleared; one set
+// by hand is kept.
+func syncMainImage(tx *gorm.DB, productID uint, removedURL string) error {
+	var first models.ProductImage
+	err := tx.Where("product_id = ?", productID).Order("position, id").First(&first).Error
+	if err == nil {
+		return tx.Model(&models.Product{}).Where("id = ?", productID).Update("image_url", first.URL).Error
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if removedURL == "" {
+		return nil
+	}
+	return tx.Model(&models.Product{}).Where("id = ? AND image_url = ?", productID, removedURL).Update("image_url", "").Error
+}
+
+// SetAvatar stores an uploaded avatar, resized for display, and replaces the old one
+func SetAvatar(ctx context.Context, db *gorm.DB, userID uint, r io.Reader) (string, error) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return "", err
+	}
+
+	stored, err := StoreImage(ctx, r, fmt.Sprintf("avatars/%d", userID), avatarThumbnailEdge, avatarMaxPixels)
+	if err != nil {
+		return "", err
+	}
+
+	// Profiles only ever show the resized image
+	url := MediaURL(stored.ThumbnailKey)
+	if err := db.Model(&user).Updates(map[string]interface{}{
+		"avatar_url":  url,
+		"avatar_keys": stored.Key + " " + stored.ThumbnailKey,
+	}).Error; err != nil {
+		DeleteStoredFiles(ctx, stored.Key, stored.ThumbnailKey)
+		return "", err
+	}
+
+	deleteAvatarFiles(ctx, user)
+	return url, nil
+}
+
+// RemoveAvatar clears the user's avatar and deletes an uploaded one from storage
+func RemoveAvatar(ctx context.Context, db *gorm.DB, userID uint) error {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	if err := db.Model(&user).Updates(map[string]interface{}{"avatar_url": nil, "avatar_keys": ""}).Error; err != nil {
+		return err
+	}
+
+	deleteAvatarFiles(ctx, user)
+	return nil
+}
+
+func deleteAvatarFiles(ctx context.Context, user models.User) {
+	if err := DeleteStoredFiles(ctx, strings.Fields(user.AvatarKeys)...); err != nil {
+		log.Printf("⚠️ Could not delete old avatar of user %d: %v", user.ID, err)
+	}
+}
@@ -2,14 +2,18 @@ package services
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
 	"gorm.io/gorm"
 )
 
 type OrderItemResponse struct {
 	ProductID uint    `json:"product_id"`
+	VariantID uint    `json:"variant_id"`
+	SKU       string  `json:"sku"`
 	Name      string  `json:"name"`
 	Quantity  int     `json:"quantity"`
 	Price     float64 `json:"price"`
@@ -27,7 +31,7 @@ type OrderResponse struct {
 
 func CreateOrder(db *gorm.DB, userID uint, address string) (*OrderResponse, error) {
 	var cartItems []models.CartItem
-	if err := db.Where("user_id = ?", userID).Preload("Product").Find(&cartItems).Error; err != nil {
+	if err := db.Where("user_id = ?", userID).Preload("Product").Preload("Variant").Find(&cartItems).Error; err != nil {
 		return nil, err
 	}
 
@@ -35,6 +39,20 @@ func CreateOrder(db *gorm.DB, userID uint, address string) (*OrderResponse, erro
 		return nil, errors.New("cart is empty")
 	}
 
+	for _, item := range cartItems {
+		if item.Variant.ID == 0 {
+			return nil, fmt.Errorf("%s is no longer available", item.Product.Name)
+		}
+		if item.Quantity > item.Variant.StockQuantity {
+			return nil, fmt.Errorf("not enough stock for %s (%s)", item.Product.Name, item.Variant.SKU)
+		}
+	}
+
+	// Charge the price in force now, sales included
+	if err := PriceCartItems(db, cartItems, time.Now()); err != nil {
+		return nil, err
+	}
+
 	tx := db.Begin()
 
 	order := models.Order{
@@ -55,14 +73,16 @@ func CreateOrder(db *gorm.DB, userID uint, address string) (*OrderResponse, erro
 
 	// Add items to order (but don't deduct stock yet)
 	for _, item := range cartItems {
-		itemTotal := float64(item.Quantity) * item.Product.Price
+		itemTotal := float64(item.Quantity) * item.Variant.EffectivePrice
 		totalAmount += itemTotal
 
 		orderItem := models.OrderItem{
 			OrderID:   order.ID,
 			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			SKU:       item.Variant.SKU,
 			Quantity:  item.Quantity,
-			Price:     item.Product.Price,
+			Price:     item.Variant.EffectivePrice,
 			CreatedAt: time.Now(),
 		}
 
@@ -92,6 +112,8 @@ func CreateOrder(db *gorm.DB, userID uint, address string) (*OrderResponse, erro
 	for _, oi := range fullOrder.OrderItems {
 		items = append(items, OrderItemResponse{
 			ProductID: oi.ProductID,
+			VariantID: oi.VariantID,
+			SKU:       oi.SKU,
 			Name:      oi.Product.Name,
 			Quantity:  oi.Quantity,
 			Price:     oi.Price,
@@ -128,6 +150,8 @@ func GetUserOrders(db *gorm.DB, userID uint) ([]OrderResponse, error) {
 		for _, oi := range order.OrderItems {
 			items = append(items, OrderItemResponse{
 				ProductID: oi.ProductID,
+				VariantID: oi.VariantID,
+				SKU:       oi.SKU,
 				Name:      oi.Product.Name,
 				Quantity:  oi.Quantity,
 				Price:     oi.Price,
@@ -148,25 +172,51 @@ func GetUserOrders(db *gorm.DB, userID uint) ([]OrderResponse, error) {
 	return resp, nil
 }
 
-// Returns all orders for admin
-func GetAllOrders(db *gorm.DB, status string) ([]OrderResponse, error) {
+// OrderListSorts are the fields admins can sort orders by
+var OrderListSorts = utils.ListSpec{
+	SortFields: map[string]string{
+		"created_at":   "created_at",
+		"total_amount": "total_amount",
+		"status":       "status",
+		"id":           "id",
+	},
+	DefaultSort: "-created_at",
+}
+
+// OrderFilters narrows the admin order list; nil/empty fields are ignored
+type OrderFilters struct {
+	Status      string
+	UserID      *uint
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time // exclusive
+}
+
+// Returns a page of orders for admin
+func GetAllOrders(db *gorm.DB, filters OrderFilters, params utils.ListParams) ([]OrderResponse, utils.PageInfo, error) {
 	var orders []models.Order
-	query := db.Preload("User").Preload("OrderItems.Product").Order("created_at desc")
+	query := db.Preload("User").Preload("OrderItems.Product")
 
-	if status != "" && status != "all" {
-		query = query.Where("status = ?", status)
+	if filters.Status != "" && filters.Status != "all" {
+		query = query.Where("orders.status = ?", filters.Status)
 	}
+	if filters.UserID != nil {
+		query = query.Where("orders.user_id = ?", *filters.UserID)
+	}
+	query = utils.WhereRange(query, "orders.created_at", filters.CreatedFrom, filters.CreatedTo)
 
-	if err := query.Find(&orders).Error; err != nil {
-		return nil, err
+	info, err := utils.Paginate(query, params, &orders)
+	if err != nil {
+		return nil, info, err
 	}
 
-	var resp []OrderResponse
+	resp := make([]OrderResponse, 0, len(orders))
 	for _, order := range orders {
 		items := make([]OrderItemResponse, 0)
 		for _, oi := range order.OrderItems {
 			items = append(items, OrderItemResponse{
 				ProductID: oi.ProductID,
+				VariantID: oi.VariantID,
+				SKU:       oi.SKU,
 				Name:      oi.Product.Name,
 				Quantity:  oi.Quantity,
 				Price:     oi.Price,
@@ -184,7 +234,7 @@ func GetAllOrders(db *gorm.DB, status string) ([]OrderResponse, error) {
 		})
 	}
 
-	return resp, nil
+	return resp, info, nil
 }
 
 // Update order status (Admin)
@@ -223,6 +273,8 @@ func UpdateOrderStatusAdmin(db *gorm.DB, orderID uint, newStatus string) (*Order
 	for _, oi := range order.OrderItems {
 		items = append(items, OrderItemResponse{
 			ProductID: oi.ProductID,
+			VariantID: oi.VariantID,
+			SKU:       oi.SKU,
 			Name:      oi.Product.Name,
 			Quantity:  oi.Quantity,
 			Price:     oi.Price,
@@ -264,6 +316,8 @@ func GetOrderByID(db *gorm.DB, orderID uint, userID uint) (*OrderResponse, error
 	for _, oi := range order.OrderItems {
 		items = append(items, OrderItemResponse{
 			ProductID: oi.ProductID,
+			VariantID: oi.VariantID,
+			SKU:       oi.SKU,
 			Name:      oi.Product.Name,
 			Quantity:  oi.Quantity,
 			Price:     oi.Price,
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTPPurpose configures how OTPs for one purpose are generated and checked
+type OTPPurpose struct {
+	Length         int           // number of digits
+	TTL            time.Duration // how long a code stays valid
+	MaxAttempts    int           // wrong guesses before the code is invalidated
+	ResendCooldown time.Duration // minimum gap between two codes for the same user
+	Subject        string        // email subject
+	Public         bool          // can be resent and verified through /auth/resend-otp and /auth/verify-otp
+	Internal       bool          // only its own service flow may issue or check it, never GenerateOTP/ValidateOTP
+}
+
+// Internal purposes, each issued and checked by its own flow
+const (
+	deleteAccountPurpose = "delete_account"
+	oauthLoginPurpose    = "oauth_login"
+	oauthLinkPurpose     = "oauth_link"
+)
+
+var (
+	otpPurposesMu sync.RWMutex
+	otpPurposes   = map[string]OTPPurpose{
+		"signup": {
+			Length:         6,
+			TTL:            5 * time.Minute,
+			MaxAttempts:    5,
+			ResendCooldown: time.Minute,
+			Subject:        "Verify your email",
+			Public:         true,
+		},
+		"reset_password": {
+			Length:         6,
+			TTL:            5 * time.Minute,
+			MaxAttempts:    5,
+			ResendCooldown: time.Minute,
+			Subject:        "Reset your password",
+			Public:         true,
+		},
+		// Sent to the new address to prove the user owns it, and only
+		// accepted for that address
+		"change_email": {
+			Length:         6,
+			TTL:            10 * time.Minute,
+			MaxAttempts:    5,
+			ResendCooldown: time.Minute,
+			Subject:        "Confirm your new email address",
+		},
+		// Confirms a self-service account deletion; see SendAccountDeletionCode
+		deleteAccountPurpose: {
+			Length:         6,
+			TTL:            10 * time.Minute,
+			MaxAttempts:    3,
+			ResendCooldown: time.Minute,
+			Subject:        "Confirm your account deletion",
+			Internal:       true,
+		},
+		// Delivered inside a signed link, so the code is long and never typed.
+		// Not public: resending it would mail the raw code and void the link.
+		"magic_link": {
+			Length:         32,
+			TTL:            15 * time.Minute,
+			MaxAttempts:    3,
+			ResendCooldown: time.Minute,
+			Subject:        "Your sign-in link",
+		},
+		// Never emailed: the OAuth callback hands it to the frontend, which
+		// trades it once for a session; see IssueOAuthLoginCode
+		oauthLoginPurpose: {
+			Length:      32,
+			TTL:         2 * time.Minute,
+			MaxAttempts: 1,
+			Internal:    true,
+		},
+		// Never emailed: proves a signed-in session started linking a provider;
+		// see StartOAuthLink
+		oauthLinkPurpose: {
+			Length:      32,
+			TTL:         5 * time.Minute,
+			MaxAttempts: 1,
+			Internal:    true,
+		},
+	}
+)
+
+// RegisterOTPPurpose adds (or replaces) an allowed OTP purpose
+func RegisterOTPPurpose(name string, purpose OTPPurpose) {
+	otpPurposesMu.Lock()
+	otpPurposes[name] = purpose
+	otpPurposesMu.Unlock()
+}
+
+// IsOTPPurpose reports whether purpose is registered
+func IsOTPPurpose(purpose string) bool {
+	_, ok := lookupOTPPurpose(purpose)
+	return ok
+}
+
+// IsPublicOTPPurpose reports whether purpose can be handled by the public
+// resend and verify endpoints. Other purposes are issued and checked only by
+// their own flows.
+func IsPublicOTPPurpose(purpose string) bool {
+	cfg, ok := lookupOTPPurpose(purpose)
+	return ok && cfg.Public
+}
+
+// lookupOTPPurpose returns the purpose config with env overrides applied, e.g.
+// OTP_SIGNUP_LENGTH=8, OTP_SIGNUP_TTL=10m, OTP_SIGNUP_MAX_ATTEMPTS=3, OTP_SIGNUP_COOLDOWN=2m
+func lookupOTPPurpose(name string) (OTPPurpose, bool) {
+	otpPurposesMu.RLock()
+	purpose, ok := otpPurposes[name]
+	otpPurposesMu.RUnlock()
+	if !ok {
+		return OTPPurpose{}, false
+	}
+
+	prefix := "OTP_" + strings.ToUpper(name) + "_"
+	if v, err := strconv.Atoi(os.Getenv(prefix + "LENGTH")); err == nil && v > 0 {
+		purpose.Length = v
+	}
+	if v, err := time.ParseDuration(os.Getenv(prefix + "TTL")); err == nil && v > 0 {
+		purpose.TTL = v
+	}
+	if v, err := strconv.Atoi(os.Getenv(prefix + "MAX_ATTEMPTS")); err == nil && v > 0 {
+		purpose.MaxAttempts = v
+	}
+	if v, err := time.ParseDuration(os.Getenv(prefix + "COOLDOWN")); err == nil && v >= 0 {
+		purpose.ResendCooldown = v
+	}
+
+	return purpose, true
+}
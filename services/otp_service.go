@@ -2,50 +2,149 @@ package services
 
 import (
 	"crypto/rand"
+	"errors"
 	"fmt"
+	"math"
 	"math/big"
 	"time"
 
 	"github.com/mahi-qwe/ecommerce-backend/config"
 	"github.com/mahi-qwe/ecommerce-backend/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-// GenerateOTP creates, stores, and emails a 6-digit OTP
+// ErrUnknownOTPPurpose is returned for purposes that are not registered
+var ErrUnknownOTPPurpose = errors.New("unknown otp purpose")
+
+// OTPCooldownError is returned when a new OTP is requested too soon after the last one
+type OTPCooldownError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPCooldownError) Error() string {
+	return fmt.Sprintf("please wait %d seconds before requesting a new otp", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// GenerateOTP creates, stores, and emails an OTP for a registered purpose
 func GenerateOTP(userID uint, email, purpose string) (string, error) {
-	otp, err := generateRandomOTP(6)
+	if cfg, ok := lookupOTPPurpose(purpose); ok && cfg.Internal {
+		return "", ErrUnknownOTPPurpose
+	}
+	return sendOTP(userID, email, purpose)
+}
+
+// sendOTP issues an OTP and emails it to email
+func sendOTP(userID uint, email, purpose string) (string, error) {
+	otp, cfg, err := issueOTP(userID, purpose, email)
 	if err != nil {
 		return "", err
 	}
 
+	body := fmt.Sprintf("Your OTP for %s is: %s. It expires in %d minutes.", purpose, otp, int(cfg.TTL.Minutes()))
+
+	if err := SendEmail(email, cfg.Subject, body); err != nil {
+		return "", fmt.Errorf("failed to send OTP email: %w", err)
+	}
+
+	return otp, nil
+}
+
+// issueOTP creates and stores a new OTP without sending it, for callers that
+// deliver it themselves. sentTo records where it goes.
+func issueOTP(userID uint, purpose, sentTo string) (string, OTPPurpose, error) {
+	cfg, ok := lookupOTPPurpose(purpose)
+	if !ok {
+		return "", cfg, ErrUnknownOTPPurpose
+	}
+
+	// Enforce resend cooldown per user and purpose
+	var last models.OTP
+	if err := config.DB.Where("user_id = ? AND purpose = ?", userID, purpose).
+		Order("created_at DESC").
+		First(&last).Error; err == nil {
+		if wait := time.Until(last.CreatedAt.Add(cfg.ResendCooldown)); wait > 0 {
+			return "", cfg, &OTPCooldownError{RetryAfter: wait}
+		}
+	}
+
+	otp, err := generateRandomOTP(cfg.Length)
+	if err != nil {
+		return "", cfg, err
+	}
+
+	hashedOTP, err := bcrypt.GenerateFromPassword([]byte(otp), bcrypt.DefaultCost)
+	if err != nil {
+		return "", cfg, err
+	}
+
+	// Only the newest code for a purpose stays usable
+	if err := config.DB.Model(&models.OTP{}).
+		Where("user_id = ? AND purpose = ? AND is_used = ?", userID, purpose, false).
+		Update("is_used", true).Error; err != nil {
+		return "", cfg, err
+	}
+
 	otpEntry := models.OTP{
 		UserID:    userID,
-		OTPCode:   otp,
+		OTPCode:   string(hashedOTP),
 		Purpose:   purpose,
-		ExpiresAt: time.Now().Add(5 * time.Minute),
+		SentTo:    sentTo,
+		ExpiresAt: time.Now().Add(cfg.TTL),
 		CreatedAt: time.Now(),
 		IsUsed:    false,
 	}
 
 	if err := config.DB.Create(&otpEntry).Error; err != nil {
-		return "", err
+		return "", cfg, err
 	}
 
-	subject := "Your OTP Code"
-	body := fmt.Sprintf("Your OTP for %s is: %s. It expires in 5 minutes.", purpose, otp)
+	return otp, cfg, nil
+}
 
-	if err := SendEmail(email, subject, body); err != nil {
-		return "", fmt.Errorf("failed to send OTP email: %w", err)
+// ValidateOTP checks OTP validity and marks it used
+func ValidateOTP(userID uint, otp, purpose string) (bool, error) {
+	if cfg, ok := lookupOTPPurpose(purpose); ok && cfg.Internal {
+		return false, ErrUnknownOTPPurpose
 	}
+	return validateOTP(userID, otp, purpose, "")
+}
 
-	return otp, nil
+// ValidateOTPSentTo is ValidateOTP for a code that must have been mailed to
+// sentTo, so it proves the user reads that address
+func ValidateOTPSentTo(userID uint, otp, purpose, sentTo string) (bool, error) {
+	if cfg, ok := lookupOTPPurpose(purpose); ok && cfg.Internal {
+		return false, ErrUnknownOTPPurpose
+	}
+	return validateOTP(userID, otp, purpose, sentTo)
 }
 
-// ValidateOTP checks OTP validity and marks it used
-func ValidateOTP(userID uint, otp, purpose string) (bool, error) {
+// ValidateOTPBefore is ValidateOTP for a code that guards a change which can
+// still be rejected, e.g. a new password: once the code checks out, check runs,
+// and the code is only burned if check passes. check's error is returned as is.
+func ValidateOTPBefore(userID uint, otp, purpose string, check func() error) (bool, error) {
+	if cfg, ok := lookupOTPPurpose(purpose); ok && cfg.Internal {
+		return false, ErrUnknownOTPPurpose
+	}
+	return validateOTPWith(userID, otp, purpose, "", check)
+}
+
+func validateOTP(userID uint, otp, purpose, sentTo string) (bool, error) {
+	return validateOTPWith(userID, otp, purpose, sentTo, nil)
+}
+
+func validateOTPWith(userID uint, otp, purpose, sentTo string, check func() error) (bool, error) {
+	cfg, ok := lookupOTPPurpose(purpose)
+	if !ok {
+		return false, ErrUnknownOTPPurpose
+	}
+
 	var entry models.OTP
-	err := config.DB.Where("user_id = ? AND purpose = ? AND is_used = ?", userID, purpose, false).
-		Order("created_at DESC").
-		First(&entry).Error
+	query := config.DB.Where("user_id = ? AND purpose = ? AND is_used = ?", userID, purpose, false)
+	if sentTo != "" {
+		query = query.Where("LOWER(sent_to) = LOWER(?)", sentTo)
+	}
+	err := query.Order("created_at DESC").First(&entry).Error
 	if err != nil {
 		return false, fmt.Errorf("otp not found or already used")
 	}
@@ -54,13 +153,42 @@ func ValidateOTP(userID uint, otp, purpose string) (bool, error) {
 		return false, fmt.Errorf("otp expired")
 	}
 
-	if entry.OTPCode != otp {
-		return false, fmt.Errorf("invalid otp")
+	// Reserve an attempt before comparing so parallel guesses can't exceed the limit
+	result := config.DB.Model(&models.OTP{}).
+		Where("id = ? AND is_used = ? AND attempts < ?", entry.ID, false, cfg.MaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update otp attempts: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		invalidateOTP(entry.ID)
+		return false, fmt.Errorf("too many failed attempts, please request a new otp")
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(entry.OTPCode), []byte(otp)) != nil {
+		remaining := cfg.MaxAttempts - (entry.Attempts + 1)
+		if remaining <= 0 {
+			invalidateOTP(entry.ID)
+			return false, fmt.Errorf("too many failed attempts, please request a new otp")
+		}
+		return false, fmt.Errorf("invalid otp, %d attempt(s) left", remaining)
+	}
+
+	if check != nil {
+		if err := check(); err != nil {
+			return false, err
+		}
 	}
 
-	entry.IsUsed = true
-	if err := config.DB.Save(&entry).Error; err != nil {
-		return false, fmt.Errorf("failed to update otp status: %w", err)
+	// Single use: only one request can flip is_used
+	result = config.DB.Model(&models.OTP{}).
+		Where("id = ? AND is_used = ?", entry.ID, false).
+		Update("is_used", true)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update otp status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return false, fmt.Errorf("otp not found or already used")
 	}
 
 	// For signup OTPs, mark user as verified
@@ -75,6 +203,11 @@ func ValidateOTP(userID uint, otp, purpose string) (bool, error) {
 	return true, nil
 }
 
+// invalidateOTP burns a code that hit its attempt limit
+func invalidateOTP(id uint) {
+	config.DB.Model(&models.OTP{}).Where("id = ?", id).Update("is_used", true)
+}
+
 // generateRandomOTP returns a numeric OTP of given length
 func generateRandomOTP(length int) (string, error) {
 	const digits = "0123456789"
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// PasswordPolicy is read from the environment:
+//
+//	PASSWORD_MIN_LENGTH (8), PASSWORD_REQUIRE_UPPER, PASSWORD_REQUIRE_LOWER,
+//	PASSWORD_REQUIRE_DIGIT (all true), PASSWORD_REQUIRE_SYMBOL (false),
+//	PASSWORD_HISTORY (5 previous passwords), PASSWORD_BREACHED_FILE
+//
+// The breached file holds one SHA-1 hash per line, optionally followed by
+// ":count" as in the Have I Been Pwned downloads.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistorySize   int
+	BreachedFile  string
+}
+
+// PasswordPolicyError lists every rule a password broke
+type PasswordPolicyError struct {
+	Problems []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Problems, ", ")
+}
+
+var (
+	ErrPasswordReused       = errors.New("password was used recently, please choose a different one")
+	ErrCurrentPasswordWrong = errors.New("current password is incorrect")
+)
+
+var (
+	breachedOnce   sync.Once
+	breachedHashes map[string]struct{}
+)
+
+// CurrentPasswordPolicy returns the policy configured in the environment
+func CurrentPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:     envInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:  envBool("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:  envBool("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:  envBool("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol: envBool("PASSWORD_REQUIRE_SYMBOL", false),
+		HistorySize:   envInt("PASSWORD_HISTORY", 5),
+		BreachedFile:  os.Getenv("PASSWORD_BREACHED_FILE"),
+	}
+}
+
+// ValidatePasswordPolicy checks length, character classes and the breached list
+func ValidatePasswordPolicy(password string) error {
+	policy := CurrentPasswordPolicy()
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	var problems []string
+	if len([]rune(password)) < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", policy.MinLength))
+	}
+	if policy.RequireUpper && !hasUpper {
+		problems = append(problems, "an uppercase letter")
+	}
+	if policy.RequireLower && !hasLower {
+		problems = append(problems, "a lowercase letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		problems = append(problems, "a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		problems = append(problems, "a symbol")
+	}
+	if isBreachedPassword(policy.BreachedFile, password) {
+		problems = append(problems, "not appear in known data breaches")
+	}
+
+	if len(problems) > 0 {
+		return &PasswordPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// ChangePassword validates a new password against the policy and history, stores it,
+// and invalidates access tokens issued under the old one
+func ChangePassword(db *gorm.DB, user *models.User, newPassword string) error {
+	if err := ValidatePasswordPolicy(newPassword); err != nil {
+		return err
+	}
+
+	if err := CheckPasswordHistory(db, user, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"password_hash": hashedPassword,
+		"updated_at":    time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := RecordPasswordHistory(db, user.ID, newPassword); err != nil {
+		return err
+	}
+
+	return BumpTokenVersion(db, user.ID)
+}
+
+// RecordPasswordHistory remembers a password and drops entries beyond the history size
+func RecordPasswordHistory(db *gorm.DB, userID uint, password string) error {
+	policy := CurrentPasswordPolicy()
+	if policy.HistorySize <= 0 {
+		return nil
+	}
+
+	// History is only ever compared, so the default cost keeps N comparisons fast
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password history: %w", err)
+	}
+
+	if err := db.Create(&models.PasswordHistory{UserID: userID, PasswordHash: string(hash)}).Error; err != nil {
+		return fmt.Errorf("failed to save password history: %w", err)
+	}
+
+	var keep []uint
+	db.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at desc, id desc").
+		Limit(policy.HistorySize).
+		Pluck("id", &keep)
+
+	return db.Where("user_id = ? AND id NOT IN ?", userID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// CheckPasswordHistory rejects the current password and the last passwords kept by the policy
+func CheckPasswordHistory(db *gorm.DB, user *models.User, password string) error {
+	if utils.CheckPasswordHash(password, user.PasswordHash) {
+		return ErrPasswordReused
+	}
+
+	policy := CurrentPasswordPolicy()
+	if policy.HistorySize <= 0 {
+		return nil
+	}
+
+	var history []models.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).
+		Order("created_at desc, id desc").
+		Limit(policy.HistorySize).
+		Find(&history).Error; err != nil {
+		return err
+	}
+
+	for _, h := range history {
+		if bcrypt.CompareHashAndPassword([]byte(h.PasswordHash), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+func isBreachedPassword(file, password string) bool {
+	if file == "" {
+		return false
+	}
+
+	breachedOnce.Do(func() {
+		breachedHashes = loadBreachedHashes(file)
+	})
+
+	sum := sha1.Sum([]byte(password))
+	_, found := breachedHashes[strings.ToUpper(hex.EncodeToString(sum[:]))]
+	return found
+}
+
+func loadBreachedHashes(file string) map[string]struct{} {
+	hashes := map[string]struct{}{}
+
+	f, err := os.Open(file)
+	if err != nil {
+		log.Printf("⚠️ Could not open breached password file: %v", err)
+		return hashes
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if hash, _, _ := strings.Cut(line, ":"); len(hash) == 40 {
+			hashes[strings.ToUpper(hash)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("⚠️ Could not read breached password file: %v", err)
+	}
+
+	log.Printf("✅ Loaded %d breached password hashes", len(hashes))
+	return hashes
+}
+
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func envBool(key string, fallback bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
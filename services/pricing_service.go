@@ -0,0 +1,410 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSaleNotFound  = errors.New("sale not found")
+	ErrSaleNotActive = errors.New("sale has already ended or been cancelled")
+	ErrInvalidSale   = errors.New("give either a sale_price above zero or a percent_off between 0 and 100")
+	ErrSaleWindow    = errors.New("ends_at must be in the future and after starts_at")
+	ErrNoPriceRecord = errors.New("no price was recorded for this variant at that time")
+)
+
+// minSalePrice is the floor for percent-off sale prices; the SQL in
+// RefreshProductSummary applies the same one
+const minSalePrice = 0.01
+
+// Price history sources
+const (
+	PriceSourceAdmin   = "admin"
+	PriceSourceImport  = "import"
+	PriceSourceInitial = "initial" // history started for variants that predate it
+)
+
+// PriceAuthor says who changed a price and how, for the price history
+type PriceAuthor struct {
+	UserID *uint
+	Source string // defaults to admin
+}
+
+// SaleInput describes a sale. Exactly one of SalePrice and PercentOff is set.
+type SaleInput struct {
+	VariantID  *uint // nil puts every variant of the product on sale
+	SalePrice  *float64
+	PercentOff *float64
+	StartsAt   *time.Time // nil starts now
+	EndsAt     *time.Time // nil runs until cancelled
+	Note       string
+	CreatedBy  *uint
+}
+
+// VariantPrice is what a variant cost at a point in time
+type VariantPrice struct {
+	VariantID      uint       `json:"variant_id"`
+	SKU            string     `json:"sku"`
+	At             time.Time  `json:"at"`
+	Price          float64    `json:"price"` // regular price
+	CompareAtPrice *float64   `json:"compare_at_price"`
+	SalePrice      *float64   `json:"sale_price"`
+	SaleID         *uint      `json:"sale_id"`
+	EffectivePrice float64    `json:"effective_price"` // what a customer paid
+	SaleEndsAt     *time.Time `json:"sale_ends_at,omitempty"`
+}
+
+// ApplyPricing fills in the sale and effective prices of variants as of at
+func ApplyPricing(db *gorm.DB, variants []models.ProductVariant, at time.Time) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	seen := map[uint]bool{}
+	var productIDs []uint
+	for _, v := range variants {
+		if !seen[v.ProductID] {
+			seen[v.ProductID] = true
+			productIDs = append(productIDs, v.ProductID)
+		}
+	}
+
+	sales, err := salesActiveAt(db, productIDs, at)
+	if err != nil {
+		return err
+	}
+	for i := range variants {
+		applySale(&variants[i], sales)
+	}
+	return nil
+}
+
+// PriceCartItems fills in the sale and effective prices of the cart items'
+// variants as of at
+func PriceCartItems(db *gorm.DB, items []models.CartItem, at time.Time) error {
+	variants := make([]models.ProductVariant, len(items))
+	for i := range items {
+		variants[i] = items[i].Variant
+	}
+	if err := ApplyPricing(db, variants, at); err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].Variant = variants[i]
+	}
+	return nil
+}
+
+// pricedVariant loads a variant with its price as of now
+func pricedVariant(db *gorm.DB, productID, variantID uint) (models.ProductVariant, error) {
+	variant, err := GetVariant(db, productID, variantID)
+	if err != nil {
+		return variant, err
+	}
+
+	sales, err := salesActiveAt(db, []uint{productID}, time.Now())
+	if err != nil {
+		return variant, err
+	}
+	applySale(&variant, sales)
+	return variant, nil
+}
+
+// CompareAtFor is the "was" price to show next to a priced variant: its
+// regular price while on sale, otherwise its manual compare-at price, and
+// nothing when that isn't above what the customer pays
+func CompareAtFor(v models.ProductVariant) *float64 {
+	var was *float64
+	if v.SalePrice != nil {
+		regular := v.Price
+		if v.CompareAtPrice != nil && *v.CompareAtPrice > regular {
+			regular = *v.CompareAtPrice
+		}
+		was = &regular
+	} else {
+		was = v.CompareAtPrice
+	}
+	if was == nil || *was <= v.EffectivePrice {
+		return nil
+	}
+	return was
+}
+
+// CreateSale schedules a sale on a product or one of its variants. Prices
+// switch to it when it starts and back when it ends, with nothing else to do.
+func CreateSale(db *gorm.DB, productID uint, input SaleInput) (models.PriceSchedule, error) {
+	if err := productExists(db, productID); err != nil {
+		return models.PriceSchedule{}, err
+	}
+	if input.VariantID != nil {
+		if _, err := GetVariant(db, productID, *input.VariantID); err != nil {
+			return models.PriceSchedule{}, err
+		}
+	}
+
+	if (input.SalePrice == nil) == (input.PercentOff == nil) {
+		return models.PriceSchedule{}, ErrInvalidSale
+	}
+	if input.SalePrice != nil && *input.SalePrice <= 0 {
+		return models.PriceSchedule{}, ErrInvalidSale
+	}
+	if input.PercentOff != nil && (*input.PercentOff <= 0 || *input.PercentOff >= 100) {
+		return models.PriceSchedule{}, ErrInvalidSale
+	}
+
+	now := time.Now()
+	startsAt := now
+	if input.StartsAt != nil {
+		startsAt = *input.StartsAt
+	}
+	if input.EndsAt != nil && (!input.EndsAt.After(startsAt) || !input.EndsAt.After(now)) {
+		return models.PriceSchedule{}, ErrSaleWindow
+	}
+
+	sale := models.PriceSchedule{
+		ProductID:  productID,
+		VariantID:  input.VariantID,
+		SalePrice:  input.SalePrice,
+		PercentOff: input.PercentOff,
+		StartsAt:   startsAt,
+		EndsAt:     input.EndsAt,
+		Note:       input.Note,
+		CreatedBy:  input.CreatedBy,
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sale).Error; err != nil {
+			return err
+		}
+		return RefreshProductSummary(tx, productID)
+	})
+	return sale, err
+}
+
+// ProductSales lists a product's sales, newest first. activeOnly keeps those
+// running now or still to come.
+func ProductSales(db *gorm.DB, productID uint, activeOnly bool) ([]models.PriceSchedule, error) {
+	if err := productExists(db, productID); err != nil {
+		return nil, err
+	}
+
+	query := db.Where("product_id = ?", productID)
+	if activeOnly {
+		query = query.Where("cancelled_at IS NULL AND (ends_at IS NULL OR ends_at > ?)", time.Now())
+	}
+
+	var sales []models.PriceSchedule
+	err := query.Order("starts_at DESC, id DESC").Find(&sales).Error
+	return sales, err
+}
+
+// CancelSale ends a running or upcoming sale now. The record stays so past
+// prices can still be worked out.
+func CancelSale(db *gorm.DB, productID, saleID uint, cancelledBy *uint) (models.PriceSchedule, error) {
+	var sale models.PriceSchedule
+	if err := db.Where("id = ? AND product_id = ?", saleID, productID).First(&sale).Error; err != nil {
+		return sale, ErrSaleNotFound
+	}
+
+	now := time.Now()
+	if sale.CancelledAt != nil || (sale.EndsAt != nil && !sale.EndsAt.After(now)) {
+		return sale, ErrSaleNotActive
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&sale).Updates(map[string]interface{}{"cancelled_at": now, "cancelled_by": cancelledBy}).Error; err != nil {
+			return err
+		}
+		return RefreshProductSummary(tx, productID)
+	})
+	if err != nil {
+		return sale, err
+	}
+
+	sale.CancelledAt = &now
+	sale.CancelledBy = cancelledBy
+	return sale, nil
+}
+
+// PriceAt works out what a variant cost at a past (or future) moment from its
+// price history and the sales that were scheduled at the time
+func PriceAt(db *gorm.DB, productID, variantID uint, at time.Time) (VariantPrice, error) {
+	// Retired variants still have a past
+	var variant models.ProductVariant
+	if err := db.Unscoped().Where("id = ? AND product_id = ?", variantID, productID).First(&variant).Error; err != nil {
+		return VariantPrice{}, ErrVariantNotFound
+	}
+
+	var price models.PriceHistory
+	err := db.Where("variant_id = ? AND field = ? AND created_at <= ?", variantID, "price", at).
+		Order("created_at DESC, id DESC").First(&price).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && price.NewValue == nil) {
+		return VariantPrice{}, ErrNoPriceRecord
+	}
+	if err != nil {
+		return VariantPrice{}, err
+	}
+	variant.Price = *price.NewValue
+
+	var compareAt models.PriceHistory
+	err = db.Where("variant_id = ? AND field = ? AND created_at <= ?", variantID, "compare_at_price", at).
+		Order("created_at DESC, id DESC").First(&compareAt).Error
+	switch {
+	case err == nil:
+		variant.CompareAtPrice = compareAt.NewValue
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		variant.CompareAtPrice = nil
+	default:
+		return VariantPrice{}, err
+	}
+
+	sales, err := salesActiveAt(db, []uint{productID}, at)
+	if err != nil {
+		return VariantPrice{}, err
+	}
+	sale := applySale(&variant, sales)
+
+	result := VariantPrice{
+		VariantID:      variant.ID,
+		SKU:            variant.SKU,
+		At:             at,
+		Price:          variant.Price,
+		CompareAtPrice: CompareAtFor(variant),
+		SalePrice:      variant.SalePrice,
+		EffectivePrice: variant.EffectivePrice,
+		SaleEndsAt:     variant.SaleEndsAt,
+	}
+	if sale != nil {
+		result.SaleID = &sale.ID
+	}
+	return result, nil
+}
+
+// StartPriceScheduler refreshes the price summary of products whose sales
+// start or end, every PRICE_SCHEDULE_INTERVAL (default one minute). Orders and
+// product pages work the sale price out themselves; this keeps listing, sorting
+// and price filters in step.
+func StartPriceScheduler(db *gorm.DB) {
+	interval := envDuration("PRICE_SCHEDULE_INTERVAL", time.Minute)
+
+	go func() {
+		// The first pass catches up on whatever changed while the server was down
+		var since time.Time
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			// A failed pass is retried from the same point on the next tick
+			now := time.Now()
+			if err := applyDueSales(db, since, now); err != nil {
+				log.Printf("⚠️ Could not apply scheduled prices: %v", err)
+			} else {
+				since = now
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+func applyDueSales(db *gorm.DB, since, now time.Time) error {
+	var productIDs []uint
+	if err := db.Model(&models.PriceSchedule{}).
+		Where("(starts_at > ? AND starts_at <= ?) OR (ends_at > ? AND ends_at <= ?)", since, now, since, now).
+		Distinct().Pluck("product_id", &productIDs).Error; err != nil {
+		return err
+	}
+
+	// Keep going past a failure; refreshing a product twice is harmless
+	var firstErr error
+	for _, id := range productIDs {
+		if err := RefreshProductSummary(db, id); err != nil {
+			log.Printf("⚠️ Could not apply scheduled price to product %d: %v", id, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+// salesActiveAt loads the sales of the products that were in force at the
+// given moment, as scheduled at that moment
+func salesActiveAt(db *gorm.DB, productIDs []uint, at time.Time) ([]models.PriceSchedule, error) {
+	var sales []models.PriceSchedule
+	err := db.Where("product_id IN ?", productIDs).
+		Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", at, at).
+		Where("created_at <= ? AND (cancelled_at IS NULL OR cancelled_at > ?)", at, at).
+		Find(&sales).Error
+	return sales, err
+}
+
+// applySale sets the variant's effective price to the lowest of its regular
+// price and the sales that cover it, and returns the sale used, if any
+func applySale(v *models.ProductVariant, sales []models.PriceSchedule) *models.PriceSchedule {
+	v.EffectivePrice = v.Price
+	v.SalePrice = nil
+	v.SaleEndsAt = nil
+
+	var best *models.PriceSchedule
+	for i := range sales {
+		s := &sales[i]
+		if s.ProductID != v.ProductID || (s.VariantID != nil && *s.VariantID != v.ID) {
+			continue
+		}
+
+		price := salePrice(*s, v.Price)
+		if price < v.EffectivePrice {
+			v.EffectivePrice = price
+			best = s
+		}
+	}
+
+	if best != nil {
+		price := v.EffectivePrice
+		v.SalePrice = &price
+		v.SaleEndsAt = best.EndsAt
+	}
+	return best
+}
+
+func salePrice(s models.PriceSchedule, regular float64) float64 {
+	if s.SalePrice != nil {
+		return *s.SalePrice
+	}
+	// A steep discount on a cheap item must not round down to free
+	return max(math.Round(regular*(100-*s.PercentOff))/100, minSalePrice)
+}
+
+// recordPriceChange adds a price history entry when a value actually changes
+func recordPriceChange(tx *gorm.DB, variant models.ProductVariant, field string, oldValue, newValue *float64, by PriceAuthor) error {
+	if samePrice(oldValue, newValue) {
+		return nil
+	}
+
+	source := by.Source
+	if source == "" {
+		source = PriceSourceAdmin
+	}
+
+	return tx.Create(&models.PriceHistory{
+		ProductID: variant.ProductID,
+		VariantID: variant.ID,
+		Field:     field,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+		ChangedBy: by.UserID,
+		Source:    source,
+	}).Error
+}
+
+func samePrice(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,695 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrImportEmpty       = errors.New("the file has no product rows")
+	ErrImportColumns     = errors.New("the file's header row is not valid")
+	ErrImportTooManyRows = errors.New("the file has too many rows")
+	ErrImportJobNotFound = errors.New("import job not found")
+)
+
+// ProductSheetColumns are the columns of the import and export files. Each
+// row is one variant, matched on sku: existing SKUs are updated, new ones are
+// added to product_id, or to a new product when product_id is empty. Blank
+// cells leave the current value alone. Options look like "size=M; color=Red".
+// Categories are exported by slug; imports also accept a category name.
+var ProductSheetColumns = []string{
+	"product_id", "sku", "name", "description", "category",
+	"price", "stock_quantity", "image_url", "barcode", "options",
+}
+
+// Columns exported as numbers in XLSX
+var productSheetNumeric = map[int]bool{0: true, 5: true, 6: true}
+
+const (
+	importBatchSize    = 200 // rows committed together by a real import
+	maxImportRowErrors = 1000
+)
+
+// errDryRun rolls back a dry run once every row has been tried
+var errDryRun = errors.New("dry run")
+
+// importSlots lets one background import run at a time; others wait their turn
+var importSlots = make(chan struct{}, 1)
+
+// MaxImportBytes is the largest import file accepted (IMPORT_MAX_BYTES, default 10 MB)
+func MaxImportBytes() int64 {
+	return int64(envInt("IMPORT_MAX_BYTES", 10<<20))
+}
+
+// ImportOptions controls how an uploaded file is imported
+type ImportOptions struct {
+	Filename         string
+	DryRun           bool // validate every row and report errors, writing nothing
+	Background       bool // always queue, however small the file
+	UserID           *uint
+	ServiceAccountID *uint
+}
+
+type importRow struct {
+	line   int
+	values map[string]string
+}
+
+func (r importRow) get(column string) string {
+	return strings.TrimSpace(r.values[column])
+}
+
+// StartProductImport checks the file and creates its job. Files of up to
+// IMPORT_SYNC_ROWS rows (default 200) are imported before returning; larger
+// ones are queued and the job is returned while still pending.
+func StartProductImport(db *gorm.DB, data []byte, opts ImportOptions) (models.ProductImportJob, error) {
+	format := DetectSpreadsheetFormat(data)
+	rows, err := parseProductSheet(data, format)
+	if err != nil {
+		return models.ProductImportJob{}, err
+	}
+
+	job := models.ProductImportJob{
+		UserID:           opts.UserID,
+		ServiceAccountID: opts.ServiceAccountID,
+		Filename:         opts.Filename,
+		Format:           format,
+		DryRun:           opts.DryRun,
+		Status:           "pending",
+		TotalRows:        len(rows),
+		Errors:           []models.ImportRowError{},
+	}
+	if err := db.Create(&job).Error; err != nil {
+		return job, err
+	}
+
+	if !opts.Background && len(rows) <= envInt("IMPORT_SYNC_ROWS", 200) {
+		runProductImport(db, &job, rows)
+		return job, nil
+	}
+
+	go func(job models.ProductImportJob) {
+		importSlots <- struct{}{}
+		defer func() { <-importSlots }()
+		runProductImport(db, &job, rows)
+	}(job)
+
+	return job, nil
+}
+
+// GetImportJob loads an import job for polling
+func GetImportJob(db *gorm.DB, id uint) (models.ProductImportJob, error) {
+	var job models.ProductImportJob
+	if err := db.First(&job, id).Error; err != nil {
+		return job, ErrImportJobNotFound
+	}
+	return job, nil
+}
+
+// FailInterruptedImports marks imports that were queued or running when the
+// server stopped as failed, since their rows were only held in memory
+func FailInterruptedImports(db *gorm.DB) {
+	now := time.Now()
+	result := db.Model(&models.ProductImportJob{}).
+		Where("status IN ?", []string{"pending", "running"}).
+		Updates(map[string]interface{}{
+			"status":      "failed",
+			"error":       "interrupted by a server restart; upload the file again",
+			"finished_at": now,
+		})
+	if result.Error != nil {
+		log.Printf("⚠️ Could not clean up interrupted imports: %v", result.Error)
+	} else if result.RowsAffected > 0 {
+		log.Printf("⚠️ Marked %d interrupted product imports as failed", result.RowsAffected)
+	}
+}
+
+// parseProductSheet reads the file and maps each row to its header columns
+func parseProductSheet(data []byte, format string) ([]importRow, error) {
+	// One extra for the header row
+	maxRows := envInt("IMPORT_MAX_ROWS", 50000)
+	records, err := readSpreadsheet(data, format, maxRows+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrImportEmpty
+	}
+
+	known := make(map[string]bool, len(ProductSheetColumns))
+	for _, c := range ProductSheetColumns {
+		known[c] = true
+	}
+
+	header := make([]string, len(records[0]))
+	seen := map[string]bool{}
+	for i, h := range records[0] {
+		name := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(h), " ", "_"))
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, fmt.Errorf("%w: unknown column %q (expected %s)", ErrImportColumns, h, strings.Join(ProductSheetColumns, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrImportColumns, name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+	if !seen["sku"] {
+		return nil, fmt.Errorf("%w: a sku column is required", ErrImportColumns)
+	}
+
+	rows := make([]importRow, 0, len(records)-1)
+	for i, record := range records[1:] {
+		row := importRow{line: i + 2, values: map[string]string{}}
+		blank := true
+		for j, value := range record {
+			if j < len(header) && header[j] != "" {
+				row.values[header[j]] = value
+				blank = blank && strings.TrimSpace(value) == ""
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrImportEmpty
+	}
+	if len(rows) > maxRows {
+		return nil, ErrImportTooManyRows
+	}
+	return rows, nil
+}
+
+// runProductImport applies every row, each on its own so one bad row doesn't
+// sink the rest. A dry run does all the work in a transaction that is then
+// rolled back, so it reports exactly what a real run would.
+func runProductImport(db *gorm.DB, job *models.ProductImportJob, rows []importRow) {
+	defer func() {
+		if r := recover(); r != nil {
+			finishImport(db, job, fmt.Errorf("panic: %v", r))
+		}
+	}()
+
+	now := time.Now()
+	job.Status = "running"
+	job.StartedAt = &now
+	db.Model(job).Updates(map[string]interface{}{"status": job.Status, "started_at": now})
+
+	imp := &productImporter{
+		newProducts: map[string]uint{},
+		seenSKUs:    map[string]bool{},
+		by:          PriceAuthor{UserID: job.UserID, Source: PriceSourceImport},
+	}
+
+	var err error
+	if job.DryRun {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i, row := range rows {
+				imp.apply(tx, job, row)
+				if (i+1)%importBatchSize == 0 {
+					saveImportProgress(db, job)
+				}
+			}
+			return errDryRun
+		})
+		if errors.Is(err, errDryRun) {
+			err = nil
+		}
+	} else {
+		for start := 0; start < len(rows) && err == nil; start += importBatchSize {
+			batch := rows[start:min(start+importBatchSize, len(rows))]
+			err = db.Transaction(func(tx *gorm.DB) error {
+				for _, row := range batch {
+					imp.apply(tx, job, row)
+				}
+				return nil
+			})
+			if err == nil {
+				saveImportProgress(db, job)
+			}
+		}
+	}
+
+	finishImport(db, job, err)
+}
+
+func saveImportProgress(db *gorm.DB, job *models.ProductImportJob) {
+	db.Model(job).Select("processed_rows", "created_count", "updated_count", "failed_count", "errors").Updates(job)
+}
+
+func finishImport(db *gorm.DB, job *models.ProductImportJob, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = "completed"
+	if err != nil {
+		job.Status = "failed"
+		job.Error = err.Error()
+		log.Printf("❌ Product import %d failed: %v", job.ID, err)
+	}
+	db.Model(job).Select("status", "error", "finished_at", "processed_rows", "created_count", "updated_count", "failed_count", "errors").Updates(job)
+}
+
+// productImporter remembers what earlier rows of the same file did
+type productImporter struct {
+	newProducts map[string]uint // products created by this file, by lower-cased name
+	seenSKUs    map[string]bool
+	by          PriceAuthor // credited in the price history
+}
+
+// apply imports one row in a savepoint and records its outcome on the job
+func (imp *productImporter) apply(tx *gorm.DB, job *models.ProductImportJob, row importRow) {
+	job.ProcessedRows++
+
+	var created bool
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, err = imp.importRow(tx, row)
+		return err
+	})
+
+	switch {
+	case err != nil:
+		job.FailedCount++
+		if len(job.Errors) < maxImportRowErrors {
+			job.Errors = append(job.Errors, models.ImportRowError{Row: row.line, SKU: row.get("sku"), Message: err.Error()})
+		}
+	case created:
+		job.CreatedCount++
+	default:
+		job.UpdatedCount++
+	}
+}
+
+// importRow upserts the variant a row describes and reports whether it was new
+func (imp *productImporter) importRow(tx *gorm.DB, row importRow) (bool, error) {
+	sku := row.get("sku")
+	if sku == "" {
+		return false, ErrSKURequired
+	}
+	if imp.seenSKUs[sku] {
+		return false, errors.New("sku appears more than once in the file")
+	}
+	imp.seenSKUs[sku] = true
+
+	fields, err := parseImportFields(tx, row)
+	if err != nil {
+		return false, err
+	}
+
+	var variant models.ProductVariant
+	err = tx.Preload(models.VariantOptionsPreload).Where("sku = ?", sku).First(&variant).Error
+	if err == nil {
+		return false, imp.updateVariant(tx, variant, fields)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+
+	// A retired variant still owns its SKU
+	if err := skuAvailable(tx, sku, 0); err != nil {
+		return false, err
+	}
+	if fields.price == nil {
+		return false, errors.New("price is required for a new sku")
+	}
+
+	productID := fields.productID
+	if productID == 0 {
+		productID = imp.newProducts[strings.ToLower(fields.name)]
+	}
+	if productID == 0 {
+		return true, imp.createProduct(tx, sku, fields)
+	}
+	return true, imp.addVariant(tx, productID, sku, fields)
+}
+
+// importFields are a row's parsed cells; nil and empty mean "leave alone"
+type importFields struct {
+	productID   uint
+	name        string
+	description *string
+	category    *models.Category
+	price       *float64
+	stock       *int
+	imageURL    *string
+	barcode     *string
+	options     map[string]string
+}
+
+func parseImportFields(db *gorm.DB, row importRow) (importFields, error) {
+	f := importFields{name: row.get("name")}
+
+	if v := row.get("product_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || id == 0 {
+			return f, errors.New("product_id must be a positive whole number")
+		}
+		f.productID = uint(id)
+	}
+	if v := row.get("price"); v != "" {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil || price <= 0 {
+			return f, errors.New("price must be a number above zero")
+		}
+		f.price = &price
+	}
+	if v := row.get("stock_quantity"); v != "" {
+		// Spreadsheets sometimes save whole numbers as "12.0"
+		stock, err := strconv.ParseFloat(v, 64)
+		if err != nil || stock < 0 || stock != float64(int(stock)) {
+			return f, errors.New("stock_quantity must be a whole number of at least zero")
+		}
+		n := int(stock)
+		f.stock = &n
+	}
+	if v := row.get("category"); v != "" {
+		// Slugs are unique where names are not
+		category, err := FindCategoryBySlug(db, v)
+		if err != nil {
+			if category, err = FindCategoryByName(db, v); err != nil {
+				return f, fmt.Errorf("category %q not found", v)
+			}
+		}
+		f.category = &category
+	}
+	if v, ok := row.values["description"]; ok && strings.TrimSpace(v) != "" {
+		f.description = &v
+	}
+	if v := row.get("image_url"); v != "" {
+		f.imageURL = &v
+	}
+	if v := row.get("barcode"); v != "" {
+		f.barcode = &v
+	}
+	if v := row.get("options"); v != "" {
+		options, err := parseOptionsCell(v)
+		if err != nil {
+			return f, err
+		}
+		f.options = options
+	}
+	return f, nil
+}
+
+// parseOptionsCell reads "size=M; color=Red"
+func parseOptionsCell(cell string) (map[string]string, error) {
+	options := map[string]string{}
+	for _, part := range strings.Split(cell, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("options must look like \"size=M; color=Red\", got %q", cell)
+		}
+		if _, dup := options[name]; dup {
+			return nil, fmt.Errorf("option %q is given twice", name)
+		}
+		options[name] = value
+	}
+	return options, nil
+}
+
+func formatOptionsCell(variant models.ProductVariant) string {
+	values := append([]models.OptionValue(nil), variant.OptionValues...)
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].OptionType == nil || values[j].OptionType == nil {
+			return values[i].ID < values[j].ID
+		}
+		return values[i].OptionType.Position < values[j].OptionType.Position
+	})
+
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v.OptionType != nil {
+			parts = append(parts, v.OptionType.Name+"="+v.Value)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (imp *productImporter) updateVariant(tx *gorm.DB, variant models.ProductVariant, f importFields) error {
+	if f.productID != 0 && f.productID != variant.ProductID {
+		return fmt.Errorf("sku belongs to product %d", variant.ProductID)
+	}
+	if f.options != nil && !sameOptions(variant.Options(), f.options) {
+		return errors.New("options of an existing sku can't be changed; retire it and add a new sku")
+	}
+
+	if err := updateImportedProduct(tx, variant.ProductID, f); err != nil {
+		return err
+	}
+	_, err := UpdateVariant(tx, variant.ProductID, variant.ID, VariantUpdate{
+		Price:         f.price,
+		StockQuantity: f.stock,
+		ImageURL:      f.imageURL,
+		Barcode:       f.barcode,
+		By:            imp.by,
+	})
+	return err
+}
+
+// createProduct makes a new product whose default variant is the row's SKU.
+// Later rows with the same name become further variants of it.
+func (imp *productImporter) createProduct(tx *gorm.DB, sku string, f importFields) error {
+	if f.name == "" {
+		return errors.New("name is required for a new product")
+	}
+
+	product := models.Product{Name: f.name, Price: *f.price}
+	if f.description != nil {
+		product.Description = *f.description
+	}
+	if f.stock != nil {
+		product.StockQuantity = *f.stock
+	}
+	if f.category != nil {
+		product.CategoryID = &f.category.ID
+	}
+	if f.imageURL != nil {
+		product.ImageURL = *f.imageURL
+	}
+	if err := CreateProduct(tx, &product, imp.by); err != nil {
+		return err
+	}
+
+	variant := product.Variants[0]
+	updates := map[string]interface{}{"sku": sku}
+	if f.imageURL != nil {
+		updates["image_url"] = *f.imageURL
+	}
+	if f.barcode != nil {
+		updates["barcode"] = strings.TrimSpace(*f.barcode)
+	}
+	if err := tx.Model(&variant).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	// The first row's options define the product's options
+	names := make([]string, 0, len(f.options))
+	for name := range f.options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		optionType, err := CreateOptionType(tx, product.ID, name, []string{f.options[name]})
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&variant).Association("OptionValues").Append(&optionType.Values[0]); err != nil {
+			return err
+		}
+	}
+
+	imp.newProducts[strings.ToLower(f.name)] = product.ID
+	return nil
+}
+
+// addVariant adds the row's SKU to an existing product, adding any option
+// values the product doesn't have yet
+func (imp *productImporter) addVariant(tx *gorm.DB, productID uint, sku string, f importFields) error {
+	var product models.Product
+	if err := tx.Preload("OptionTypes.Values").First(&product, productID).Error; err != nil {
+		return ErrProductNotFound
+	}
+
+	for name, value := range f.options {
+		var optionType *models.OptionType
+		for i := range product.OptionTypes {
+			if product.OptionTypes[i].Name == name {
+				optionType = &product.OptionTypes[i]
+			}
+		}
+		if optionType == nil {
+			return fmt.Errorf("product %d has no %q option", productID, name)
+		}
+
+		exists := false
+		for _, v := range optionType.Values {
+			exists = exists || strings.EqualFold(v.Value, value)
+		}
+		if !exists {
+			if err := tx.Create(&models.OptionValue{OptionTypeID: optionType.ID, Value: value, Position: len(optionType.Values)}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := updateImportedProduct(tx, productID, f); err != nil {
+		return err
+	}
+
+	input := VariantInput{SKU: sku, Price: *f.price, Options: f.options, By: imp.by}
+	if f.stock != nil {
+		input.StockQuantity = *f.stock
+	}
+	if f.imageURL != nil {
+		input.ImageURL = *f.imageURL
+	}
+	if f.barcode != nil {
+		input.Barcode = *f.barcode
+	}
+	_, err := CreateVariant(tx, productID, input)
+	return err
+}
+
+// updateImportedProduct copies a row's product-level cells onto the product
+func updateImportedProduct(tx *gorm.DB, productID uint, f importFields) error {
+	updates := map[string]interface{}{}
+	if f.name != "" {
+		updates["name"] = f.name
+	}
+	if f.description != nil {
+		updates["description"] = *f.description
+	}
+	if f.category != nil {
+		updates["category_id"] = f.category.ID
+		updates["category"] = f.category.Name
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(&models.Product{}).Where("id = ?", productID).Updates(updates).Error
+}
+
+func sameOptions(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if !strings.EqualFold(b[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportProducts streams every live variant as a row of ProductSheetColumns,
+// in the format the import reads back
+func ExportProducts(ctx context.Context, db *gorm.DB, w io.Writer, format string) error {
+	out, err := NewRowWriter(w, format, productSheetNumeric)
+	if err != nil {
+		return err
+	}
+	if err := out.Write(ProductSheetColumns); err != nil {
+		return err
+	}
+
+	// Walk the catalog in pages keyed on (product_id, id) so memory stays flat
+	var lastProduct, lastVariant uint
+	for {
+		var variants []models.ProductVariant
+		if err := db.WithContext(ctx).
+			Preload("Product").
+			Preload(models.VariantOptionsPreload).
+			Joins("JOIN products ON products.id = product_variants.product_id AND products.deleted_at IS NULL").
+			Where("(product_variants.product_id, product_variants.id) > (?, ?)", lastProduct, lastVariant).
+			Order("product_variants.product_id, product_variants.id").
+			Limit(500).
+			Find(&variants).Error; err != nil {
+			return err
+		}
+		if len(variants) == 0 {
+			break
+		}
+
+		slugs, err := categorySlugs(db.WithContext(ctx), variants)
+		if err != nil {
+			return err
+		}
+		for _, v := range variants {
+			if err := out.Write(productSheetRow(v, slugs)); err != nil {
+				return err
+			}
+		}
+		last := variants[len(variants)-1]
+		lastProduct, lastVariant = last.ProductID, last.ID
+	}
+
+	return out.Close()
+}
+
+// categorySlugs maps the category IDs of the variants' products to their slugs
+func categorySlugs(db *gorm.DB, variants []models.ProductVariant) (map[uint]string, error) {
+	var ids []uint
+	for _, v := range variants {
+		if v.Product != nil && v.Product.CategoryID != nil {
+			ids = append(ids, *v.Product.CategoryID)
+		}
+	}
+
+	slugs := make(map[uint]string)
+	if len(ids) == 0 {
+		return slugs, nil
+	}
+
+	var categories []models.Category
+	if err := db.Select("id", "slug").Where("id IN ?", ids).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		slugs[category.ID] = category.Slug
+	}
+	return slugs, nil
+}
+
+// productSheetRow writes a variant as ProductSheetColumns. The category is its
+// slug, falling back to the stored name when the category is gone.
+func productSheetRow(v models.ProductVariant, slugs map[uint]string) []string {
+	var name, description, category string
+	if v.Product != nil {
+		name, description, category = v.Product.Name, v.Product.Description, v.Product.Category
+		if v.Product.CategoryID != nil && slugs[*v.Product.CategoryID] != "" {
+			category = slugs[*v.Product.CategoryID]
+		}
+	}
+	return []string{
+		strconv.FormatUint(uint64(v.ProductID), 10),
+		v.SKU,
+		name,
+		description,
+		category,
+		strconv.FormatFloat(v.Price, 'f', 2, 64),
+		strconv.Itoa(v.StockQuantity),
+		v.ImageURL,
+		v.Barcode,
+		formatOptionsCell(v),
+	}
+}
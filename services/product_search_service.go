@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// ErrEmptySearchQuery is returned when the query has no searchable words
+var ErrEmptySearchQuery = errors.New("search query must contain letters or digits")
+
+// How close a misspelt query must be to a product name (pg_trgm word similarity, 0..1)
+const typoSimilarityThreshold = 0.35
+
+// Only the first few words of a query are used
+const maxSearchTerms = 8
+
+var searchTermPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// ProductSearchParams narrows and pages a product search
+type ProductSearchParams struct {
+	Query       string
+	CategoryIDs []uint // a category and its subcategories, see CategoryFilter
+	Limit       int
+	Offset      int
+}
+
+// ProductSearchResult is a product with its relevance and highlighted matches.
+// Highlights wrap matched words in <mark></mark>.
+type ProductSearchResult struct {
+	models.Product
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+var (
+	trigramOnce      sync.Once
+	trigramAvailable bool
+)
+
+// SearchProducts runs a ranked full-text search over name, category and
+// description. Every word matches as a prefix ("shi" finds "shirt"), and when
+// pg_trgm is installed, names that are close to the query match too ("tshrt").
+func SearchProducts(db *gorm.DB, params ProductSearchParams) ([]ProductSearchResult, int64, error) {
+	tsQuery := prefixTSQuery(params.Query)
+	if tsQuery == "" {
+		return nil, 0, ErrEmptySearchQuery
+	}
+
+	args := map[string]interface{}{
+		"tsquery":    tsQuery,
+		"q":          strings.TrimSpace(params.Query),
+		"categories": params.CategoryIDs,
+		"limit":      params.Limit,
+		"offset":     params.Offset,
+	}
+
+	match := "p.search_vector @@ q.query"
+	rank := "ts_rank_cd(p.search_vector, q.query, 32)"
+	if hasTrigram(db) {
+		match = "(" + match + " OR @q <% p.name)"
+		rank = "(" + rank + " + 0.5 * word_similarity(@q, p.name))"
+	}
+
+	where := "p.deleted_at IS NULL AND " + match
+	if len(params.CategoryIDs) > 0 {
+		where += " AND p.category_id IN @categories"
+	}
+
+	from := " FROM products p, to_tsquery('english', @tsquery) AS q(query) WHERE " + where
+
+	var results []ProductSearchResult
+	var total int64
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if hasTrigram(tx) {
+			// SET can't take bind parameters; set_config(..., true) is the
+			// parameterized form of SET LOCAL
+			threshold := strconv.FormatFloat(typoSimilarityThreshold, 'f', -1, 64)
+			if err := tx.Exec("SELECT set_config('pg_trgm.word_similarity_threshold', ?, true)", threshold).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Raw("SELECT COUNT(*)"+from, args).Scan(&total).Error; err != nil {
+			return err
+		}
+
+		return tx.Raw(`SELECT p.*, `+rank+` AS rank,
+				ts_headline('english', p.name, q.query, 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS name_highlight,
+				ts_headline('english', coalesce(p.description, ''), q.query, 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2') AS snippet`+
+			from+` ORDER BY rank DESC, p.id LIMIT @limit OFFSET @offset`, args).
+			Scan(&results).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if results == nil {
+		results = []ProductSearchResult{}
+	}
+	return results, total, nil
+}
+
+// prefixTSQuery turns free text into a to_tsquery expression where every word
+// is a prefix match, e.g. "red shi" -> "red:* & shi:*". Only letters and digits
+// survive, so user input can't inject tsquery operators.
+func prefixTSQuery(query string) string {
+	words := searchTermPattern.FindAllString(strings.ToLower(query), maxSearchTerms)
+
+	// Single letters (the "t" in "t-shirt") match nearly everything as a prefix
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if len([]rune(word)) > 1 || len(words) == 1 {
+			terms = append(terms, word+":*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// hasTrigram reports whether the pg_trgm extension is installed
+func hasTrigram(db *gorm.DB) bool {
+	trigramOnce.Do(func() {
+		db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&trigramAvailable)
+	})
+	return trigramAvailable
+}
@@ -0,0 +1,539 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductNotFound      = errors.New("product not found")
+	ErrVariantNotFound      = errors.New("variant not found")
+	ErrSKURequired          = errors.New("sku is required")
+	ErrSKUTaken             = errors.New("sku is already in use")
+	ErrOptionTypeExists     = errors.New("product already has an option with this name")
+	ErrOptionTypeNotFound   = errors.New("option not found")
+	ErrOptionTypeInUse      = errors.New("option is used by existing variants")
+	ErrInvalidVariantOption = errors.New("variant must pick exactly one existing value for every option of the product")
+	ErrDuplicateVariant     = errors.New("a variant with these options already exists")
+	ErrLastVariant          = errors.New("a product must keep at least one variant")
+	ErrMultipleVariants     = errors.New("product has several variants, set price and stock on each variant")
+	ErrInsufficientStock    = errors.New("not enough stock available")
+)
+
+// VariantInput describes a new variant. Options maps option name to value, e.g. {"size": "M"}.
+type VariantInput struct {
+	SKU            string
+	Price          float64
+	StockQuantity  int
+	ImageURL       string
+	Barcode        string
+	Options        map[string]string
+	CompareAtPrice *float64
+	By             PriceAuthor
+}
+
+// VariantUpdate changes the non-nil fields of a variant
+type VariantUpdate struct {
+	SKU            *string
+	Price          *float64
+	StockQuantity  *int
+	ImageURL       *string
+	Barcode        *string
+	IsDefault      *bool
+	CompareAtPrice *float64 // zero clears it
+	By             PriceAuthor
+}
+
+// DefaultVariantSKU is the SKU given to a product's automatic default
+// variant: P000123, or P000123-2 and so on when a variant already uses it
+func DefaultVariantSKU(db *gorm.DB, productID uint) (string, error) {
+	base := fmt.Sprintf("P%06d", productID)
+	sku := base
+	for n := 2; ; n++ {
+		// Soft-deleted variants still hold their SKU in the unique index
+		var count int64
+		if err := db.Unscoped().Model(&models.ProductVariant{}).Where("sku = ?", sku).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return sku, nil
+		}
+		sku = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// CreateProduct saves a product together with its default variant, which
+// carries the product's price, stock and image. The category is given by
+// category_id or by an existing category name. Attributes, when given, are
+// checked against the category's definitions and must include the required ones.
+func CreateProduct(db *gorm.DB, product *models.Product, by PriceAuthor) error {
+	// Options and further variants are added through their own endpoints
+	product.OptionTypes = nil
+	product.Variants = nil
+
+	if err := AssignProductCategory(db, product); err != nil {
+		return err
+	}
+	attributes, err := MergeProductAttributes(db, product.CategoryID, nil, product.Attributes, product.Attributes != nil)
+	if err != nil {
+		return err
+	}
+	product.Attributes = attributes
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+
+		sku, err := DefaultVariantSKU(tx, product.ID)
+		if err != nil {
+			return err
+		}
+		variant := models.ProductVariant{
+			ProductID:      product.ID,
+			SKU:            sku,
+			Price:          product.Price,
+			CompareAtPrice: positivePrice(product.CompareAtPrice),
+			StockQuantity:  product.StockQuantity,
+			IsDefault:      true,
+		}
+		if err := tx.Create(&variant).Error; err != nil {
+			return err
+		}
+		if err := recordNewVariantPrices(tx, variant, by); err != nil {
+			return err
+		}
+		product.Variants = []models.ProductVariant{variant}
+		return RefreshProductSummary(tx, product.ID)
+	})
+}
+
+// SetProductPriceStock updates the price fields and stock of a product that
+// has a single variant, so products without options can still be edited as
+// one item. Only Price, CompareAtPrice, StockQuantity and By are used.
+func SetProductPriceStock(db *gorm.DB, productID uint, input VariantUpdate) error {
+	var variants []models.ProductVariant
+	if err := db.Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+		return err
+	}
+	if len(variants) != 1 {
+		return ErrMultipleVariants
+	}
+
+	_, err := UpdateVariant(db, productID, variants[0].ID, VariantUpdate{
+		Price:          input.Price,
+		CompareAtPrice: input.CompareAtPrice,
+		StockQuantity:  input.StockQuantity,
+		By:             input.By,
+	})
+	return err
+}
+
+// CreateOptionType adds an option such as "size" with its values to a product
+func CreateOptionType(db *gorm.DB, productID uint, name string, values []string) (models.OptionType, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	if err := productExists(db, productID); err != nil {
+		return models.OptionType{}, err
+	}
+
+	var count int64
+	db.Model(&models.OptionType{}).Where("product_id = ? AND name = ?", productID, name).Count(&count)
+	if count > 0 {
+		return models.OptionType{}, ErrOptionTypeExists
+	}
+
+	var position int64
+	db.Model(&models.OptionType{}).Where("product_id = ?", productID).Count(&position)
+
+	optionType := models.OptionType{ProductID: productID, Name: name, Position: int(position)}
+	seen := map[string]bool{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		optionType.Values = append(optionType.Values, models.OptionValue{Value: v, Position: len(optionType.Values)})
+	}
+
+	err := db.Create(&optionType).Error
+	return optionType, err
+}
+
+// DeleteOptionType removes an option that no live variant uses
+func DeleteOptionType(db *gorm.DB, productID, optionTypeID uint) error {
+	var optionType models.OptionType
+	if err := db.Where("id = ? AND product_id = ?", optionTypeID, productID).First(&optionType).Error; err != nil {
+		return ErrOptionTypeNotFound
+	}
+
+	var used int64
+	if err := db.Table("variant_option_values").
+		Joins("JOIN option_values ON option_values.id = variant_option_values.option_value_id").
+		Joins("JOIN product_variants ON product_variants.id = variant_option_values.product_variant_id AND product_variants.deleted_at IS NULL").
+		Where("option_values.option_type_id = ?", optionTypeID).
+		Count(&used).Error; err != nil {
+		return err
+	}
+	if used > 0 {
+		return ErrOptionTypeInUse
+	}
+
+	return db.Delete(&optionType).Error
+}
+
+// CreateVariant adds a SKU to a product. When the product has options, the
+// variant must pick one value for each, and no two variants may pick the same.
+func CreateVariant(db *gorm.DB, productID uint, input VariantInput) (models.ProductVariant, error) {
+	var product models.Product
+	if err := db.Preload("OptionTypes.Values").First(&product, productID).Error; err != nil {
+		return models.ProductVariant{}, ErrProductNotFound
+	}
+
+	values, err := pickOptionValues(product.OptionTypes, input.Options)
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	sku := strings.TrimSpace(input.SKU)
+	if err := skuAvailable(db, sku, 0); err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	if len(values) > 0 {
+		if err := ensureUniqueCombination(db, productID, values); err != nil {
+			return models.ProductVariant{}, err
+		}
+	}
+
+	variant := models.ProductVariant{
+		ProductID:      productID,
+		SKU:            sku,
+		Price:          input.Price,
+		CompareAtPrice: positivePrice(input.CompareAtPrice),
+		StockQuantity:  input.StockQuantity,
+		ImageURL:       input.ImageURL,
+		Barcode:        strings.TrimSpace(input.Barcode),
+		OptionValues:   values,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("OptionValues.*").Create(&variant).Error; err != nil {
+			return err
+		}
+		if err := recordNewVariantPrices(tx, variant, input.By); err != nil {
+			return err
+		}
+		return RefreshProductSummary(tx, productID)
+	})
+	if err != nil {
+		return models.ProductVariant{}, err
+	}
+
+	return pricedVariant(db, productID, variant.ID)
+}
+
+// GetVariant loads one of a product's variants with its options
+func GetVariant(db *gorm.DB, productID, variantID uint) (models.ProductVariant, error) {
+	var variant models.ProductVariant
+	if err := db.Preload(models.VariantOptionsPreload).
+		Where("id = ? AND product_id = ?", variantID, productID).
+		First(&variant).Error; err != nil {
+		return variant, ErrVariantNotFound
+	}
+	return variant, nil
+}
+
+// UpdateVariant changes a variant's SKU, price, compare-at price, stock,
+// image, barcode or default flag. Price changes go into the price history.
+func UpdateVariant(db *gorm.DB, productID, variantID uint, input VariantUpdate) (models.ProductVariant, error) {
+	variant, err := GetVariant(db, productID, variantID)
+	if err != nil {
+		return variant, err
+	}
+
+	updates := map[string]interface{}{}
+	if input.SKU != nil {
+		sku := strings.TrimSpace(*input.SKU)
+		if err := skuAvailable(db, sku, variant.ID); err != nil {
+			return variant, err
+		}
+		updates["sku"] = sku
+	}
+	if input.Price != nil {
+		updates["price"] = *input.Price
+	}
+	compareAt := variant.CompareAtPrice
+	if input.CompareAtPrice != nil {
+		compareAt = positivePrice(input.CompareAtPrice)
+		updates["compare_at_price"] = compareAt
+	}
+	if input.StockQuantity != nil {
+		updates["stock_quantity"] = *input.StockQuantity
+	}
+	if input.ImageURL != nil {
+		updates["image_url"] = *input.ImageURL
+	}
+	if input.Barcode != nil {
+		updates["barcode"] = strings.TrimSpace(*input.Barcode)
+	}
+	if input.IsDefault != nil && *input.IsDefault {
+		updates["is_default"] = true
+	}
+
+	if len(updates) == 0 {
+		return pricedVariant(db, productID, variant.ID)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if updates["is_default"] == true {
+			if err := tx.Model(&models.ProductVariant{}).
+				Where("product_id = ? AND id <> ?", productID, variant.ID).
+				Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&models.ProductVariant{}).Where("id = ?", variant.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if input.Price != nil {
+			if err := recordPriceChange(tx, variant, "price", &variant.Price, input.Price, input.By); err != nil {
+				return err
+			}
+		}
+		if err := recordPriceChange(tx, variant, "compare_at_price", variant.CompareAtPrice, compareAt, input.By); err != nil {
+			return err
+		}
+		return RefreshProductSummary(tx, productID)
+	})
+	if err != nil {
+		return variant, err
+	}
+
+	return pricedVariant(db, productID, variant.ID)
+}
+
+// DeleteVariant retires a variant, dropping it from carts and wishlists. Past
+// orders keep pointing at it. If it was the default, the oldest remaining
+// variant becomes the default.
+func DeleteVariant(db *gorm.DB, productID, variantID uint) error {
+	variant, err := GetVariant(db, productID, variantID)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	db.Model(&models.ProductVariant{}).Where("product_id = ?", productID).Count(&count)
+	if count <= 1 {
+		return ErrLastVariant
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&variant).Error; err != nil {
+			return err
+		}
+
+		if variant.IsDefault {
+			var next models.ProductVariant
+			if err := tx.Where("product_id = ?", productID).Order("id").First(&next).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&next).Update("is_default", true).Error; err != nil {
+				return err
+			}
+		}
+
+		return RefreshProductSummary(tx, productID)
+	})
+}
+
+// ResolveVariant finds the variant a cart, wishlist or production request
+// means: the given variant, or the product's default when only the product is
+// named. The product must not be deleted.
+func ResolveVariant(db *gorm.DB, productID, variantID uint) (models.ProductVariant, error) {
+	var variant models.ProductVariant
+
+	query := db.Preload(models.VariantOptionsPreload).
+		Joins("JOIN products ON products.id = product_variants.product_id AND products.deleted_at IS NULL")
+
+	switch {
+	case variantID != 0:
+		query = query.Where("product_variants.id = ?", variantID)
+		if productID != 0 {
+			query = query.Where("product_variants.product_id = ?", productID)
+		}
+	case productID != 0:
+		query = query.Where("product_variants.product_id = ? AND product_variants.is_default", productID)
+	default:
+		return variant, ErrVariantNotFound
+	}
+
+	if err := query.First(&variant).Error; err != nil {
+		return variant, ErrVariantNotFound
+	}
+	return variant, nil
+}
+
+// AdjustVariantStock adds delta (negative to take stock) to a variant, never
+// going below zero, and updates the product's totals.
+func AdjustVariantStock(db *gorm.DB, variantID uint, delta int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ProductVariant{}).
+			Where("id = ? AND stock_quantity + ? >= 0", variantID, delta).
+			Update("stock_quantity", gorm.Expr("stock_quantity + ?", delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInsufficientStock
+		}
+
+		var variant models.ProductVariant
+		if err := tx.Unscoped().Select("product_id").First(&variant, variantID).Error; err != nil {
+			return err
+		}
+		return RefreshProductSummary(tx, variant.ProductID)
+	})
+}
+
+// RefreshProductSummary keeps products.price at the lowest price a customer
+// pays right now, sales included, with the price it is reduced from in
+// compare_at_price, and products.stock_quantity at the total stock, so listing
+// and filters on the product keep working without joining variants. The
+// sale logic mirrors applySale and CompareAtFor.
+func RefreshProductSummary(db *gorm.DB, productID uint) error {
+	return db.Exec(`WITH v AS (
+			SELECT pv.price AS regular, pv.compare_at_price AS compare_at,
+				(SELECT min(coalesce(s.sale_price, greatest(round(pv.price * (100 - s.percent_off) / 100, 2), 0.01)))
+					FROM price_schedules s
+					WHERE s.product_id = pv.product_id AND (s.variant_id IS NULL OR s.variant_id = pv.id)
+						AND s.cancelled_at IS NULL AND s.starts_at <= now() AND (s.ends_at IS NULL OR s.ends_at > now())) AS sale
+			FROM product_variants pv
+			WHERE pv.product_id = @id AND pv.deleted_at IS NULL
+		), priced AS (
+			SELECT CASE WHEN sale < regular THEN sale ELSE regular END AS effective,
+				CASE WHEN sale < regular THEN greatest(regular, coalesce(compare_at, 0)) ELSE compare_at END AS was,
+				coalesce(sale < regular, false) AS on_sale
+			FROM v
+		), cheapest AS (
+			SELECT effective, was FROM priced ORDER BY effective, was DESC NULLS LAST LIMIT 1
+		)
+		UPDATE products SET
+			price = coalesce((SELECT effective FROM cheapest), price),
+			compare_at_price = (SELECT CASE WHEN was > effective THEN was END FROM cheapest),
+			on_sale = coalesce((SELECT bool_or(on_sale) FROM priced), false),
+			stock_quantity = coalesce((SELECT sum(stock_quantity) FROM product_variants WHERE product_id = @id AND deleted_at IS NULL), 0),
+			updated_at = now()
+		WHERE id = @id`, map[string]interface{}{"id": productID}).Error
+}
+
+// recordNewVariantPrices starts the price history of a new variant
+func recordNewVariantPrices(tx *gorm.DB, variant models.ProductVariant, by PriceAuthor) error {
+	if err := recordPriceChange(tx, variant, "price", nil, &variant.Price, by); err != nil {
+		return err
+	}
+	return recordPriceChange(tx, variant, "compare_at_price", nil, variant.CompareAtPrice, by)
+}
+
+// positivePrice treats a zero or negative compare-at price as none
+func positivePrice(price *float64) *float64 {
+	if price == nil || *price <= 0 {
+		return nil
+	}
+	return price
+}
+
+func productExists(db *gorm.DB, productID uint) error {
+	var count int64
+	if err := db.Model(&models.Product{}).Where("id = ?", productID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+// skuAvailable checks no other variant, deleted ones included, has the SKU
+func skuAvailable(db *gorm.DB, sku string, exceptID uint) error {
+	if sku == "" {
+		return ErrSKURequired
+	}
+
+	var count int64
+	db.Unscoped().Model(&models.ProductVariant{}).Where("sku = ? AND id <> ?", sku, exceptID).Count(&count)
+	if count > 0 {
+		return ErrSKUTaken
+	}
+	return nil
+}
+
+// pickOptionValues matches {"size": "M"} against the product's options
+func pickOptionValues(optionTypes []models.OptionType, options map[string]string) ([]models.OptionValue, error) {
+	if len(options) != len(optionTypes) {
+		return nil, ErrInvalidVariantOption
+	}
+
+	normalized := make(map[string]string, len(options))
+	for name, value := range options {
+		normalized[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	values := make([]models.OptionValue, 0, len(optionTypes))
+	for _, ot := range optionTypes {
+		want, ok := normalized[ot.Name]
+		if !ok {
+			return nil, ErrInvalidVariantOption
+		}
+
+		found := false
+		for _, ov := range ot.Values {
+			if strings.EqualFold(ov.Value, want) {
+				values = append(values, ov)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrInvalidVariantOption
+		}
+	}
+	return values, nil
+}
+
+// ensureUniqueCombination rejects a second live variant with the same option values
+func ensureUniqueCombination(db *gorm.DB, productID uint, values []models.OptionValue) error {
+	var variants []models.ProductVariant
+	if err := db.Preload("OptionValues").Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+		return err
+	}
+
+	key := optionKey(values)
+	for _, v := range variants {
+		if optionKey(v.OptionValues) == key {
+			return ErrDuplicateVariant
+		}
+	}
+	return nil
+}
+
+func optionKey(values []models.OptionValue) string {
+	ids := make([]string, len(values))
+	for i, v := range values {
+		ids[i] = fmt.Sprint(v.ID)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// PermissionAll grants every permission; only the admin role has it by default
+const PermissionAll = "*"
+
+// Permissions lists every permission the API checks, with a description
+var Permissions = map[string]string{
+	PermissionAll:         "Full access to everything",
+	"users:read":          "View users, their sessions and profiles",
+	"users:update":        "Edit user details",
+	"users:block":         "Block, unblock and unlock users",
+	"users:delete":        "Delete users",
+	PermissionImpersonate: "Act as a customer to reproduce their issue",
+	"sessions:revoke":     "Force-logout a user's sessions",
+	"audit:read":          "View the login audit trail",
+	"settings:read":       "View store settings",
+	"settings:update":     "Change store settings",
+	"roles:read":          "View roles and permissions",
+	"roles:manage":        "Create, edit and delete roles and assign them to users",
+	"api_keys:manage":     "Manage service accounts and their API keys",
+	"products:write":      "Create, edit and delete products",
+	"reviews:moderate":    "Approve, reject and delete product reviews",
+	"production:read":     "View production runs",
+	"production:update":   "Start production runs and update their status",
+	"orders:read":         "View all orders",
+	"orders:update":       "Update order status",
+	"payments:update":     "Update payment status",
+}
+
+// DefaultRole is a role created by the seeder
+type DefaultRole struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// DefaultRoles are seeded on startup if they don't exist yet
+var DefaultRoles = []DefaultRole{
+	{Name: "admin", Description: "Full access", Permissions: []string{PermissionAll}},
+	{Name: "user", Description: "Shopper, no admin access"},
+	{
+		Name:        "catalog_manager",
+		Description: "Maintains the product catalog",
+		Permissions: []string{"products:write", "reviews:moderate", "production:read", "production:update"},
+	},
+	{
+		Name:        "warehouse_operator",
+		Description: "Fulfils orders and runs production",
+		Permissions: []string{"orders:read", "orders:update", "production:read", "production:update"},
+	},
+	{
+		Name:        "support_agent",
+		Description: "Helps customers with their accounts and orders",
+		Permissions: []string{"users:read", "users:block", "users:impersonate", "sessions:revoke", "audit:read", "orders:read"},
+	},
+}
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrRoleInUse         = errors.New("role is still assigned to users")
+	ErrSystemRole        = errors.New("system roles cannot be deleted")
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrPermissionNotHeld = errors.New("you can't grant or change permissions you don't have")
+	ErrSystemRoleLocked  = errors.New("the permissions of system roles cannot be changed")
+)
+
+// Role permissions are checked on every admin request; edits clear the entry
+var rolePermissionCache = newTTLCache(time.Minute)
+
+// HasPermission reports whether the role grants permission
+func HasPermission(db *gorm.DB, role, permission string) (bool, error) {
+	perms, err := rolePermissions(db, role)
+	if err != nil {
+		return false, err
+	}
+	return perms[PermissionAll] || perms[permission], nil
+}
+
+// RoleOutranks reports whether role grants any permission the caller lacks,
+// where has answers for one permission at a time
+func RoleOutranks(db *gorm.DB, role string, has func(permission string) (bool, error)) (bool, error) {
+	perms, err := rolePermissions(db, role)
+	if err != nil {
+		return false, err
+	}
+	for permission := range perms {
+		ok, err := has(permission)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RoleExists reports whether a role with this name exists
+func RoleExists(db *gorm.DB, name string) bool {
+	var count int64
+	db.Model(&models.Role{}).Where("name = ?", name).Count(&count)
+	return count > 0
+}
+
+// CreateRole adds a custom role with the given permissions, all of which
+// callerRole must hold itself
+func CreateRole(db *gorm.DB, callerRole, name, description string, permissionNames []string) (models.Role, error) {
+	name = strings.TrimSpace(name)
+	if RoleExists(db, name) {
+		return models.Role{}, ErrRoleExists
+	}
+
+	if err := checkCanGrant(db, callerRole, permissionNames); err != nil {
+		return models.Role{}, err
+	}
+
+	perms, err := findPermissions(db, permissionNames)
+	if err != nil {
+		return models.Role{}, err
+	}
+
+	role := models.Role{Name: name, Description: description, Permissions: perms}
+	if err := db.Create(&role).Error; err != nil {
+		return models.Role{}, err
+	}
+	return role, nil
+}
+
+// UpdateRole changes a role's description and, if permissionNames is not nil,
+// replaces its permissions. callerRole can only edit roles that don't outrank
+// it and only grant permissions it holds; system roles keep their permissions.
+func UpdateRole(db *gorm.DB, callerRole string, id uint, description *string, permissionNames []string) (models.Role, error) {
+	var role models.Role
+	if err := db.First(&role, id).Error; err != nil {
+		return role, ErrRoleNotFound
+	}
+
+	outranked, err := RoleOutranks(db, role.Name, func(permission string) (bool, error) {
+		return HasPermission(db, callerRole, permission)
+	})
+	if err != nil {
+		return role, err
+	}
+	if outranked {
+		return role, ErrPermissionNotHeld
+	}
+
+	if permissionNames != nil {
+		if role.IsSystem {
+			return role, ErrSystemRoleLocked
+		}
+		if err := checkCanGrant(db, callerRole, permissionNames); err != nil {
+			return role, err
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if description != nil {
+			if err := tx.Model(&role).Update("description", *description).Error; err != nil {
+				return err
+			}
+		}
+
+		if permissionNames != nil {
+			perms, err := findPermissions(tx, permissionNames)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Replace(perms); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return role, err
+	}
+
+	rolePermissionCache.Delete(role.Name)
+
+	err = db.Preload("Permissions").First(&role, id).Error
+	return role, err
+}
+
+// DeleteRole removes a custom role that no user holds anymore
+func DeleteRole(db *gorm.DB, id uint) error {
+	var role models.Role
+	if err := db.First(&role, id).Error; err != nil {
+		return ErrRoleNotFound
+	}
+	if role.IsSystem {
+		return ErrSystemRole
+	}
+
+	var holders int64
+	if err := db.Model(&models.User{}).Where("role = ?", role.Name).Count(&holders).Error; err != nil {
+		return err
+	}
+	if holders > 0 {
+		return ErrRoleInUse
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	rolePermissionCache.Delete(role.Name)
+	return nil
+}
+
+// rolePermissions returns the set of permission names a role grants
+func rolePermissions(db *gorm.DB, role string) (map[string]bool, error) {
+	if cached, ok := rolePermissionCache.Get(role); ok {
+		return cached.(map[string]bool), nil
+	}
+
+	var names []string
+	err := db.Table("permissions").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Where("roles.name = ?", role).
+		Pluck("permissions.name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make(map[string]bool, len(names))
+	for _, name := range names {
+		perms[name] = true
+	}
+
+	rolePermissionCache.Set(role, perms)
+	return perms, nil
+}
+
+// checkCanGrant fails unless callerRole holds every permission in names, so
+// managing roles never hands out more than the manager has
+func checkCanGrant(db *gorm.DB, callerRole string, names []string) error {
+	for _, name := range names {
+		allowed, err := HasPermission(db, callerRole, name)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return ErrPermissionNotHeld
+		}
+	}
+	return nil
+}
+
+// findPermissions loads permissions by name, rejecting names not in the catalog
+func findPermissions(db *gorm.DB, names []string) ([]models.Permission, error) {
+	if len(names) == 0 {
+		return []models.Permission{}, nil
+	}
+
+	for _, name := range names {
+		if _, ok := Permissions[name]; !ok {
+			return nil, ErrUnknownPermission
+		}
+	}
+
+	var perms []models.Permission
+	if err := db.Where("name IN ?", names).Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
@@ -0,0 +1,567 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReviewNotFound       = errors.New("review not found")
+	ErrReviewPhotoNotFound  = errors.New("review photo not found")
+	ErrNotVerifiedPurchaser = errors.New("only customers who have received this product can review it")
+	ErrAlreadyReviewed      = errors.New("you have already reviewed this product")
+	ErrInvalidRating        = errors.New("rating must be between 1 and 5")
+	ErrReviewNotPublished   = errors.New("review is not published")
+	ErrOwnReviewVote        = errors.New("you can't vote on your own review")
+	ErrTooManyReviewPhotos  = errors.New("review already has the maximum number of photos")
+	ErrInvalidReviewStatus  = errors.New("status must be approved or rejected")
+)
+
+// MaxReviewPhotos is how many photos one review can carry
+const MaxReviewPhotos = 5
+
+// ReviewMediaPrefix is where review photos are stored. GET /media serves them
+// publicly only once the review is approved.
+const ReviewMediaPrefix = "reviews/"
+
+// Review states
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// ReviewInput is what a customer writes; on update nil fields are left alone
+type ReviewInput struct {
+	Rating *int
+	Title  *string
+	Body   *string
+}
+
+// ReviewResponse is a review as shown to shoppers
+type ReviewResponse struct {
+	ID               uint                 `json:"id"`
+	ProductID        uint                 `json:"product_id"`
+	Rating           int                  `json:"rating"`
+	Title            string               `json:"title"`
+	Body             string               `json:"body"`
+	Photos           []models.ReviewPhoto `json:"photos"`
+	HelpfulCount     int                  `json:"helpful_count"`
+	Reviewer         string               `json:"reviewer"`
+	VerifiedPurchase bool                 `json:"verified_purchase"`
+	Status           string               `json:"status,omitempty"` // only on the author's and admins' views
+	ModerationNote   string               `json:"moderation_note,omitempty"`
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
+}
+
+// RatingSummary breaks a product's approved reviews down by star
+type RatingSummary struct {
+	Average      float64     `json:"average"`
+	Count        int         `json:"count"`
+	Distribution map[int]int `json:"distribution"` // stars -> number of reviews
+}
+
+// reviewsNeedApproval holds new and edited reviews for moderation (REVIEWS_REQUIRE_APPROVAL, default true)
+func reviewsNeedApproval() bool {
+	return envBool("REVIEWS_REQUIRE_APPROVAL", true)
+}
+
+// ToReviewResponse shapes a review, with its photos and user loaded, for the API.
+// withStatus adds the moderation status.
+func ToReviewResponse(r models.Review, withStatus bool) ReviewResponse {
+	resp := ReviewResponse{
+		ID:               r.ID,
+		ProductID:        r.ProductID,
+		Rating:           r.Rating,
+		Title:            r.Title,
+		Body:             r.Body,
+		Photos:           r.Photos,
+		HelpfulCount:     r.HelpfulCount,
+		Reviewer:         reviewerName(r.User),
+		VerifiedPurchase: r.OrderItemID != 0,
+		CreatedAt:        r.CreatedAt,
+		UpdatedAt:        r.UpdatedAt,
+	}
+	if resp.Photos == nil {
+		resp.Photos = []models.ReviewPhoto{}
+	}
+	if withStatus {
+		resp.Status = r.Status
+		resp.ModerationNote = r.ModerationNote
+	}
+	if r.Status != ReviewApproved {
+		resp.Photos = signReviewPhotos(resp.Photos)
+	}
+	return resp
+}
+
+// signReviewPhotos gives photos of an unpublished review expiring signed
+// URLs, the only way GET /media serves them to the author and moderators
+func signReviewPhotos(photos []models.ReviewPhoto) []models.ReviewPhoto {
+	signed := make([]models.ReviewPhoto, len(photos))
+	for i, p := range photos {
+		p.URL = signedMediaURL(p.Key)
+		p.ThumbnailURL = signedMediaURL(p.ThumbnailKey)
+		signed[i] = p
+	}
+	return signed
+}
+
+func signedMediaURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	token, err := utils.GenerateMediaToken(key)
+	if err != nil {
+		return ""
+	}
+	return MediaURL(key) + "?token=" + url.QueryEscape(token)
+}
+
+// ReviewMediaPublic reports whether a stored review photo may be served
+// without a token, which is once its review is approved
+func ReviewMediaPublic(db *gorm.DB, key string) (bool, error) {
+	var count int64
+	err := db.Model(&models.ReviewPhoto{}).
+		Joins("JOIN reviews ON reviews.id = review_photos.review_id").
+		Where("(review_photos.key = ? OR review_photos.thumbnail_key = ?) AND reviews.status = ?", key, key, ReviewApproved).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// reviewerName shows only the first name, e.g. "Priya"
+func reviewerName(user *models.User) string {
+	if user == nil || user.DeletedAt.Valid {
+		return "Former customer"
+	}
+	if fields := strings.Fields(user.FullName); len(fields) > 0 {
+		return fields[0]
+	}
+	return "Customer"
+}
+
+// ReviewPreloads loads what ToReviewResponse needs
+func ReviewPreloads(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Photos", func(db *gorm.DB) *gorm.DB { return db.Order("position, id") }).
+		Preload("User", func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+}
+
+// GetReview loads a review with its photos and author
+func GetReview(db *gorm.DB, id uint) (models.Review, error) {
+	var review models.Review
+	if err := ReviewPreloads(db).First(&review, id).Error; err != nil {
+		return review, ErrReviewNotFound
+	}
+	return review, nil
+}
+
+// CreateReview records a customer's review of a product they have received
+func CreateReview(db *gorm.DB, userID, productID uint, input ReviewInput) (models.Review, error) {
+	if err := productExists(db, productID); err != nil {
+		return models.Review{}, err
+	}
+	if input.Rating == nil || *input.Rating < 1 || *input.Rating > 5 {
+		return models.Review{}, ErrInvalidRating
+	}
+
+	var existing int64
+	db.Model(&models.Review{}).Where("product_id = ? AND user_id = ?", productID, userID).Count(&existing)
+	if existing > 0 {
+		return models.Review{}, ErrAlreadyReviewed
+	}
+
+	orderItemID, err := deliveredOrderItem(db, userID, productID)
+	if err != nil {
+		return models.Review{}, err
+	}
+
+	review := models.Review{
+		ProductID:   productID,
+		UserID:      userID,
+		OrderItemID: orderItemID,
+		Rating:      *input.Rating,
+		Status:      ReviewApproved,
+	}
+	if input.Title != nil {
+		review.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Body != nil {
+		review.Body = strings.TrimSpace(*input.Body)
+	}
+	if reviewsNeedApproval() {
+		review.Status = ReviewPending
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&review).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "idx_review_product_user") {
+				return ErrAlreadyReviewed
+			}
+			return err
+		}
+		return refreshProductRating(tx, productID)
+	})
+	if err != nil {
+		return models.Review{}, err
+	}
+	return GetReview(db, review.ID)
+}
+
+// UpdateReview lets the author edit their review. With moderation on, the
+// edit goes back into the queue before it is shown again.
+func UpdateReview(db *gorm.DB, userID, reviewID uint, input ReviewInput) (models.Review, error) {
+	review, err := ownReview(db, userID, reviewID)
+	if err != nil {
+		return review, err
+	}
+
+	updates := map[string]interface{}{}
+	if input.Rating != nil {
+		if *input.Rating < 1 || *input.Rating > 5 {
+			return review, ErrInvalidRating
+		}
+		updates["rating"] = *input.Rating
+	}
+	if input.Title != nil {
+		updates["title"] = strings.TrimSpace(*input.Title)
+	}
+	if input.Body != nil {
+		updates["body"] = strings.TrimSpace(*input.Body)
+	}
+	if len(updates) == 0 {
+		return GetReview(db, review.ID)
+	}
+	if reviewsNeedApproval() {
+		updates["status"] = ReviewPending
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&review).Updates(updates).Error; err != nil {
+			return err
+		}
+		return refreshProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		return review, err
+	}
+	return GetReview(db, review.ID)
+}
+
+// DeleteReview removes a review, by its author or a moderator (userID 0)
+func DeleteReview(ctx context.Context, db *gorm.DB, userID, reviewID uint) error {
+	var (
+		review models.Review
+		err    error
+	)
+	if userID == 0 {
+		review, err = GetReview(db, reviewID)
+	} else {
+		review, err = ownReview(db, userID, reviewID)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("review_id = ?", review.ID).Delete(&models.ReviewVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Select("Photos").Delete(&review).Error; err != nil {
+			return err
+		}
+		return refreshProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		return err
+	}
+
+	deleteReviewPhotoFiles(ctx, review.Photos)
+	return nil
+}
+
+// AddReviewPhoto attaches an uploaded image to the author's review
+func AddReviewPhoto(ctx context.Context, db *gorm.DB, userID, reviewID uint, r io.Reader) (models.ReviewPhoto, error) {
+	review, err := ownReview(db, userID, reviewID)
+	if err != nil {
+		return models.ReviewPhoto{}, err
+	}
+	if len(review.Photos) >= MaxReviewPhotos {
+		return models.ReviewPhoto{}, ErrTooManyReviewPhotos
+	}
+
+	stored, err := StoreImage(ctx, r, fmt.Sprintf("%s%d", ReviewMediaPrefix, review.ID), 0, 0)
+	if err != nil {
+		return models.ReviewPhoto{}, err
+	}
+
+	photo := models.ReviewPhoto{
+		ReviewID:     review.ID,
+		Key:          stored.Key,
+		ThumbnailKey: stored.ThumbnailKey,
+		URL:          MediaURL(stored.Key),
+		ThumbnailURL: MediaURL(stored.ThumbnailKey),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Lock the review so parallel uploads can't both pass the limit
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&review, review.ID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.ReviewPhoto{}).Where("review_id = ?", review.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxReviewPhotos {
+			return ErrTooManyReviewPhotos
+		}
+
+		photo.Position = int(count)
+		if err := tx.Create(&photo).Error; err != nil {
+			return err
+		}
+		// New photos need a look from a moderator too
+		if reviewsNeedApproval() && review.Status != ReviewPending {
+			if err := tx.Model(&review).Update("status", ReviewPending).Error; err != nil {
+				return err
+			}
+			return refreshProductRating(tx, review.ProductID)
+		}
+		return nil
+	})
+	if err != nil {
+		DeleteStoredFiles(ctx, stored.Key, stored.ThumbnailKey)
+		return models.ReviewPhoto{}, err
+	}
+	if review.Status != ReviewApproved {
+		photo = signReviewPhotos([]models.ReviewPhoto{photo})[0]
+	}
+	return photo, nil
+}
+
+// DeleteReviewPhoto removes a photo from the author's review
+func DeleteReviewPhoto(ctx context.Context, db *gorm.DB, userID, reviewID, photoID uint) error {
+	review, err := ownReview(db, userID, reviewID)
+	if err != nil {
+		return err
+	}
+
+	var photo models.ReviewPhoto
+	if err := db.Where("id = ? AND review_id = ?", photoID, review.ID).First(&photo).Error; err != nil {
+		return ErrReviewPhotoNotFound
+	}
+	if err := db.Delete(&photo).Error; err != nil {
+		return err
+	}
+
+	deleteReviewPhotoFiles(ctx, []models.ReviewPhoto{photo})
+	return nil
+}
+
+// VoteHelpful marks an approved review as helpful; voting twice is a no-op
+func VoteHelpful(db *gorm.DB, userID, reviewID uint) (int, error) {
+	review, err := publishedReview(db, reviewID)
+	if err != nil {
+		return 0, err
+	}
+	if review.UserID == userID {
+		return 0, ErrOwnReviewVote
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ReviewVote{ReviewID: reviewID, UserID: userID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&review).UpdateColumn("helpful_count", gorm.Expr("helpful_count + 1")).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return helpfulCount(db, reviewID), nil
+}
+
+// UnvoteHelpful takes a helpful vote back
+func UnvoteHelpful(db *gorm.DB, userID, reviewID uint) (int, error) {
+	if _, err := publishedReview(db, reviewID); err != nil {
+		return 0, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("review_id = ? AND user_id = ?", reviewID, userID).Delete(&models.ReviewVote{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Review{}).Where("id = ?", reviewID).
+			UpdateColumn("helpful_count", gorm.Expr("greatest(helpful_count - 1, 0)")).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return helpfulCount(db, reviewID), nil
+}
+
+// ModerateReview approves or rejects a review from the moderation queue
+func ModerateReview(db *gorm.DB, moderatorID, reviewID uint, status, note string) (models.Review, error) {
+	if status != ReviewApproved && status != ReviewRejected {
+		return models.Review{}, ErrInvalidReviewStatus
+	}
+
+	review, err := GetReview(db, reviewID)
+	if err != nil {
+		return review, err
+	}
+
+	updates := map[string]interface{}{
+		"status":          status,
+		"moderation_note": strings.TrimSpace(note),
+		"moderated_at":    time.Now(),
+		"moderated_by":    nil,
+	}
+	if moderatorID != 0 {
+		updates["moderated_by"] = moderatorID
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Keep updated_at as the author's last edit
+		if err := tx.Model(&review).UpdateColumns(updates).Error; err != nil {
+			return err
+		}
+		return refreshProductRating(tx, review.ProductID)
+	})
+	if err != nil {
+		return review, err
+	}
+	return GetReview(db, review.ID)
+}
+
+// ProductRatingSummary counts a product's approved reviews per star
+func ProductRatingSummary(db *gorm.DB, productID uint) (RatingSummary, error) {
+	var rows []struct {
+		Rating int
+		Count  int
+	}
+	if err := db.Model(&models.Review{}).
+		Select("rating, count(*) AS count").
+		Where("product_id = ? AND status = ?", productID, ReviewApproved).
+		Group("rating").
+		Scan(&rows).Error; err != nil {
+		return RatingSummary{}, err
+	}
+
+	summary := RatingSummary{Distribution: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	total := 0
+	for _, r := range rows {
+		summary.Distribution[r.Rating] = r.Count
+		summary.Count += r.Count
+		total += r.Rating * r.Count
+	}
+	if summary.Count > 0 {
+		summary.Average = math.Round(float64(total)/float64(summary.Count)*100) / 100
+	}
+	return summary, nil
+}
+
+// DeleteUserReviews removes everything a user wrote, for account deletion,
+// and returns the photo files to delete once the transaction commits
+func DeleteUserReviews(tx *gorm.DB, userID uint) ([]models.ReviewPhoto, error) {
+	var reviews []models.Review
+	if err := tx.Preload("Photos").Where("user_id = ?", userID).Find(&reviews).Error; err != nil {
+		return nil, err
+	}
+
+	// Their votes on other reviews go too
+	if err := tx.Model(&models.Review{}).
+		Where("id IN (?)", tx.Model(&models.ReviewVote{}).Select("review_id").Where("user_id = ?", userID)).
+		UpdateColumn("helpful_count", gorm.Expr("greatest(helpful_count - 1, 0)")).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&models.ReviewVote{}).Error; err != nil {
+		return nil, err
+	}
+
+	var photos []models.ReviewPhoto
+	for _, review := range reviews {
+		if err := tx.Where("review_id = ?", review.ID).Delete(&models.ReviewVote{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Select("Photos").Delete(&review).Error; err != nil {
+			return nil, err
+		}
+		if err := refreshProductRating(tx, review.ProductID); err != nil {
+			return nil, err
+		}
+		photos = append(photos, review.Photos...)
+	}
+	return photos, nil
+}
+
+// deliveredOrderItem finds a delivered order line for the product, the proof
+// of purchase a review needs
+func deliveredOrderItem(db *gorm.DB, userID, productID uint) (uint, error) {
+	var item models.OrderItem
+	err := db.Joins("JOIN orders ON orders.id = order_items.order_id AND orders.deleted_at IS NULL").
+		Where("orders.user_id = ? AND orders.status = ? AND order_items.product_id = ?", userID, "delivered", productID).
+		Order("orders.updated_at DESC").
+		First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrNotVerifiedPurchaser
+	}
+	return item.ID, err
+}
+
+// ownReview loads a review only if userID wrote it
+func ownReview(db *gorm.DB, userID, reviewID uint) (models.Review, error) {
+	review, err := GetReview(db, reviewID)
+	if err != nil || review.UserID != userID {
+		return models.Review{}, ErrReviewNotFound
+	}
+	return review, nil
+}
+
+func publishedReview(db *gorm.DB, reviewID uint) (models.Review, error) {
+	var review models.Review
+	if err := db.First(&review, reviewID).Error; err != nil {
+		return review, ErrReviewNotFound
+	}
+	if review.Status != ReviewApproved {
+		return review, ErrReviewNotPublished
+	}
+	return review, nil
+}
+
+func helpfulCount(db *gorm.DB, reviewID uint) int {
+	var review models.Review
+	db.Select("helpful_count").First(&review, reviewID)
+	return review.HelpfulCount
+}
+
+// refreshProductRating keeps products.rating_average and review_count in step
+// with the approved reviews, so product listings don't need to join reviews
+func refreshProductRating(db *gorm.DB, productID uint) error {
+	return db.Exec(`UPDATE products SET
+			rating_average = coalesce((SELECT round(avg(rating), 2) FROM reviews WHERE product_id = @id AND status = @approved), 0),
+			review_count = (SELECT count(*) FROM reviews WHERE product_id = @id AND status = @approved)
+		WHERE id = @id`, map[string]interface{}{"id": productID, "approved": ReviewApproved}).Error
+}
+
+func deleteReviewPhotoFiles(ctx context.Context, photos []models.ReviewPhoto) {
+	for _, p := range photos {
+		if err := DeleteStoredFiles(ctx, p.Key, p.ThumbnailKey); err != nil {
+			log.Printf("⚠️ Could not delete files of review photo %d: %v", p.ID, err)
+		}
+	}
+}
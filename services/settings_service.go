@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// Known store settings
+const (
+	SettingRequire2FARoles = "require_2fa_roles" // comma separated roles that must use 2FA
+)
+
+// DefaultSettings are used until an admin overrides them
+var DefaultSettings = map[string]string{
+	SettingRequire2FARoles: "admin",
+}
+
+// ErrUnknownSetting is returned when writing a key that isn't a known setting
+var ErrUnknownSetting = errors.New("unknown setting")
+
+// GetSetting returns a setting's stored value, or its default
+func GetSetting(db *gorm.DB, key string) string {
+	var setting models.StoreSetting
+	if err := db.Where("key = ?", key).First(&setting).Error; err != nil {
+		return DefaultSettings[key]
+	}
+	return setting.Value
+}
+
+// GetAllSettings returns every known setting with its current value
+func GetAllSettings(db *gorm.DB) map[string]string {
+	settings := map[string]string{}
+	for key, value := range DefaultSettings {
+		settings[key] = value
+	}
+
+	var stored []models.StoreSetting
+	db.Find(&stored)
+	for _, s := range stored {
+		if _, ok := DefaultSettings[s.Key]; ok {
+			settings[s.Key] = s.Value
+		}
+	}
+	return settings
+}
+
+// SetSetting stores a value for a known setting
+func SetSetting(db *gorm.DB, key, value string) error {
+	if _, ok := DefaultSettings[key]; !ok {
+		return ErrUnknownSetting
+	}
+	return db.Save(&models.StoreSetting{Key: key, Value: value}).Error
+}
+
+// RoleRequires2FA reports whether users with this role must use two-factor auth
+func RoleRequires2FA(db *gorm.DB, role string) bool {
+	for _, r := range strings.Split(GetSetting(db, SettingRequire2FARoles), ",") {
+		if strings.TrimSpace(r) == role {
+			return true
+		}
+	}
+	return false
+}
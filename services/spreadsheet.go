@@ -0,0 +1,478 @@
+package services
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnreadableSpreadsheet is returned for files that are neither CSV nor XLSX
+	ErrUnreadableSpreadsheet = errors.New("file is not a readable CSV or XLSX spreadsheet")
+	// ErrSpreadsheetTooLarge is returned when a file unpacks to more rows, cells or bytes than allowed
+	ErrSpreadsheetTooLarge = errors.New("the spreadsheet is too large")
+)
+
+// Limits that keep a small, highly compressed XLSX from exhausting memory
+const (
+	xlsxMaxColumns   = 16384     // XFD, the last column Excel allows
+	xlsxMaxCells     = 4_000_000 // across the whole sheet, padding included
+	xlsxMaxPartBytes = 64 << 20  // unpacked size of one file in the archive
+	xlsxMaxTotalSize = 128 << 20 // unpacked size of every file read
+)
+
+// Spreadsheet formats for import and export
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// DetectSpreadsheetFormat tells XLSX (a zip archive) from CSV by the file's
+// first bytes rather than its name
+func DetectSpreadsheetFormat(data []byte) string {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return FormatXLSX
+	}
+	return FormatCSV
+}
+
+// readSpreadsheet returns every row of a CSV file or of an XLSX workbook's
+// first sheet, failing with ErrSpreadsheetTooLarge past maxRows rows
+func readSpreadsheet(data []byte, format string, maxRows int) ([][]string, error) {
+	var rows [][]string
+	var err error
+	if format == FormatXLSX {
+		rows, err = readXLSX(data, maxRows)
+	} else {
+		rows, err = readCSV(data, maxRows)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		for i, value := range row {
+			row[i] = unescapeFormula(value)
+		}
+	}
+	return rows, nil
+}
+
+func readCSV(data []byte, maxRows int) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // BOM added by Excel
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1 // short rows just leave the trailing cells empty
+
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnreadableSpreadsheet, err)
+		}
+		if len(rows) == maxRows {
+			return nil, ErrSpreadsheetTooLarge
+		}
+		rows = append(rows, row)
+	}
+}
+
+// escapeFormula keeps a text cell starting with =, +, - or @ from being run
+// as a formula when the export is opened in a spreadsheet app. Values that
+// already look escaped get another quote so they survive unescapeFormula.
+func escapeFormula(value string) string {
+	if looksLikeFormula(strings.TrimLeft(value, "'")) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeFormula undoes escapeFormula, so exports import back unchanged
+func unescapeFormula(value string) string {
+	if strings.HasPrefix(value, "'") && looksLikeFormula(strings.TrimLeft(value, "'")) {
+		return value[1:]
+	}
+	return value
+}
+
+func looksLikeFormula(value string) bool {
+	return value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0]))
+}
+
+// RowWriter writes a spreadsheet one row at a time
+type RowWriter interface {
+	Write(row []string) error
+	Close() error
+}
+
+// NewRowWriter streams a CSV or XLSX file to w. Columns named in numeric are
+// written as numbers in XLSX so spreadsheet formulas work on them; every other
+// cell that looks like a formula is escaped.
+func NewRowWriter(w io.Writer, format string, numeric map[int]bool) (RowWriter, error) {
+	if format == FormatXLSX {
+		return newXLSXWriter(w, numeric)
+	}
+	return &csvRowWriter{w: csv.NewWriter(w), numeric: numeric}, nil
+}
+
+type csvRowWriter struct {
+	w       *csv.Writer
+	numeric map[int]bool
+}
+
+func (c *csvRowWriter) Write(row []string) error {
+	out := make([]string, len(row))
+	for i, value := range row {
+		if _, err := strconv.ParseFloat(value, 64); err == nil && c.numeric[i] {
+			out[i] = value
+			continue
+		}
+		out[i] = escapeFormula(value)
+	}
+	return c.w.Write(out)
+}
+
+func (c *csvRowWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// --- XLSX ---
+//
+// Just enough of SpreadsheetML to read the first sheet of a workbook saved by
+// Excel, LibreOffice or Google Sheets, and to write a single-sheet workbook.
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxRow struct {
+	Cells []struct {
+		Ref    string   `xml:"r,attr"`
+		Type   string   `xml:"t,attr"`
+		Value  string   `xml:"v"`
+		Inline xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+// xlsxArchive reads parts of a workbook, charging their unpacked size to one budget
+type xlsxArchive struct {
+	files  map[string]*zip.File
+	budget int64
+}
+
+func readXLSX(data []byte, maxRows int) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrUnreadableSpreadsheet
+	}
+	archive := &xlsxArchive{files: make(map[string]*zip.File, len(zr.File)), budget: xlsxMaxTotalSize}
+	for _, f := range zr.File {
+		archive.files[f.Name] = f
+	}
+
+	var shared xlsxSharedStrings
+	if err := archive.decode("xl/sharedStrings.xml", &shared); err != nil && !errors.Is(err, errMissingPart) {
+		return nil, err
+	}
+
+	rc, err := archive.open(archive.firstSheetPath())
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	// Rows are decoded one at a time so the row cap stops the parse early
+	var rows [][]string
+	cells := 0
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, archive.decodeError(err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		if len(rows) == maxRows {
+			return nil, ErrSpreadsheetTooLarge
+		}
+
+		var r xlsxRow
+		if err := dec.DecodeElement(&r, &start); err != nil {
+			return nil, archive.decodeError(err)
+		}
+
+		var row []string
+		for i, c := range r.Cells {
+			col := i
+			if c.Ref != "" {
+				if col = xlsxColumnIndex(c.Ref); col < 0 {
+					return nil, fmt.Errorf("%w: cell %s is past the last column", ErrUnreadableSpreadsheet, c.Ref)
+				}
+			}
+			if col >= len(row) {
+				if cells += col + 1 - len(row); cells > xlsxMaxCells {
+					return nil, ErrSpreadsheetTooLarge
+				}
+				row = append(row, make([]string, col+1-len(row))...)
+			}
+
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(c.Value)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, ErrUnreadableSpreadsheet
+				}
+				row[col] = shared.Items[idx].String()
+			case "inlineStr":
+				row[col] = c.Inline.String()
+			default: // n, str, b, e
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// firstSheetPath follows the workbook's relationships to its first sheet
+func (a *xlsxArchive) firstSheetPath() string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook xlsxWorkbook
+	var rels xlsxRelationships
+	if a.decode("xl/workbook.xml", &workbook) != nil || a.decode("xl/_rels/workbook.xml.rels", &rels) != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].RelID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return fallback
+}
+
+var errMissingPart = fmt.Errorf("%w: missing part", ErrUnreadableSpreadsheet)
+
+// open returns a reader for one part that fails with ErrSpreadsheetTooLarge
+// once the part, or everything read so far, unpacks past its limit
+func (a *xlsxArchive) open(name string) (io.ReadCloser, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, errMissingPart
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, ErrUnreadableSpreadsheet
+	}
+	return &budgetReader{ReadCloser: rc, part: xlsxMaxPartBytes, total: &a.budget}, nil
+}
+
+func (a *xlsxArchive) decode(name string, v interface{}) error {
+	rc, err := a.open(name)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return a.decodeError(fmt.Errorf("%s: %w", name, err))
+	}
+	return nil
+}
+
+// decodeError keeps ErrSpreadsheetTooLarge visible through the XML decoder
+func (a *xlsxArchive) decodeError(err error) error {
+	if errors.Is(err, ErrSpreadsheetTooLarge) {
+		return ErrSpreadsheetTooLarge
+	}
+	return fmt.Errorf("%w: %v", ErrUnreadableSpreadsheet, err)
+}
+
+// budgetReader is an io.LimitReader that reports an overrun instead of a
+// silent EOF, charged against both a per-part and a shared limit
+type budgetReader struct {
+	io.ReadCloser
+	part  int64
+	total *int64
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	limit := min(r.part, *r.total)
+	if limit <= 0 {
+		// Exactly at the limit is fine as long as nothing follows
+		var probe [1]byte
+		if n, err := r.ReadCloser.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrSpreadsheetTooLarge
+	}
+	if int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.part -= int64(n)
+	*r.total -= int64(n)
+	return n, err
+}
+
+// xlsxColumnIndex turns a cell reference such as "AB12" into a zero-based
+// column, or -1 past the last column a sheet can have
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		if col = col*26 + int(ch-'A'+1); col > xlsxMaxColumns {
+			return -1
+		}
+	}
+	return max(col-1, 0)
+}
+
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter streams rows into the sheet of a minimal workbook, so an export
+// never has to hold the whole catalog in memory
+type xlsxWriter struct {
+	zw      *zip.Writer
+	sheet   *bufio.Writer
+	numeric map[int]bool
+	rows    int
+}
+
+func newXLSXWriter(w io.Writer, numeric map[int]bool) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbookXML},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sheet goes last so it can stay open while rows arrive
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(xlsxSheetStart); err != nil {
+		return nil, err
+	}
+	return &xlsxWriter{zw: zw, sheet: sheet, numeric: numeric}, nil
+}
+
+func (x *xlsxWriter) Write(row []string) error {
+	x.rows++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.rows)
+	for i, value := range row {
+		if value == "" {
+			continue
+		}
+		ref := xlsxColumnName(i) + strconv.Itoa(x.rows)
+
+		// The header row stays text
+		if x.rows > 1 && x.numeric[i] {
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				fmt.Fprintf(x.sheet, `<c r="%s"><v>%s</v></c>`, ref, value)
+				continue
+			}
+		}
+
+		fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		xml.EscapeText(x.sheet, []byte(escapeFormula(value)))
+		x.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := x.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXLSXColumnIndex(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want int
+	}{
+		{"A1", 0},
+		{"B7", 1},
+		{"Z1", 25},
+		{"AA1", 26},
+		{"AZ10", 51},
+		{"BA1", 52},
+		{"ZZ1", 701},
+		{"AAA1", 702},
+		{"XFD1", 16383},
+		{"XFE1", -1},
+		{"ZZZZ1", -1},
+		{"AAAAAAAAAAAAAAAAAAAA1", -1},
+		{"1", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := xlsxColumnIndex(tt.ref); got != tt.want {
+			t.Errorf("xlsxColumnIndex(%q) = %d, want %d", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestXLSXColumnNameRoundTrip(t *testing.T) {
+	for _, col := range []int{0, 1, 25, 26, 27, 51, 52, 701, 702, 16383} {
+		name := xlsxColumnName(col)
+		if got := xlsxColumnIndex(name + "1"); got != col {
+			t.Errorf("xlsxColumnIndex(xlsxColumnName(%d) = %q) = %d", col, name, got)
+		}
+	}
+}
+
+func TestEscapeFormula(t *testing.T) {
+	tests := []struct {
+		value, escaped string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tcmd", "'\tcmd"},
+		{"'quoted", "'quoted"},
+		{"'=already", "''=already"},
+		{"''=twice", "'''=twice"},
+		{"a=b", "a=b"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeFormula(tt.value); got != tt.escaped {
+			t.Errorf("escapeFormula(%q) = %q, want %q", tt.value, got, tt.escaped)
+		}
+		if got := unescapeFormula(tt.escaped); got != tt.value {
+			t.Errorf("unescapeFormula(%q) = %q, want %q", tt.escaped, got, tt.value)
+		}
+	}
+}
+
+func TestReadXLSXRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		numeric map[int]bool
+		rows    [][]string
+		want    [][]string
+	}{
+		{
+			name: "plain text",
+			rows: [][]string{{"sku", "name"}, {"A-1", "Mug"}},
+			want: [][]string{{"sku", "name"}, {"A-1", "Mug"}},
+		},
+		{
+			name:    "numeric columns",
+			numeric: map[int]bool{1: true},
+			rows:    [][]string{{"sku", "price"}, {"A-1", "9.99"}, {"A-2", "not a number"}},
+			want:    [][]string{{"sku", "price"}, {"A-1", "9.99"}, {"A-2", "not a number"}},
+		},
+		{
+			name: "empty cells keep their column",
+			rows: [][]string{{"a", "", "c"}, {"", "b"}},
+			want: [][]string{{"a", "", "c"}, {"", "b"}},
+		},
+		{
+			name: "trailing empty cells are dropped",
+			rows: [][]string{{"a", "b", ""}, {""}},
+			want: [][]string{{"a", "b"}, nil},
+		},
+		{
+			name: "xml special characters and unicode",
+			rows: [][]string{{`<b>&"quoted"</b>`, "café ☕", "  padded  "}},
+			want: [][]string{{`<b>&"quoted"</b>`, "café ☕", "  padded  "}},
+		},
+		{
+			name:    "formulas come back unescaped",
+			numeric: map[int]bool{0: true},
+			rows:    [][]string{{"h"}, {"=1+1"}, {"+SUM(A1)"}, {"-5"}, {"@cmd"}, {"'=kept"}, {"'plain"}},
+			want:    [][]string{{"h"}, {"=1+1"}, {"+SUM(A1)"}, {"-5"}, {"@cmd"}, {"'=kept"}, {"'plain"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := writeSpreadsheet(t, FormatXLSX, tt.numeric, tt.rows)
+			if got := DetectSpreadsheetFormat(data); got != FormatXLSX {
+				t.Fatalf("DetectSpreadsheetFormat = %q, want %q", got, FormatXLSX)
+			}
+
+			got, err := readSpreadsheet(data, FormatXLSX, 100)
+			if err != nil {
+				t.Fatalf("readSpreadsheet: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVRoundTrip(t *testing.T) {
+	rows := [][]string{{"sku", "price"}, {"A-1", "-3"}, {"=cmd", "x"}}
+	data := writeSpreadsheet(t, FormatCSV, map[int]bool{1: true}, rows)
+
+	if strings.Contains(string(data), "\n=cmd") {
+		t.Errorf("formula was written unescaped: %q", data)
+	}
+
+	got, err := readSpreadsheet(data, FormatCSV, 100)
+	if err != nil {
+		t.Fatalf("readSpreadsheet: %v", err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("got %q, want %q", got, rows)
+	}
+}
+
+func TestReadXLSXRowLimit(t *testing.T) {
+	data := writeSpreadsheet(t, FormatXLSX, nil, [][]string{{"a"}, {"b"}, {"c"}})
+
+	if _, err := readXLSX(data, 3); err != nil {
+		t.Errorf("3 rows with a limit of 3: %v", err)
+	}
+	if _, err := readXLSX(data, 2); !errors.Is(err, ErrSpreadsheetTooLarge) {
+		t.Errorf("3 rows with a limit of 2: got %v, want ErrSpreadsheetTooLarge", err)
+	}
+}
+
+func TestReadXLSXExcelWorkbook(t *testing.T) {
+	// Shaped like an Excel save: shared strings, rich text runs, the sheet
+	// under a custom name and cells that skip columns
+	data := zipParts(t, map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Products" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Target="styles.xml"/><Relationship Id="rId3" Target="worksheets/products.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>sku</t></si><si><r><t>Blue </t></r><r><t>mug</t></r></si></sst>`,
+		"xl/worksheets/products.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>
+<row r="2"><c r="B2"><v>12.5</v></c><c r="D2" t="b"><v>1</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	got, err := readXLSX(data, 100)
+	if err != nil {
+		t.Fatalf("readXLSX: %v", err)
+	}
+	want := [][]string{{"sku", "", "Blue mug"}, {"", "12.5", "", "1"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestReadXLSXRejectsBadInput(t *testing.T) {
+	sheet := func(body string) map[string]string {
+		return map[string]string{
+			"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` + body + `</sheetData></worksheet>`,
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"not a zip", []byte("sku,name\n"), ErrUnreadableSpreadsheet},
+		{"no sheet", zipParts(t, map[string]string{"xl/workbook.xml": "<workbook/>"}), ErrUnreadableSpreadsheet},
+		{"column past XFD", zipParts(t, sheet(`<row><c r="XFE1"><v>1</v></c></row>`)), ErrUnreadableSpreadsheet},
+		{"shared string out of range", zipParts(t, sheet(`<row><c r="A1" t="s"><v>3</v></c></row>`)), ErrUnreadableSpreadsheet},
+		{"broken xml", zipParts(t, sheet(`<row><c r="A1"><v>1</row>`)), ErrUnreadableSpreadsheet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := readXLSX(tt.data, 100); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func writeSpreadsheet(t *testing.T, format string, numeric map[int]bool, rows [][]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewRowWriter(&buf, format, numeric)
+	if err != nil {
+		t.Fatalf("NewRowWriter: %v", err)
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func zipParts(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range parts {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip create %s: %v", name, err)
+		}
+		if _, err := f.Write([]byte(body)); err != nil {
+			t.Fatalf("zip write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %v", err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrObjectNotFound is returned when a stored file doesn't exist
+var ErrObjectNotFound = errors.New("file not found")
+
+// ErrInvalidObjectKey rejects keys that could escape the storage root
+var ErrInvalidObjectKey = errors.New("invalid file key")
+
+// Storage keeps uploaded files. Keys are slash-separated relative paths such
+// as "products/12/3f9a.jpg"; the API serves them under /media/<key>.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (body io.ReadCloser, contentType string, err error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	storageOnce sync.Once
+	storage     Storage
+)
+
+// FileStorage returns the storage picked by STORAGE_DRIVER: "local" (the
+// default, files under STORAGE_LOCAL_DIR) or "s3" for any S3-compatible service.
+func FileStorage() Storage {
+	storageOnce.Do(func() {
+		switch os.Getenv("STORAGE_DRIVER") {
+		case "s3":
+			s3, err := newS3StorageFromEnv()
+			if err != nil {
+				log.Fatal("❌ S3 storage is not configured: ", err)
+			}
+			storage = s3
+		default:
+			dir := os.Getenv("STORAGE_LOCAL_DIR")
+			if dir == "" {
+				dir = "uploads"
+			}
+			storage = &LocalStorage{Root: dir}
+		}
+	})
+	return storage
+}
+
+// MediaURL is the public URL the API serves a stored file at
+func MediaURL(key string) string {
+	if key == "" {
+		return ""
+	}
+	return strings.TrimSuffix(os.Getenv("MEDIA_BASE_URL"), "/") + "/media/" + key
+}
+
+// CleanObjectKey validates a key taken from a request path
+func CleanObjectKey(key string) (string, error) {
+	key = strings.TrimPrefix(key, "/")
+	if key == "" || strings.Contains(key, "\\") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return "", ErrInvalidObjectKey
+	}
+	return key, nil
+}
+
+// LocalStorage keeps files on the local filesystem under Root
+type LocalStorage struct {
+	Root string
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	key, err := CleanObjectKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStorage) Put(_ context.Context, key string, body io.Reader, _ int64, _ string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so readers never see half a file
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStorage) Get(_ context.Context, key string) (io.ReadCloser, string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return f, mime.TypeByExtension(path.Ext(key)), nil
+}
+
+func (s *LocalStorage) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// S3Storage keeps files in a bucket of any S3-compatible service (AWS S3,
+// MinIO, R2, ...) using path-style requests signed with AWS Signature V4.
+type S3Storage struct {
+	Endpoint  string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func newS3StorageFromEnv() (*S3Storage, error) {
+	s := &S3Storage{
+		Endpoint:  strings.TrimSuffix(os.Getenv("S3_ENDPOINT"), "/"),
+		Region:    os.Getenv("S3_REGION"),
+		Bucket:    os.Getenv("S3_BUCKET"),
+		AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		Client:    &http.Client{Timeout: 60 * time.Second},
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" || s.Bucket == "" || s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	return s, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.Reader, _ int64, contentType string) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, data, map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, string, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("Content-Type"), nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, "", ErrObjectNotFound
+	default:
+		defer resp.Body.Close()
+		return nil, "", s3Error(resp)
+	}
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 204 whether or not the object existed
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// do sends a signed request for an object in the bucket
+func (s *S3Storage) do(ctx context.Context, method, key string, payload []byte, headers map[string]string) (*http.Response, error) {
+	key, err := CleanObjectKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	canonicalURI := "/" + s3EscapePath(s.Bucket) + "/" + s3EscapePath(key)
+
+	req, err := http.NewRequestWithContext(ctx, method, s.Endpoint+canonicalURI, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	s.sign(req, canonicalURI, payload, time.Now().UTC())
+	return s.Client.Do(req)
+}
+
+// sign adds an AWS Signature V4 Authorization header
+func (s *S3Storage) sign(req *http.Request, canonicalURI string, payload []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalRequest := s3CanonicalRequest(req.Method, canonicalURI, req.URL.Host, payloadHash, amzDate)
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(sigV4SigningKey(s.SecretKey, date, s.Region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, s3SignedHeaders, signature))
+}
+
+// s3SignedHeaders lists, in order, the headers covered by the signature
+const s3SignedHeaders = "host;x-amz-content-sha256;x-amz-date"
+
+// s3CanonicalRequest builds the SigV4 canonical request for a request without a query string
+func s3CanonicalRequest(method, canonicalURI, host, payloadHash, amzDate string) string {
+	return strings.Join([]string{
+		method,
+		canonicalURI,
+		"", // no query string
+		"host:" + host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		s3SignedHeaders,
+		payloadHash,
+	}, "\n")
+}
+
+// sigV4SigningKey derives the key for one day, region and service from the secret
+func sigV4SigningKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// s3EscapePath URI-encodes a path the way SigV4 expects: every byte except
+// A-Z, a-z, 0-9, "-", "_", ".", "~" and the "/" between segments.
+// url.PathEscape leaves characters such as "+", "=" and "@" alone, which S3
+// would sign differently.
+func s3EscapePath(p string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&15])
+	}
+	return b.String()
+}
+
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+// tokenStateTTL bounds how stale the cache may be. Changes made on this node
+// invalidate the cache right away; other nodes pick them up within the TTL.
+const tokenStateTTL = 30 * time.Second
+
+var tokenStateCache = newTTLCache(tokenStateTTL)
+
+// IsTokenRevoked reports whether an access token was cut off by a version bump,
+// the deny-list or the revocation of its session
+func IsTokenRevoked(db *gorm.DB, claims *utils.AccessClaims) (bool, error) {
+	version, err := currentTokenVersion(db, uint(claims.UserID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil // user deleted
+	}
+	if err != nil {
+		return false, err
+	}
+	if claims.TokenVersion != version {
+		return true, nil
+	}
+
+	revoked, err := isJTIRevoked(db, claims.JTI)
+	if err != nil || revoked || claims.SessionID == "" {
+		return revoked, err
+	}
+	return isSessionRevoked(db, claims.SessionID)
+}
+
+// RevokeSession ends one of the user's sessions: its refresh tokens are deleted
+// and the access tokens issued for it stop working
+func RevokeSession(db *gorm.DB, userID uint, familyID string) error {
+	if err := utils.RevokeUserSession(db, userID, familyID); err != nil {
+		return err
+	}
+	tokenStateCache.Set(sessionCacheKey(familyID), true)
+	return nil
+}
+
+// BumpTokenVersion invalidates every access token already issued to the user
+func BumpTokenVersion(db *gorm.DB, userID uint) error {
+	if err := db.Model(&models.User{}).
+		Where("id = ?", userID).
+		UpdateColumn("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+		return fmt.Errorf("failed to bump token version: %w", err)
+	}
+
+	tokenStateCache.Delete(versionCacheKey(userID))
+	return nil
+}
+
+// RevokeAccessToken deny-lists a single access token, e.g. on logout
+func RevokeAccessToken(db *gorm.DB, claims *utils.AccessClaims) error {
+	entry := models.RevokedAccessToken{
+		JTI:       claims.JTI,
+		UserID:    uint(claims.UserID),
+		ExpiresAt: claims.ExpiresAt,
+	}
+	if err := db.Where(models.RevokedAccessToken{JTI: claims.JTI}).FirstOrCreate(&entry).Error; err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	tokenStateCache.Set(jtiCacheKey(claims.JTI), true)
+
+	// Expired tokens are rejected on their own, no need to keep them listed
+	db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedAccessToken{})
+
+	return nil
+}
+
+func currentTokenVersion(db *gorm.DB, userID uint) (int, error) {
+	if cached, ok := tokenStateCache.Get(versionCacheKey(userID)); ok {
+		return cached.(int), nil
+	}
+
+	var user models.User
+	if err := db.Select("id", "token_version").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+
+	tokenStateCache.Set(versionCacheKey(userID), user.TokenVersion)
+	return user.TokenVersion, nil
+}
+
+func isJTIRevoked(db *gorm.DB, jti string) (bool, error) {
+	if cached, ok := tokenStateCache.Get(jtiCacheKey(jti)); ok {
+		return cached.(bool), nil
+	}
+
+	var count int64
+	if err := db.Model(&models.RevokedAccessToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	revoked := count > 0
+	tokenStateCache.Set(jtiCacheKey(jti), revoked)
+	return revoked, nil
+}
+
+// isSessionRevoked reports whether the refresh token family is gone, i.e. the
+// session was revoked or logged out
+func isSessionRevoked(db *gorm.DB, familyID string) (bool, error) {
+	if cached, ok := tokenStateCache.Get(sessionCacheKey(familyID)); ok {
+		return cached.(bool), nil
+	}
+
+	var count int64
+	if err := db.Model(&models.RefreshToken{}).Where("family_id = ?", familyID).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	revoked := count == 0
+	tokenStateCache.Set(sessionCacheKey(familyID), revoked)
+	return revoked, nil
+}
+
+func versionCacheKey(userID uint) string {
+	return fmt.Sprintf("ver:%d", userID)
+}
+
+func jtiCacheKey(jti string) string {
+	return "jti:" + jti
+}
+
+func sessionCacheKey(familyID string) string {
+	return "sid:" + familyID
+}
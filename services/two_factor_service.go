@@ -0,0 +1,207 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"github.com/mahi-qwe/ecommerce-backend/utils"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorNotEnrolled = errors.New("two-factor authentication is not set up")
+	ErrTwoFactorAlreadyOn   = errors.New("two-factor authentication is already enabled")
+	ErrInvalidSecondFactor  = errors.New("invalid authentication code")
+)
+
+// IsTwoFactorEnabled reports whether the user has a confirmed authenticator
+func IsTwoFactorEnabled(db *gorm.DB, userID uint) bool {
+	var count int64
+	db.Model(&models.UserTwoFactor{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&count)
+	return count > 0
+}
+
+// StartTOTPEnrollment creates (or replaces) a pending authenticator and returns its secret and otpauth URI
+func StartTOTPEnrollment(db *gorm.DB, user models.User) (string, string, error) {
+	var existing models.UserTwoFactor
+	err := db.Where("user_id = ?", user.ID).First(&existing).Error
+	if err == nil && existing.Enabled {
+		return "", "", ErrTwoFactorAlreadyOn
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", err
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	existing.UserID = user.ID
+	existing.Secret = secret
+	existing.Enabled = false
+	existing.ConfirmedAt = nil
+	existing.LastUsedStep = 0
+	if err := db.Save(&existing).Error; err != nil {
+		return "", "", err
+	}
+
+	return secret, utils.TOTPURI(totpIssuer(), user.Email, secret), nil
+}
+
+// ConfirmTOTPEnrollment enables the pending authenticator once the user enters a valid code,
+// and returns a fresh set of recovery codes
+func ConfirmTOTPEnrollment(db *gorm.DB, userID uint, code string) ([]string, error) {
+	var tf models.UserTwoFactor
+	if err := db.Where("user_id = ?", userID).First(&tf).Error; err != nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+	if tf.Enabled {
+		return nil, ErrTwoFactorAlreadyOn
+	}
+
+	step, ok := utils.ValidateTOTP(tf.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidSecondFactor
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&tf).Updates(map[string]interface{}{
+			"enabled":        true,
+			"confirmed_at":   now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// VerifySecondFactor checks either a TOTP code or an unused recovery code
+func VerifySecondFactor(db *gorm.DB, userID uint, code, recoveryCode string) error {
+	var tf models.UserTwoFactor
+	if err := db.Where("user_id = ? AND enabled = ?", userID, true).First(&tf).Error; err != nil {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if recoveryCode != "" {
+		return useRecoveryCode(db, userID, recoveryCode)
+	}
+
+	step, ok := utils.ValidateTOTP(tf.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidSecondFactor
+	}
+
+	// A code is only good once, even within its 30 second window
+	result := db.Model(&models.UserTwoFactor{}).
+		Where("id = ? AND last_used_step < ?", tf.ID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+// DisableTwoFactor removes the authenticator and recovery codes
+func DisableTwoFactor(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.UserTwoFactor{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of a user with 2FA enabled
+func RegenerateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	if !IsTwoFactorEnabled(db, userID) {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// CountUnusedRecoveryCodes returns how many recovery codes the user has left
+func CountUnusedRecoveryCodes(db *gorm.DB, userID uint) int64 {
+	var count int64
+	db.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b)) // 8 chars
+		code := raw[:4] + "-" + raw[4:]
+
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func useRecoveryCode(db *gorm.DB, userID uint, code string) error {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "E-commerce"
+}
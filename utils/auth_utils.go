@@ -6,7 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
+	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -27,50 +27,259 @@ func CheckPasswordHash(password, hash string) bool {
 }
 
 // ------------------ JWT Functions ------------------
-func GenerateJWT(userID int, role string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
+
+// AccessTokenTTL is how long an access token stays valid
+const AccessTokenTTL = time.Minute * 45
+
+// AccessClaims is the identity carried inside an access token
+type AccessClaims struct {
+	UserID       int
+	Role         string
+	IsBlocked    bool
+	TokenVersion int       // must match users.token_version, bumped to cut off old tokens
+	JTI          string    // unique token ID, used to deny-list a single token
+	SessionID    string    // refresh token family the token was issued for, "" if none
+	ExpiresAt    time.Time // when the token stops being valid on its own
+	ActorID      int       // admin acting as this user (act claim), 0 unless impersonating
+}
+
+// ImpersonationTokenTTL is how long support can act as a customer with one token
+const ImpersonationTokenTTL = time.Minute * 15
+
+// GenerateJWT issues an access token for the session (refresh token family)
+// sessionID, so revoking that session cuts the token off too
+func GenerateJWT(user models.User, sessionID string) (string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
 	claims := jwt.MapClaims{
-		"userId": userID,
-		"role":   role,
-		"exp":    time.Now().Add(time.Minute * 45).Unix(), // 45 minutes
+		"userId":  user.ID,
+		"role":    user.Role,
+		"blocked": user.IsBlocked,
+		"ver":     user.TokenVersion,
+		"jti":     jti,
+		"sid":     sessionID,
+		"typ":     "access",
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(), // 45 minutes
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return signToken(claims)
 }
 
-// ValidateJWT validates token and returns userId + role
-func ValidateJWT(tokenStr string) (int, string, error) {
-	secret := os.Getenv("JWT_SECRET")
+// GenerateImpersonationJWT issues a short-lived access token for user, marked
+// with an act claim (RFC 8693) naming the admin who acts as them
+func GenerateImpersonationJWT(user models.User, actorID uint) (string, string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", "", err
+	}
 
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return []byte(secret), nil
-	})
+	claims := jwt.MapClaims{
+		"userId":  user.ID,
+		"role":    user.Role,
+		"blocked": user.IsBlocked,
+		"ver":     user.TokenVersion,
+		"jti":     jti,
+		"typ":     "access",
+		"act":     map[string]interface{}{"sub": fmt.Sprint(actorID)},
+		"exp":     time.Now().Add(ImpersonationTokenTTL).Unix(),
+	}
+
+	token, err := signToken(claims)
+	return token, jti, err
+}
+
+// ValidateJWT validates token and returns the claims it carries
+func ValidateJWT(tokenStr string) (*AccessClaims, error) {
+	token, err := parseToken(tokenStr, jwt.MapClaims{})
 	if err != nil {
-		return 0, "", err
+		return nil, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		// Challenge and other short-lived tokens are signed with the same keys
+		if typ, _ := claims["typ"].(string); typ != "access" {
+			return nil, fmt.Errorf("not an access token")
+		}
+
 		// Extract userId
 		userIDFloat, ok := claims["userId"].(float64)
 		if !ok {
-			return 0, "", fmt.Errorf("invalid userId in token")
+			return nil, fmt.Errorf("invalid userId in token")
 		}
 
 		// Extract role
 		role, ok := claims["role"].(string)
 		if !ok {
-			return 0, "", fmt.Errorf("invalid role in token")
+			return nil, fmt.Errorf("invalid role in token")
 		}
 
-		return int(userIDFloat), role, nil
+		// Extract token version and ID
+		version, ok := claims["ver"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("invalid version in token")
+		}
+		jti, ok := claims["jti"].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid jti in token")
+		}
+
+		exp, err := claims.GetExpirationTime()
+		if err != nil || exp == nil {
+			return nil, fmt.Errorf("invalid exp in token")
+		}
+
+		blocked, _ := claims["blocked"].(bool)
+		sessionID, _ := claims["sid"].(string)
+
+		// Impersonation tokens name the acting admin
+		actorID := 0
+		if act, ok := claims["act"].(map[string]interface{}); ok {
+			sub, _ := act["sub"].(string)
+			if actorID, err = strconv.Atoi(sub); err != nil || actorID <= 0 {
+				return nil, fmt.Errorf("invalid act in token")
+			}
+		}
+
+		return &AccessClaims{
+			UserID:       int(userIDFloat),
+			Role:         role,
+			IsBlocked:    blocked,
+			TokenVersion: int(version),
+			JTI:          jti,
+			SessionID:    sessionID,
+			ExpiresAt:    exp.Time,
+			ActorID:      actorID,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid token")
+}
+
+// Challenge token purposes
+const (
+	ChallengeTwoFactor      = "2fa"       // password accepted, second factor still needed
+	ChallengeTwoFactorSetup = "2fa_setup" // password accepted, 2FA must be set up first
+)
+
+// ChallengeTokenTTL is how long a user has to finish a multi-step login
+const ChallengeTokenTTL = time.Minute * 5
+
+// GenerateChallengeToken issues a short-lived token proving the first login
+// step succeeded. The returned jti identifies it for single-use tracking.
+func GenerateChallengeToken(userID uint, purpose string) (string, string, error) {
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", "", err
 	}
 
-	return 0, "", fmt.Errorf("invalid token")
+	claims := jwt.MapClaims{
+		"sub": fmt.Sprint(userID),
+		"typ": purpose,
+		"jti": jti,
+		"exp": time.Now().Add(ChallengeTokenTTL).Unix(),
+	}
+	token, err := signToken(claims)
+	return token, jti, err
+}
+
+// ValidateChallengeToken checks a challenge token for the given purpose and returns its user ID and jti
+func ValidateChallengeToken(tokenStr, purpose string) (uint, string, error) {
+	token, err := parseToken(tokenStr, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return 0, "", errors.New("invalid or expired challenge token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, "", errors.New("invalid challenge token")
+	}
+	if typ, _ := claims["typ"].(string); typ != purpose {
+		return 0, "", errors.New("invalid challenge token")
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return 0, "", errors.New("invalid challenge token")
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return 0, "", errors.New("invalid challenge token")
+	}
+	return uint(userID), jti, nil
+}
+
+// MediaTokenTTL is how long a link to a private upload keeps working
+const MediaTokenTTL = time.Hour
+
+// GenerateMediaToken signs access to one private stored file, e.g. a photo of a review awaiting moderation
+func GenerateMediaToken(key string) (string, error) {
+	claims := jwt.MapClaims{
+		"typ": "media",
+		"key": key,
+		"exp": time.Now().Add(MediaTokenTTL).Unix(),
+	}
+	return signToken(claims)
+}
+
+// ValidateMediaToken reports whether a media token grants access to key
+func ValidateMediaToken(tokenStr, key string) bool {
+	if tokenStr == "" {
+		return false
+	}
+	token, err := parseToken(tokenStr, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	typ, _ := claims["typ"].(string)
+	signedKey, _ := claims["key"].(string)
+	return typ == "media" && signedKey == key
+}
+
+// GenerateMagicLinkToken signs the user ID and one-time code that make up a sign-in link
+func GenerateMagicLinkToken(userID uint, code string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":  fmt.Sprint(userID),
+		"typ":  "magic_link",
+		"code": code,
+		"exp":  time.Now().Add(ttl).Unix(),
+	}
+	return signToken(claims)
+}
+
+// ValidateMagicLinkToken checks a sign-in link token and returns its user ID and code
+func ValidateMagicLinkToken(tokenStr string) (uint, string, error) {
+	token, err := parseToken(tokenStr, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return 0, "", errors.New("invalid or expired sign-in link")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, "", errors.New("invalid sign-in link")
+	}
+	if typ, _ := claims["typ"].(string); typ != "magic_link" {
+		return 0, "", errors.New("invalid sign-in link")
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return 0, "", errors.New("invalid sign-in link")
+	}
+	code, _ := claims["code"].(string)
+	if code == "" {
+		return 0, "", errors.New("invalid sign-in link")
+	}
+
+	return uint(userID), code, nil
 }
 
 // ------------------ Refresh Token Functions ------------------
@@ -87,32 +296,164 @@ func GenerateRefreshToken() (string, string, error) {
 	return token, hex.EncodeToString(hash[:]), nil
 }
 
+// RefreshTokenTTL is how long a refresh token stays valid after it is issued
+const RefreshTokenTTL = time.Hour * 1
+
+// MaxSessionLifetime caps how long one login can be kept alive by refreshing;
+// after that the user has to sign in again
+const MaxSessionLifetime = time.Hour * 24 * 30
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// NewTokenFamily returns a random ID that groups all refresh tokens rotated from one login
+func NewTokenFamily() (string, error) {
+	return randomHex(16)
+}
+
 // Save refresh token to DB
-func SaveRefreshToken(db *gorm.DB, userID uint, hashedToken string, expiresAt time.Time) error {
+func SaveRefreshToken(db *gorm.DB, userID uint, hashedToken, familyID string, expiresAt time.Time, info SessionInfo) error {
+	now := time.Now()
 	rt := models.RefreshToken{
-		UserID:    userID,
-		Token:     hashedToken,
-		ExpiresAt: expiresAt,
+		UserID:      userID,
+		Token:       hashedToken,
+		FamilyID:    familyID,
+		UserAgent:   info.UserAgent,
+		IPAddress:   info.IPAddress,
+		DeviceLabel: DeviceLabel(info.UserAgent),
+		LastUsedAt:  &now,
+		ExpiresAt:   expiresAt,
 	}
 	return db.Create(&rt).Error
 }
 
 // Validate refresh token from DB
 func ValidateRefreshToken(db *gorm.DB, token string) (*models.RefreshToken, error) {
-	hash := sha256.Sum256([]byte(token))
-	hashedToken := hex.EncodeToString(hash[:])
-
 	var rt models.RefreshToken
-	err := db.Where("token = ? AND expires_at > ?", hashedToken, time.Now()).First(&rt).Error
+	err := db.Where("token = ? AND used_at IS NULL AND expires_at > ?", hashRefreshToken(token), time.Now()).First(&rt).Error
 	if err != nil {
 		return nil, errors.New("invalid or expired refresh token")
 	}
 	return &rt, nil
 }
 
-// Delete refresh token from DB (logout)
+// RotateRefreshToken consumes the presented token and issues its successor in the same family.
+// Presenting a token that was already consumed revokes the whole family.
+func RotateRefreshToken(db *gorm.DB, token string, info SessionInfo) (string, *models.RefreshToken, error) {
+	var newToken string
+	var next models.RefreshToken
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token = ?", hashRefreshToken(token)).First(&current).Error; err != nil {
+			return errors.New("invalid or expired refresh token")
+		}
+
+		if current.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		sessionEnd := current.CreatedAt.Add(MaxSessionLifetime)
+		if time.Now().After(current.ExpiresAt) || !time.Now().Before(sessionEnd) {
+			return errors.New("invalid or expired refresh token")
+		}
+
+		// Conditional update so two concurrent refreshes can't both win
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", current.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		plain, hashed, err := GenerateRefreshToken()
+		if err != nil {
+			return err
+		}
+
+		// The successor keeps the session's start time so it still reads as one
+		// login, and never outlives the session's maximum lifetime
+		expiresAt := now.Add(RefreshTokenTTL)
+		if expiresAt.After(sessionEnd) {
+			expiresAt = sessionEnd
+		}
+		next = models.RefreshToken{
+			UserID:      current.UserID,
+			Token:       hashed,
+			FamilyID:    current.FamilyID,
+			UserAgent:   info.UserAgent,
+			IPAddress:   info.IPAddress,
+			DeviceLabel: DeviceLabel(info.UserAgent),
+			LastUsedAt:  &now,
+			ExpiresAt:   expiresAt,
+			CreatedAt:   current.CreatedAt,
+		}
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+
+		newToken = plain
+		return nil
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// Revoke outside the failed transaction so the revocation sticks
+		if revokeErr := revokeRefreshTokenFamilyByHash(db, hashRefreshToken(token)); revokeErr != nil {
+			return "", nil, revokeErr
+		}
+		return "", nil, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	return newToken, &next, nil
+}
+
+// RevokeRefreshTokenFamily deletes every token issued from the same login.
+// An empty ID is a no-op: tokens saved before families existed all share it.
+func RevokeRefreshTokenFamily(db *gorm.DB, familyID string) error {
+	if familyID == "" {
+		return nil
+	}
+	return db.Where("family_id = ?", familyID).Delete(&models.RefreshToken{}).Error
+}
+
+// Delete refresh token from DB (logout), together with the rest of its family
 func DeleteRefreshToken(db *gorm.DB, token string) error {
+	return revokeRefreshTokenFamilyByHash(db, hashRefreshToken(token))
+}
+
+func revokeRefreshTokenFamilyByHash(db *gorm.DB, hashedToken string) error {
+	var rt models.RefreshToken
+	if err := db.Where("token = ?", hashedToken).First(&rt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Tokens saved before families existed only revoke themselves
+	if rt.FamilyID == "" {
+		return db.Delete(&rt).Error
+	}
+	return RevokeRefreshTokenFamily(db, rt.FamilyID)
+}
+
+func hashRefreshToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
-	hashedToken := hex.EncodeToString(hash[:])
-	return db.Where("token = ?", hashedToken).Delete(&models.RefreshToken{}).Error
+	return hex.EncodeToString(hash[:])
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
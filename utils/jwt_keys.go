@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey is one key of the keyring, identified by its kid
+type jwtKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer // nil for verify-only keys
+	public    crypto.PublicKey
+	createdAt time.Time
+}
+
+// JWK is the public part of a key as served from /.well-known/jwks.json
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+var (
+	jwtKeysMu     sync.RWMutex
+	jwtKeys       = map[string]*jwtKey{}
+	activeJWTKey  *jwtKey
+	validJWTAlgos = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+)
+
+// LoadJWTKeys loads every PEM key in JWT_KEYS_DIR (default "keys").
+// Private keys can sign and verify, public keys only verify, so retired keys can
+// stay around until the tokens they signed have expired. The signing key is
+// JWT_ACTIVE_KID, or the newest private key. If there are no private keys, one is
+// generated (JWT_KEY_ALG, RS256 or EdDSA) and written to the directory.
+func LoadJWTKeys() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		dir = "keys"
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("could not create jwt keys dir: %w", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := map[string]*jwtKey{}
+	for _, file := range files {
+		key, err := loadJWTKeyFile(file)
+		if err != nil {
+			return fmt.Errorf("could not load jwt key %s: %w", file, err)
+		}
+		keys[key.kid] = key
+	}
+
+	var signers []*jwtKey
+	for _, key := range keys {
+		if key.private != nil {
+			signers = append(signers, key)
+		}
+	}
+
+	if len(signers) == 0 {
+		key, err := generateJWTKey(dir, os.Getenv("JWT_KEY_ALG"))
+		if err != nil {
+			return fmt.Errorf("could not generate jwt key: %w", err)
+		}
+		log.Printf("🔑 Generated new JWT signing key %s", key.kid)
+		keys[key.kid] = key
+		signers = append(signers, key)
+	}
+
+	var active *jwtKey
+	if kid := os.Getenv("JWT_ACTIVE_KID"); kid != "" {
+		active = keys[kid]
+		if active == nil || active.private == nil {
+			return fmt.Errorf("JWT_ACTIVE_KID %q has no private key in %s", kid, dir)
+		}
+	} else {
+		sort.Slice(signers, func(i, j int) bool { return signers[i].createdAt.After(signers[j].createdAt) })
+		active = signers[0]
+	}
+
+	jwtKeysMu.Lock()
+	jwtKeys = keys
+	activeJWTKey = active
+	jwtKeysMu.Unlock()
+
+	log.Printf("✅ Loaded %d JWT key(s), signing with %s (%s)", len(keys), active.kid, active.method.Alg())
+	return nil
+}
+
+// PublicJWKs returns every verification key in JWK format
+func PublicJWKs() []JWK {
+	jwtKeysMu.RLock()
+	defer jwtKeysMu.RUnlock()
+
+	jwks := make([]JWK, 0, len(jwtKeys))
+	for _, key := range jwtKeys {
+		jwk := JWK{Kid: key.kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		jwks = append(jwks, jwk)
+	}
+
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
+
+// signToken signs claims with the active key and stamps its kid in the header
+func signToken(claims jwt.Claims) (string, error) {
+	jwtKeysMu.RLock()
+	key := activeJWTKey
+	jwtKeysMu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("jwt keys not loaded")
+	}
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// parseToken verifies a token against the key named by its kid header
+func parseToken(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		jwtKeysMu.RLock()
+		key := jwtKeys[kid]
+		jwtKeysMu.RUnlock()
+
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key")
+		}
+
+		// Validate signing method against the key, not just the header
+		if token.Method.Alg() != key.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return key.public, nil
+	}, jwt.WithValidMethods(validJWTAlgos))
+}
+
+func loadJWTKeyFile(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &jwtKey{
+		kid:       strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
+		createdAt: info.ModTime(),
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return key, nil
+}
+
+func generateJWTKey(dir, alg string) (*jwtKey, error) {
+	key := &jwtKey{
+		kid:       time.Now().UTC().Format("20060102150405"),
+		createdAt: time.Now(),
+	}
+
+	switch alg {
+	case "", "RS256":
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		key.method, key.private, key.public = jwt.SigningMethodRS256, private, &private.PublicKey
+	case "EdDSA":
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, private, public
+	default:
+		return nil, fmt.Errorf("unsupported JWT_KEY_ALG %q", alg)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.private)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, key.kid+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,380 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ------------------ Listing: pagination, sorting, filtering ------------------
+//
+// Every list endpoint takes the same query parameters:
+//
+//	?limit=20              page size (max MaxPageSize)
+//	?page=2 or ?offset=20  offset pagination (the default)
+//	?cursor=               cursor pagination; pass next_cursor from the previous page,
+//	                       or an empty cursor to start
+//	?sort=-created_at      whitelisted field, "-" for descending
+//
+// and answers with {"data": [...], "page_info": {...}}.
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidListParams wraps every bad paging, sorting or filter value
+var ErrInvalidListParams = errors.New("invalid list parameters")
+
+// ListSpec describes what one endpoint allows
+type ListSpec struct {
+	SortFields  map[string]string // ?sort= name -> non-null column of the listed model
+	DefaultSort string            // e.g. "-created_at"
+}
+
+// ListParams is a parsed list request
+type ListParams struct {
+	Limit      int
+	Page       int
+	Offset     int
+	CursorMode bool
+	Sort       string // as requested, e.g. "-price"
+	sortColumn string
+	desc       bool
+	cursor     *listCursor
+}
+
+// PageInfo describes the returned page. Offset pages carry totals; cursor
+// pages carry the cursor for the next page instead.
+type PageInfo struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	HasMore    bool   `json:"has_more"`
+	Page       int    `json:"page,omitempty"`
+	Total      *int64 `json:"total,omitempty"`
+	TotalPages *int   `json:"total_pages,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// listCursor points just past the last row of a page (keyset pagination)
+type listCursor struct {
+	Sort  string      `json:"s"`
+	Kind  string      `json:"k"` // time, number, string or bool
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// ParseListParams reads paging and sorting from the query string
+func ParseListParams(query url.Values, spec ListSpec) (ListParams, error) {
+	params := ListParams{Limit: DefaultPageSize, Page: 1}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return params, fmt.Errorf("%w: limit must be a positive number", ErrInvalidListParams)
+		}
+		params.Limit = min(limit, MaxPageSize)
+	}
+
+	params.Sort = query.Get("sort")
+	if params.Sort == "" {
+		params.Sort = spec.DefaultSort
+	}
+	name := strings.TrimPrefix(params.Sort, "-")
+	column, ok := spec.SortFields[name]
+	if !ok {
+		return params, fmt.Errorf("%w: can't sort by %q", ErrInvalidListParams, name)
+	}
+	params.sortColumn = column
+	params.desc = strings.HasPrefix(params.Sort, "-")
+
+	if cursor, ok := query["cursor"]; ok {
+		params.CursorMode = true
+		if cursor[0] != "" {
+			c, err := decodeCursor(cursor[0])
+			if err != nil || c.Sort != params.Sort {
+				return params, fmt.Errorf("%w: bad cursor", ErrInvalidListParams)
+			}
+			params.cursor = c
+		}
+		return params, nil
+	}
+
+	switch {
+	case query.Get("offset") != "":
+		offset, err := strconv.Atoi(query.Get("offset"))
+		if err != nil || offset < 0 {
+			return params, fmt.Errorf("%w: offset must be zero or more", ErrInvalidListParams)
+		}
+		params.Offset = offset
+		params.Page = offset/params.Limit + 1
+	case query.Get("page") != "":
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page <= 0 {
+			return params, fmt.Errorf("%w: page must be a positive number", ErrInvalidListParams)
+		}
+		params.Page = page
+		params.Offset = (page - 1) * params.Limit
+	}
+
+	return params, nil
+}
+
+// Paginate sorts and pages query (filters already applied) into dest
+func Paginate[T any](query *gorm.DB, params ListParams, dest *[]T) (PageInfo, error) {
+	info := PageInfo{Limit: params.Limit, Sort: params.Sort}
+
+	stmt := &gorm.Statement{DB: query}
+	if err := stmt.Parse(new(T)); err != nil {
+		return info, err
+	}
+	table := stmt.Schema.Table
+	sortField := stmt.Schema.LookUpField(params.sortColumn)
+	idField := stmt.Schema.PrioritizedPrimaryField
+	if sortField == nil || idField == nil {
+		return info, fmt.Errorf("can't paginate %s by %s", table, params.sortColumn)
+	}
+
+	sortCol := table + "." + sortField.DBName
+	idCol := table + "." + idField.DBName
+	dir := "ASC"
+	if params.desc {
+		dir = "DESC"
+	}
+	// id breaks ties so pages never overlap or skip rows
+	order := fmt.Sprintf("%s %s, %s %s", sortCol, dir, idCol, dir)
+
+	if !params.CursorMode {
+		var total int64
+		countQuery := query.Session(&gorm.Session{}).Model(new(T))
+		countQuery.Statement.Preloads = nil // preloads only apply to the rows
+		if err := countQuery.Count(&total).Error; err != nil {
+			return info, err
+		}
+
+		if err := query.Order(order).Limit(params.Limit).Offset(params.Offset).Find(dest).Error; err != nil {
+			return info, err
+		}
+
+		totalPages := int((total + int64(params.Limit) - 1) / int64(params.Limit))
+		info.Page = params.Page
+		info.Total = &total
+		info.TotalPages = &totalPages
+		info.HasMore = int64(params.Offset+len(*dest)) < total
+		return info, nil
+	}
+
+	if params.cursor != nil {
+		op := ">"
+		if params.desc {
+			op = "<"
+		}
+		value, err := params.cursor.value()
+		if err != nil {
+			return info, fmt.Errorf("%w: bad cursor", ErrInvalidListParams)
+		}
+		query = query.Where(fmt.Sprintf("(%s, %s) %s (?, ?)", sortCol, idCol, op), value, params.cursor.ID)
+	}
+
+	// One extra row tells us whether there is another page
+	if err := query.Order(order).Limit(params.Limit + 1).Find(dest).Error; err != nil {
+		return info, err
+	}
+
+	if len(*dest) > params.Limit {
+		*dest = (*dest)[:params.Limit]
+		info.HasMore = true
+
+		last := reflect.ValueOf(&(*dest)[params.Limit-1]).Elem()
+		sortValue, _ := sortField.ValueOf(context.Background(), last)
+		idValue, _ := idField.ValueOf(context.Background(), last)
+
+		cursor, err := encodeCursor(params.Sort, sortValue, idValue)
+		if err != nil {
+			return info, err
+		}
+		info.NextCursor = cursor
+	}
+
+	return info, nil
+}
+
+func encodeCursor(sort string, value, id interface{}) (string, error) {
+	c := listCursor{Sort: sort, Value: value}
+
+	switch v := value.(type) {
+	case time.Time:
+		c.Kind, c.Value = "time", v.Format(time.RFC3339Nano)
+	case string:
+		c.Kind = "string"
+	case bool:
+		c.Kind = "bool"
+	default:
+		c.Kind = "number"
+	}
+
+	idNum, err := strconv.ParseUint(fmt.Sprint(id), 10, 64)
+	if err != nil {
+		return "", err
+	}
+	c.ID = uint(idNum)
+
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(s string) (*listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c listCursor
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// value converts the cursor value back to the Go type of the sort column
+func (c *listCursor) value() (interface{}, error) {
+	switch c.Kind {
+	case "time":
+		s, _ := c.Value.(string)
+		return time.Parse(time.RFC3339Nano, s)
+	case "number":
+		n, ok := c.Value.(json.Number)
+		if !ok {
+			return nil, errors.New("not a number")
+		}
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	case "string", "bool":
+		return c.Value, nil
+	}
+	return nil, errors.New("unknown cursor kind")
+}
+
+// ListFilters reads typed filters from the query string. The first bad value
+// is kept in Err so handlers can check once after reading all filters.
+type ListFilters struct {
+	query url.Values
+	err   error
+}
+
+func NewListFilters(query url.Values) *ListFilters {
+	return &ListFilters{query: query}
+}
+
+// Err returns the first invalid filter value, if any
+func (f *ListFilters) Err() error {
+	return f.err
+}
+
+func (f *ListFilters) fail(name, want string) {
+	if f.err == nil {
+		f.err = fmt.Errorf("%w: %s must be %s", ErrInvalidListParams, name, want)
+	}
+}
+
+// String returns the raw value, "" when absent
+func (f *ListFilters) String(name string) string {
+	return strings.TrimSpace(f.query.Get(name))
+}
+
+// Float returns a number filter, nil when absent
+func (f *ListFilters) Float(name string) *float64 {
+	v := f.String(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		f.fail(name, "a number")
+		return nil
+	}
+	return &n
+}
+
+// Uint returns an ID filter, nil when absent
+func (f *ListFilters) Uint(name string) *uint {
+	v := f.String(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		f.fail(name, "a positive whole number")
+		return nil
+	}
+	id := uint(n)
+	return &id
+}
+
+// Bool returns a true/false filter, nil when absent
+func (f *ListFilters) Bool(name string) *bool {
+	v := f.String(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		f.fail(name, "true or false")
+		return nil
+	}
+	return &b
+}
+
+// TimeRange reads a from/to pair of RFC 3339 times or YYYY-MM-DD dates. The
+// returned end is exclusive, so a date-only "to" covers that whole day.
+func (f *ListFilters) TimeRange(fromName, toName string) (from, to *time.Time) {
+	from, _ = f.time(fromName)
+	end, dateOnly := f.time(toName)
+	if end != nil && dateOnly {
+		next := end.AddDate(0, 0, 1)
+		end = &next
+	}
+	return from, end
+}
+
+func (f *ListFilters) time(name string) (*time.Time, bool) {
+	v := f.String(name)
+	if v == "" {
+		return nil, false
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, false
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return &t, true
+	}
+	f.fail(name, "an RFC 3339 time or a YYYY-MM-DD date")
+	return nil, false
+}
+
+// WhereRange adds column >= from and column < to for the bounds that are set
+func WhereRange[V any](query *gorm.DB, column string, from, to *V) *gorm.DB {
+	if from != nil {
+		query = query.Where(column+" >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where(column+" < ?", *to)
+	}
+	return query
+}
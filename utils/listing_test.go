@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	created := time.Date(2026, 3, 14, 15, 9, 26, 535897932, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		name  string
+		value interface{}
+		id    interface{}
+		want  interface{}
+	}{
+		{"time keeps nanoseconds", created, uint(7), created},
+		{"int", 42, uint(1), int64(42)},
+		{"negative int", int64(-3), uint(2), int64(-3)},
+		{"large int", int64(1) << 60, uint(3), int64(1) << 60},
+		{"uint", uint(9), uint(4), int64(9)},
+		{"float", 19.99, uint(5), 19.99},
+		{"whole float", 20.0, uint(6), int64(20)},
+		{"string", `Café "☕" ,/?`, uint(8), `Café "☕" ,/?`},
+		{"empty string", "", uint(9), ""},
+		{"bool", true, uint(10), true},
+		{"int id", "x", 11, "x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := encodeCursor("-price", tt.value, tt.id)
+			if err != nil {
+				t.Fatalf("encodeCursor: %v", err)
+			}
+			if _, err := url.ParseQuery("cursor=" + encoded); err != nil {
+				t.Errorf("cursor %q is not query safe: %v", encoded, err)
+			}
+
+			c, err := decodeCursor(encoded)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if c.Sort != "-price" {
+				t.Errorf("sort = %q, want -price", c.Sort)
+			}
+
+			got, err := c.value()
+			if err != nil {
+				t.Fatalf("value: %v", err)
+			}
+			if want, ok := tt.want.(time.Time); ok {
+				if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(want) {
+					t.Errorf("value = %v, want %v", got, want)
+				}
+			} else if got != tt.want {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeCursorRejectsBadID(t *testing.T) {
+	for _, id := range []interface{}{"abc", -1, 1.5, nil} {
+		if _, err := encodeCursor("id", 1, id); err == nil {
+			t.Errorf("encodeCursor with id %#v: want an error", id)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "%%%"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"id"}`))},
+		{"not json", b64("hello")},
+		{"wrong shape", b64(`[1,2,3]`)},
+		{"negative id", b64(`{"s":"id","k":"number","v":1,"id":-1}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor); err == nil {
+				t.Errorf("decodeCursor(%q): want an error", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestCursorValueRejectsMismatchedKind(t *testing.T) {
+	b64 := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	for _, raw := range []string{
+		`{"s":"id","k":"number","v":"1","id":1}`,
+		`{"s":"id","k":"time","v":"yesterday","id":1}`,
+		`{"s":"id","k":"time","v":5,"id":1}`,
+		`{"s":"id","k":"blob","v":1,"id":1}`,
+	} {
+		c, err := decodeCursor(b64(raw))
+		if err != nil {
+			t.Fatalf("decodeCursor(%s): %v", raw, err)
+		}
+		if _, err := c.value(); err == nil {
+			t.Errorf("value of %s: want an error", raw)
+		}
+	}
+}
+
+func TestParseListParamsCursor(t *testing.T) {
+	spec := ListSpec{
+		SortFields:  map[string]string{"created_at": "CreatedAt", "price": "Price"},
+		DefaultSort: "-created_at",
+	}
+	priceCursor, err := encodeCursor("price", 10, uint(3))
+	if err != nil {
+		t.Fatalf("encodeCursor: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantErr    bool
+		wantCursor bool
+	}{
+		{"empty cursor starts cursor mode", "cursor=", false, false},
+		{"cursor for the same sort", "sort=price&cursor=" + priceCursor, false, true},
+		{"cursor for another sort", "sort=-price&cursor=" + priceCursor, true, false},
+		{"cursor with the default sort", "cursor=" + priceCursor, true, false},
+		{"broken cursor", "cursor=abc", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			params, err := ParseListParams(query, spec)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidListParams) {
+					t.Errorf("err = %v, want ErrInvalidListParams", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseListParams: %v", err)
+			}
+			if !params.CursorMode {
+				t.Error("CursorMode = false, want true")
+			}
+			if got := params.cursor != nil; got != tt.wantCursor {
+				t.Errorf("has cursor = %v, want %v", got, tt.wantCursor)
+			}
+		})
+	}
+}
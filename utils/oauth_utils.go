@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OAuthStateTTL is how long a user has to come back from the provider
+const OAuthStateTTL = time.Minute * 10
+
+// OAuthState is what we need to remember between redirecting to a provider and its callback.
+// It travels in a signed, HTTP-only cookie so no server-side storage is needed.
+type OAuthState struct {
+	Provider string
+	State    string // echoed back by the provider, guards against CSRF
+	Nonce    string // must come back inside the ID token, guards against replay
+	Verifier string // PKCE code verifier
+	// LinkUserID is set when a signed-in user is linking the provider to their
+	// account rather than logging in
+	LinkUserID uint
+}
+
+// NewOAuthState creates fresh random state, nonce and PKCE verifier for a provider
+func NewOAuthState(provider string) (*OAuthState, error) {
+	state, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthState{Provider: provider, State: state, Nonce: nonce, Verifier: verifier}, nil
+}
+
+// Sign serializes the state into a signed token for the cookie
+func (s *OAuthState) Sign() (string, error) {
+	return signToken(jwt.MapClaims{
+		"typ":      "oauth_state",
+		"provider": s.Provider,
+		"state":    s.State,
+		"nonce":    s.Nonce,
+		"verifier": s.Verifier,
+		"link":     fmt.Sprint(s.LinkUserID),
+		"exp":      time.Now().Add(OAuthStateTTL).Unix(),
+	})
+}
+
+// ParseOAuthState verifies and decodes a state cookie
+func ParseOAuthState(tokenStr string) (*OAuthState, error) {
+	token, err := parseToken(tokenStr, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired oauth state")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid oauth state")
+	}
+	if typ, _ := claims["typ"].(string); typ != "oauth_state" {
+		return nil, errors.New("invalid oauth state")
+	}
+
+	state := &OAuthState{}
+	state.Provider, _ = claims["provider"].(string)
+	state.State, _ = claims["state"].(string)
+	state.Nonce, _ = claims["nonce"].(string)
+	state.Verifier, _ = claims["verifier"].(string)
+	if state.State == "" || state.Verifier == "" {
+		return nil, errors.New("invalid oauth state")
+	}
+	if link, _ := claims["link"].(string); link != "" {
+		linkUserID, err := strconv.ParseUint(link, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid oauth state")
+		}
+		state.LinkUserID = uint(linkUserID)
+	}
+
+	return state, nil
+}
+
+// PKCEChallenge derives the S256 code challenge sent with the authorization request
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// One-time OAuth code token types
+const (
+	OAuthLoginCode = "oauth_login" // handed to the frontend by the callback, traded for a session
+	OAuthLinkCode  = "oauth_link"  // lets a signed-in user's browser start linking a provider
+)
+
+// GenerateOAuthCodeToken signs the user ID, provider and one-time code of an
+// OAuth code token. binding, if set, must be presented again with the token,
+// e.g. a nonce kept in a cookie of the browser it was issued to.
+func GenerateOAuthCodeToken(typ string, userID uint, provider, code, binding string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":      fmt.Sprint(userID),
+		"typ":      typ,
+		"provider": provider,
+		"code":     code,
+		"bind":     binding,
+		"exp":      time.Now().Add(ttl).Unix(),
+	}
+	return signToken(claims)
+}
+
+// OAuthCodeToken is the content of a verified OAuth code token
+type OAuthCodeToken struct {
+	UserID   uint
+	Provider string
+	Code     string
+	Binding  string
+}
+
+// ValidateOAuthCodeToken checks an OAuth code token of the given type and returns its content
+func ValidateOAuthCodeToken(tokenStr, typ string) (*OAuthCodeToken, error) {
+	token, err := parseToken(tokenStr, jwt.MapClaims{})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired code")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid code")
+	}
+	if t, _ := claims["typ"].(string); t != typ {
+		return nil, errors.New("invalid code")
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid code")
+	}
+
+	out := &OAuthCodeToken{UserID: uint(userID)}
+	out.Provider, _ = claims["provider"].(string)
+	out.Code, _ = claims["code"].(string)
+	out.Binding, _ = claims["bind"].(string)
+	if out.Provider == "" || out.Code == "" {
+		return nil, errors.New("invalid code")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mahi-qwe/ecommerce-backend/models"
+	"gorm.io/gorm"
+)
+
+// SessionInfo describes the client a refresh token is issued to
+type SessionInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// ListActiveSessions returns the live refresh token of every session the user has open
+func ListActiveSessions(db *gorm.DB, userID uint) ([]models.RefreshToken, error) {
+	var sessions []models.RefreshToken
+	err := db.Where("user_id = ? AND used_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeUserSession revokes one session of a user, identified by its token family
+func RevokeUserSession(db *gorm.DB, userID uint, familyID string) error {
+	result := db.Where("user_id = ? AND family_id = ?", userID, familyID).Delete(&models.RefreshToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("session not found")
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every session of a user ("log out everywhere")
+func RevokeUserSessions(db *gorm.DB, userID uint) error {
+	return db.Where("user_id = ?", userID).Delete(&models.RefreshToken{}).Error
+}
+
+// FindSessionFamily returns the token family of a plain refresh token, or "" if unknown
+func FindSessionFamily(db *gorm.DB, token string) string {
+	var rt models.RefreshToken
+	if err := db.Where("token = ?", hashRefreshToken(token)).First(&rt).Error; err != nil {
+		return ""
+	}
+	return rt.FamilyID
+}
+
+// DeviceLabel turns a user agent into a short label such as "Chrome on Windows"
+func DeviceLabel(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+	ua := strings.ToLower(userAgent)
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "postman"):
+		browser = "Postman"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os") || strings.Contains(ua, "macintosh"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}